@@ -0,0 +1,191 @@
+package alert
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/sirupsen/logrus"
+)
+
+// state tracks a rule's recent matches and when it last fired.
+type state struct {
+	matches []time.Time
+	fired   time.Time
+}
+
+// Engine evaluates rules against the messages flowing through a bot and
+// queues webhooks for the rules that fire. Rules from the config file are
+// fixed, rules from the store are reloaded periodically.
+type Engine struct {
+	static []Rule
+	store  *Store
+	sender *Sender
+	l      logrus.FieldLogger
+
+	mu     sync.Mutex
+	rules  []*compiled
+	states map[string]*state
+	// only holds the channels evaluated when bots share replicated channels, nil evaluates all
+	only map[string]bool
+}
+
+// NewEngine creates an engine for the rules of c and, unless store is nil, the stored rules.
+func NewEngine(c *config.Config, store *Store, l logrus.FieldLogger) *Engine {
+	e := &Engine{
+		static: FromConfig(c),
+		store:  store,
+		sender: NewSender(1000, l),
+		l:      l,
+		states: map[string]*state{},
+	}
+	e.setRules(nil)
+	return e
+}
+
+// Reload fetches the stored rules.
+func (e *Engine) Reload(ctx context.Context) error {
+	if e.store == nil {
+		return nil
+	}
+
+	stored, err := e.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	e.setRules(stored)
+	return nil
+}
+
+func (e *Engine) setRules(stored []Rule) {
+	rules := []*compiled{}
+	for _, r := range append(append([]Rule{}, e.static...), stored...) {
+		if r.Disabled {
+			continue
+		}
+		c, err := compile(r)
+		if err != nil {
+			e.l.WithError(err).WithField("rule", r.ID).Warnln("Skipping invalid alert rule")
+			continue
+		}
+		rules = append(rules, c)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = rules
+	states := map[string]*state{}
+	for _, r := range rules {
+		if s, ok := e.states[r.ID]; ok {
+			states[r.ID] = s
+		}
+	}
+	e.states = states
+}
+
+// Run delivers webhooks and reloads the stored rules every reload until ctx is done.
+func (e *Engine) Run(ctx context.Context, reload time.Duration) {
+	go e.sender.Run(ctx, 4)
+
+	for {
+		if err := e.Reload(ctx); err != nil {
+			e.l.WithError(err).Warnln("Could not reload alert rules")
+		}
+
+		select {
+		case <-time.After(reload):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Hook returns an irc.Hook evaluating every flushed message. It only queues
+// deliveries, so slow webhooks never hold up the pipeline.
+func (e *Engine) Hook() irc.Hook {
+	return e.Evaluate
+}
+
+// EvaluateOnly restricts evaluation to channels. Workers evaluate only the
+// channels they are the primary replica of, so replicated channels don't fire
+// every rule once per replica. nil evaluates every channel again.
+func (e *Engine) EvaluateOnly(channels []string) {
+	var only map[string]bool
+	if channels != nil {
+		only = map[string]bool{}
+		for _, ch := range channels {
+			only[strings.ToLower(strings.TrimPrefix(ch, "#"))] = true
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.only = only
+}
+
+// Evaluate checks a message against every rule.
+func (e *Engine) Evaluate(id string, m irc.Message) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.only != nil && !e.only[strings.ToLower(strings.TrimPrefix(m.Channel, "#"))] {
+		return
+	}
+
+	for _, r := range e.rules {
+		if !r.matches(m) {
+			continue
+		}
+
+		s := e.states[r.ID]
+		if s == nil {
+			s = &state{}
+			e.states[r.ID] = s
+		}
+
+		at := m.Timestamp
+		since := at.Add(-time.Duration(r.Window))
+		kept := s.matches[:0]
+		for _, t := range s.matches {
+			if t.After(since) {
+				kept = append(kept, t)
+			}
+		}
+		s.matches = append(kept, at)
+
+		if len(s.matches) < r.Threshold || (!s.fired.IsZero() && at.Sub(s.fired) < time.Duration(r.Cooldown)) {
+			continue
+		}
+
+		d := delivery{
+			webhook: r.Webhook,
+			secret:  r.Secret,
+			payload: Payload{
+				Delivery:  deliveryID(r.ID, id),
+				Rule:      RuleInfo{ID: r.ID, Name: r.Name},
+				MessageID: id,
+				Message:   m,
+				Matches:   len(s.matches),
+				Window:    r.Window,
+				FiredAt:   time.Now().UTC(),
+			},
+		}
+		s.matches = s.matches[:0]
+		s.fired = at
+
+		if !e.sender.Queue(d) {
+			e.l.WithField("rule", r.ID).Warnln("Alert queue is full, dropping alert")
+		}
+	}
+}
+
+func deliveryID(ruleID, messageID string) string {
+	sum := sha1.Sum([]byte(ruleID + "\x00" + messageID))
+	return hex.EncodeToString(sum[:])
+}
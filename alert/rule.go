@@ -0,0 +1,159 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/pkg/errors"
+)
+
+// Sources of rules.
+const (
+	// SourceConfig rules come from ALERT_RULES and can't be changed through the API.
+	SourceConfig = "config"
+	// SourceAPI rules are stored in the alerts index.
+	SourceAPI = "api"
+)
+
+var ruleID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Duration is a time.Duration written as "1m30s" in JSON.
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string, or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var ns int64
+		if err := json.Unmarshal(data, &ns); err != nil {
+			return errors.New("durations must be strings like \"1m30s\"")
+		}
+		*d = Duration(ns)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule sends a webhook when messages match. A message matches when its text
+// matches Pattern and it was sent in one of Channels by one of Users, empty
+// fields match everything. The rule fires once Threshold messages matched
+// within Window, and at most once per Cooldown.
+type Rule struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name,omitempty"`
+	Pattern   string   `json:"pattern,omitempty"`
+	Channels  []string `json:"channels,omitempty"`
+	Users     []string `json:"users,omitempty"`
+	Threshold int      `json:"threshold,omitempty"`
+	Window    Duration `json:"window,omitempty"`
+	Cooldown  Duration `json:"cooldown,omitempty"`
+	Webhook   string   `json:"webhook"`
+	// Secret signs the webhook body, it is never returned by the API
+	Secret   string `json:"secret,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Source   string `json:"source,omitempty"`
+}
+
+// Validate checks that the rule can be compiled and delivered.
+func (r Rule) Validate() error {
+	if !ruleID.MatchString(r.ID) {
+		return errors.New("id must be 1 to 64 letters, digits, dashes or underscores")
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return errors.Wrap(err, "invalid pattern")
+	}
+	u, err := url.Parse(r.Webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook must be an http or https url")
+	}
+	if r.Threshold < 0 || r.Window < 0 || r.Cooldown < 0 {
+		return errors.New("threshold, window and cooldown cannot be negative")
+	}
+	if r.Threshold > 1 && r.Window == 0 {
+		return errors.New("a threshold above 1 needs a window")
+	}
+	return nil
+}
+
+// Redacted returns the rule without its secret.
+func (r Rule) Redacted() Rule {
+	r.Secret = ""
+	return r
+}
+
+// FromConfig returns the rules of ALERT_RULES.
+func FromConfig(c *config.Config) []Rule {
+	rules := make([]Rule, 0, len(c.AlertRules))
+	for _, r := range c.AlertRules {
+		rules = append(rules, Rule{
+			ID:        r.ID,
+			Name:      r.Name,
+			Pattern:   r.Pattern,
+			Channels:  r.Channels,
+			Users:     r.Users,
+			Threshold: r.Threshold,
+			Window:    Duration(r.Window),
+			Cooldown:  Duration(r.Cooldown),
+			Webhook:   r.Webhook,
+			Secret:    r.Secret,
+			Disabled:  r.Disabled,
+			Source:    SourceConfig,
+		})
+	}
+	return rules
+}
+
+// compiled is a rule prepared for matching.
+type compiled struct {
+	Rule
+	re       *regexp.Regexp
+	channels map[string]bool
+	users    map[string]bool
+}
+
+func compile(r Rule) (*compiled, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	c := &compiled{Rule: r, channels: map[string]bool{}, users: map[string]bool{}}
+	if r.Pattern != "" {
+		c.re = regexp.MustCompile(r.Pattern)
+	}
+	for _, ch := range r.Channels {
+		c.channels["#"+strings.ToLower(strings.TrimPrefix(ch, "#"))] = true
+	}
+	for _, u := range r.Users {
+		c.users[strings.ToLower(u)] = true
+	}
+	if c.Threshold < 1 {
+		c.Threshold = 1
+	}
+	return c, nil
+}
+
+func (c *compiled) matches(m irc.Message) bool {
+	if len(c.channels) > 0 && !c.channels[strings.ToLower(m.Channel)] {
+		return false
+	}
+	if len(c.users) > 0 && !c.users[strings.ToLower(m.User)] {
+		return false
+	}
+	return c.re == nil || c.re.MatchString(m.Message)
+}
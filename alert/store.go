@@ -0,0 +1,88 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+)
+
+// Index holds the rules managed through the API.
+const Index = "alerts"
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"id":{
+				"type":"keyword"
+			},
+			"pattern":{
+				"type":"keyword",
+				"index":false
+			}
+		}
+	}
+}`
+
+// Store keeps the rules managed through the API.
+type Store struct {
+	connector *config.ElasticConnector
+}
+
+// NewStore creates the alerts index if it doesn't exist yet.
+func NewStore(connector *config.ElasticConnector) (*Store, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+	return &Store{connector: connector}, nil
+}
+
+// List returns every stored rule.
+func (s *Store) List(ctx context.Context) ([]Rule, error) {
+	sr, err := s.connector.GetClient().Search().Index(Index).Sort("id", true).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []Rule{}
+	for _, hit := range sr.Hits.Hits {
+		var r Rule
+		if err := json.Unmarshal(hit.Source, &r); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Get returns the rule with id, ok is false when there is none.
+func (s *Store) Get(ctx context.Context, id string) (rule Rule, ok bool, err error) {
+	res, err := s.connector.GetClient().Get().Index(Index).Id(id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return rule, false, nil
+	}
+	if err != nil {
+		return rule, false, err
+	}
+
+	err = json.Unmarshal(res.Source, &rule)
+	return rule, err == nil, err
+}
+
+// Put creates or replaces a rule.
+func (s *Store) Put(ctx context.Context, r Rule) error {
+	r.Source = SourceAPI
+	_, err := s.connector.GetClient().Index().Index(Index).Id(r.ID).BodyJson(r).Refresh("true").Do(ctx)
+	return err
+}
+
+// Delete removes a rule, ok is false when there was none.
+func (s *Store) Delete(ctx context.Context, id string) (bool, error) {
+	_, err := s.connector.GetClient().Delete().Index(Index).Id(id).Refresh("true").Do(ctx)
+	if elastic.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
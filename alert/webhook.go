@@ -0,0 +1,168 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook headers.
+const (
+	// SignatureHeader holds "sha256=" and the hex HMAC-SHA256 of the body keyed with the rule's secret.
+	SignatureHeader = "X-TTV-Log-Signature"
+	// DeliveryHeader identifies a delivery, it stays the same across retries.
+	DeliveryHeader = "X-TTV-Log-Delivery"
+	// EventHeader is always "alert".
+	EventHeader = "X-TTV-Log-Event"
+)
+
+// RuleInfo identifies the rule that fired in a payload.
+type RuleInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Payload is the JSON body sent to webhooks.
+type Payload struct {
+	Delivery  string      `json:"delivery"`
+	Rule      RuleInfo    `json:"rule"`
+	MessageID string      `json:"message_id"`
+	Message   irc.Message `json:"message"`
+	Matches   int         `json:"matches"`
+	Window    Duration    `json:"window,omitempty"`
+	FiredAt   time.Time   `json:"fired_at"`
+}
+
+// delivery is a payload waiting to be sent.
+type delivery struct {
+	webhook string
+	secret  string
+	payload Payload
+}
+
+// Sign returns the signature header value of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sender delivers payloads, retrying failed deliveries with exponential backoff.
+type Sender struct {
+	Client   *http.Client
+	Attempts int
+	Backoff  time.Duration
+
+	queue chan delivery
+	l     logrus.FieldLogger
+}
+
+// NewSender creates a sender queueing up to buffer deliveries.
+func NewSender(buffer int, l logrus.FieldLogger) *Sender {
+	return &Sender{
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Attempts: 5,
+		Backoff:  time.Second,
+		queue:    make(chan delivery, buffer),
+		l:        l,
+	}
+}
+
+// Queue schedules a delivery, it is dropped when the queue is full.
+func (s *Sender) Queue(d delivery) bool {
+	select {
+	case s.queue <- d:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run sends queued deliveries with workers goroutines until ctx is done.
+func (s *Sender) Run(ctx context.Context, workers int) {
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case d := <-s.queue:
+					s.deliver(ctx, d)
+				case <-ctx.Done():
+					done <- struct{}{}
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+}
+
+func (s *Sender) deliver(ctx context.Context, d delivery) {
+	l := s.l.WithField("rule", d.payload.Rule.ID).WithField("delivery", d.payload.Delivery)
+
+	body, err := json.Marshal(d.payload)
+	if err != nil {
+		l.WithError(err).Errorln("Could not encode alert")
+		return
+	}
+
+	backoff := s.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.send(ctx, d, body)
+		if err == nil {
+			l.Debugln("Delivered alert")
+			return
+		}
+		if !retry || attempt >= s.Attempts {
+			l.WithError(err).Warnf("Could not deliver alert after %d attempts", attempt)
+			return
+		}
+
+		l.WithError(err).Debugf("Retrying alert in %s", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// send posts body once, retry is true when the failure might be temporary.
+func (s *Sender) send(ctx context.Context, d delivery, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, d.webhook, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ttv-log")
+	req.Header.Set(EventHeader, "alert")
+	req.Header.Set(DeliveryHeader, d.payload.Delivery)
+	if d.secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.secret, body))
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with %s", res.Status)
+	return res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,27 @@
+package analysis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// ActiveChannels returns up to limit channels with messages between from and to, busiest first, without the leading #.
+func ActiveChannels(ctx context.Context, client *elastic.Client, from, to time.Time, limit int) ([]string, error) {
+	sr, err := client.Search().Index("twitch").
+		Query(elastic.NewRangeQuery("Timestamp").Gte(from).Lt(to)).
+		Size(0).
+		Aggregation("channels", elastic.NewTermsAggregation().Field("Channel.keyword").Size(limit)).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []string{}
+	for _, key := range termKeys(sr.Aggregations, "channels") {
+		channels = append(channels, strings.TrimPrefix(key, "#"))
+	}
+	return channels, nil
+}
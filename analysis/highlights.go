@@ -0,0 +1,307 @@
+package analysis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+)
+
+// HighlightIndex holds the detected highlight moments.
+const HighlightIndex = "highlights"
+
+const highlightMapping = `
+{
+	"mappings":{
+		"properties":{
+			"channel":{
+				"type":"keyword"
+			},
+			"start":{
+				"type":"date"
+			},
+			"end":{
+				"type":"date"
+			},
+			"peak":{
+				"type":"date"
+			},
+			"score":{
+				"type":"float"
+			},
+			"phrases":{
+				"type":"keyword"
+			},
+			"terms":{
+				"type":"keyword"
+			},
+			"emotes":{
+				"type":"keyword"
+			},
+			"detected_at":{
+				"type":"date"
+			}
+		}
+	}
+}`
+
+// Highlight is a burst of chat activity far above the channel's usual rate.
+type Highlight struct {
+	ID       string    `json:"id"`
+	Channel  string    `json:"channel"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Peak     time.Time `json:"peak"`
+	Messages int64     `json:"messages"`
+	// PeakRate and Baseline are in messages per minute
+	PeakRate float64 `json:"peak_rate"`
+	Baseline float64 `json:"baseline"`
+	// Score is how many times the baseline rate the peak reached
+	Score float64 `json:"score"`
+	// Phrases are the messages repeated most during the burst, Terms the words
+	// that stood out against the baseline window
+	Phrases    []string  `json:"phrases"`
+	Terms      []string  `json:"terms"`
+	Emotes     []string  `json:"emotes"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// Detector flags intervals whose message count is far above a rolling baseline.
+// An interval is a burst when it has at least MinMessages, at least MinRatio
+// times the baseline mean and is more than Threshold standard deviations above it.
+type Detector struct {
+	Interval    time.Duration
+	Window      time.Duration
+	Threshold   float64
+	MinRatio    float64
+	MinMessages int64
+	// Top is the number of phrases, terms and emotes kept per highlight
+	Top int
+
+	connector *config.ElasticConnector
+}
+
+// NewDetector creates a detector with 30s intervals over a 10 minute baseline.
+func NewDetector(connector *config.ElasticConnector) (*Detector, error) {
+	if err := connector.EnsureIndex(HighlightIndex, highlightMapping); err != nil {
+		return nil, err
+	}
+
+	return &Detector{
+		Interval:    30 * time.Second,
+		Window:      10 * time.Minute,
+		Threshold:   3,
+		MinRatio:    2,
+		MinMessages: 20,
+		Top:         5,
+		connector:   connector,
+	}, nil
+}
+
+// Detect finds the highlights of channel between from and to. The baseline
+// window before from is read as well, so bursts right at from are found.
+func (d *Detector) Detect(ctx context.Context, channel string, from, to time.Time) ([]*Highlight, error) {
+	window := int(d.Window / d.Interval)
+	if window < 2 {
+		return nil, fmt.Errorf("the baseline window must hold at least two intervals")
+	}
+
+	start := from.Add(-d.Window).Truncate(d.Interval)
+	counts, err := d.histogram(ctx, channel, start, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var highlights []*Highlight
+	var current *Highlight
+	for i := window; i < len(counts); i++ {
+		at := start.Add(time.Duration(i) * d.Interval)
+		mean, std := stats(counts[i-window : i])
+		c := float64(counts[i])
+
+		burst := counts[i] >= d.MinMessages && c >= mean*d.MinRatio && c > mean+d.Threshold*std
+		if current != nil && counts[i] >= d.MinMessages && c >= current.Baseline*d.Interval.Minutes()*d.MinRatio {
+			// Keep extending a burst while chat stays well above the baseline it started from
+			current.End = at.Add(d.Interval)
+			current.Messages += counts[i]
+			if rate := c / d.Interval.Minutes(); rate > current.PeakRate {
+				current.PeakRate = rate
+				current.Peak = at
+			}
+			continue
+		}
+		if current != nil {
+			highlights = append(highlights, current)
+			current = nil
+		}
+		if burst && !at.Before(from.Truncate(d.Interval)) {
+			current = &Highlight{
+				Channel:  strings.TrimPrefix(channel, "#"),
+				Start:    at,
+				End:      at.Add(d.Interval),
+				Peak:     at,
+				Messages: counts[i],
+				PeakRate: c / d.Interval.Minutes(),
+				Baseline: mean / d.Interval.Minutes(),
+			}
+		}
+	}
+	if current != nil {
+		highlights = append(highlights, current)
+	}
+
+	now := time.Now().UTC()
+	for _, h := range highlights {
+		h.ID = highlightID(h.Channel, h.Start)
+		h.Score = h.PeakRate / math.Max(h.Baseline, 1/d.Interval.Minutes())
+		h.DetectedAt = now
+		if err := d.describe(ctx, h); err != nil {
+			return nil, err
+		}
+	}
+	return highlights, nil
+}
+
+func stats(counts []int64) (mean, std float64) {
+	for _, c := range counts {
+		mean += float64(c)
+	}
+	mean /= float64(len(counts))
+	for _, c := range counts {
+		std += (float64(c) - mean) * (float64(c) - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(counts)))
+}
+
+// histogram returns the number of messages of channel per interval, including empty intervals.
+func (d *Detector) histogram(ctx context.Context, channel string, from, to time.Time) ([]int64, error) {
+	agg := elastic.NewDateHistogramAggregation().
+		Field("Timestamp").
+		Interval(fmt.Sprintf("%dms", d.Interval/time.Millisecond)).
+		MinDocCount(0).
+		ExtendedBounds(from, to)
+
+	sr, err := d.connector.GetClient().Search().Index("twitch").
+		Query(channelQuery(channel, from, to)).
+		Size(0).
+		Aggregation("activity", agg).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	n := int(to.Sub(from)/d.Interval) + 1
+	counts := make([]int64, n)
+	if histogram, ok := sr.Aggregations.DateHistogram("activity"); ok {
+		for _, b := range histogram.Buckets {
+			i := int(time.Unix(0, int64(b.Key)*int64(time.Millisecond)).Sub(from) / d.Interval)
+			if i >= 0 && i < n {
+				counts[i] = b.DocCount
+			}
+		}
+	}
+	return counts, nil
+}
+
+// describe fills in the phrases, terms and emotes of a highlight.
+func (d *Detector) describe(ctx context.Context, h *Highlight) error {
+	background := channelQuery(h.Channel, h.Start.Add(-d.Window), h.End)
+
+	sr, err := d.connector.GetClient().Search().Index("twitch").
+		Query(channelQuery(h.Channel, h.Start, h.End)).
+		Size(0).
+		Aggregation("phrases", elastic.NewTermsAggregation().Field("Message.keyword").Size(d.Top).MinDocCount(2)).
+		Aggregation("terms", elastic.NewSignificantTermsAggregation().Field("Message").RequiredSize(d.Top).BackgroundFilter(background)).
+		Aggregation("emotes", elastic.NewTermsAggregation().Field("Emotes").Size(d.Top)).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	h.Phrases = termKeys(sr.Aggregations, "phrases")
+	h.Emotes = termKeys(sr.Aggregations, "emotes")
+	h.Terms = []string{}
+	if agg, ok := sr.Aggregations.SignificantTerms("terms"); ok {
+		for _, b := range agg.Buckets {
+			h.Terms = append(h.Terms, b.Key)
+		}
+	}
+	return nil
+}
+
+func termKeys(aggs elastic.Aggregations, name string) []string {
+	keys := []string{}
+	if agg, ok := aggs.Terms(name); ok {
+		for _, b := range agg.Buckets {
+			keys = append(keys, fmt.Sprint(b.Key))
+		}
+	}
+	return keys
+}
+
+// channelQuery matches the messages of a channel, given without the leading #, in a time range.
+func channelQuery(channel string, from, to time.Time) elastic.Query {
+	return elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("Channel.keyword", "#"+strings.TrimPrefix(channel, "#")),
+		elastic.NewRangeQuery("Timestamp").Gte(from).Lt(to),
+	)
+}
+
+func highlightID(channel string, start time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%d", channel, start.Unix())))
+	return hex.EncodeToString(sum[:])
+}
+
+// Save stores highlights, replacing earlier detections of the same burst.
+func (d *Detector) Save(ctx context.Context, highlights []*Highlight) error {
+	if len(highlights) == 0 {
+		return nil
+	}
+
+	bulk := d.connector.GetClient().Bulk().Index(HighlightIndex)
+	for _, h := range highlights {
+		bulk.Add(elastic.NewBulkIndexRequest().Id(h.ID).Doc(h))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("could not store %d highlights: %s", len(failed), failed[0].Error.Reason)
+	}
+	return nil
+}
+
+// FindHighlights returns the stored highlights of channel between from and to, best first.
+func FindHighlights(ctx context.Context, client *elastic.Client, channel string, from, to time.Time, limit int) ([]*Highlight, error) {
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("channel", strings.TrimPrefix(channel, "#")),
+		elastic.NewRangeQuery("start").Gte(from).Lte(to),
+	)
+
+	sr, err := client.Search().Index(HighlightIndex).Query(q).Sort("score", false).Size(limit).Do(ctx)
+	if elastic.IsNotFound(err) {
+		// Nothing was ever detected
+		return []*Highlight{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	highlights := []*Highlight{}
+	for _, hit := range sr.Hits.Hits {
+		h := new(Highlight)
+		if err := json.Unmarshal(hit.Source, h); err != nil {
+			return nil, err
+		}
+		highlights = append(highlights, h)
+	}
+	return highlights, nil
+}
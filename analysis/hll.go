@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision gives 2^14 registers, a standard error of about 0.8%.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct strings added in fixed memory.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(value string) {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	x := mix(f.Sum64())
+
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// estimate returns the estimated cardinality of the union of sketches.
+func estimate(sketches ...*hyperLogLog) float64 {
+	m := float64(int(1) << hllPrecision)
+	sum, zeros := 0.0, 0
+	for i := range sketches[0].registers {
+		r := uint8(0)
+		for _, h := range sketches {
+			if h.registers[i] > r {
+				r = h.registers[i]
+			}
+		}
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small sets
+		e = m * math.Log(m/float64(zeros))
+	}
+	return e
+}
+
+// mix spreads the bits of FNV hashes of short, similar strings.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
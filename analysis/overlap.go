@@ -0,0 +1,321 @@
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/graph"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/olivere/elastic/v7"
+)
+
+// OverlapIndex holds the related channels of every channel.
+const OverlapIndex = "overlap"
+
+const overlapMapping = `
+{
+	"mappings":{
+		"properties":{
+			"channel":{
+				"type":"keyword"
+			},
+			"from":{
+				"type":"date"
+			},
+			"to":{
+				"type":"date"
+			},
+			"related":{
+				"type":"object",
+				"enabled":false
+			},
+			"computed_at":{
+				"type":"date"
+			}
+		}
+	}
+}`
+
+// DefaultIgnoredChatters are bots chatting in most channels, they would relate every channel to every other.
+var DefaultIgnoredChatters = []string{"nightbot", "streamelements", "streamlabs", "moobot", "fossabot", "wizebot", "soundalerts"}
+
+// RelatedChannel is a channel sharing chatters with another.
+type RelatedChannel struct {
+	Channel  string `json:"channel"`
+	Chatters int64  `json:"chatters"`
+	Shared   int64  `json:"shared"`
+	// Jaccard is the shared chatters over the chatters of either channel
+	Jaccard float64 `json:"jaccard"`
+}
+
+// Overlap lists the channels sharing the most chatters with Channel between From and To.
+type Overlap struct {
+	Channel     string            `json:"channel"`
+	Chatters    int64             `json:"chatters"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Approximate bool              `json:"approximate"`
+	Related     []*RelatedChannel `json:"related"`
+	ComputedAt  time.Time         `json:"computed_at"`
+}
+
+// Overlapper computes the chatter overlap between channels. Chatter sets are
+// exact, or HyperLogLog sketches with Approximate, which keeps memory fixed
+// per channel at the cost of about 1% error.
+type Overlapper struct {
+	Approximate bool
+	// MinShared is the number of chatters channels must share to be related
+	MinShared int64
+	// Top is the number of related channels kept per channel
+	Top int
+	// Ignore are chatters left out of every set
+	Ignore []string
+
+	connector *config.ElasticConnector
+}
+
+// NewOverlapper creates an overlapper using exact sets, keeping the top 25 related channels.
+func NewOverlapper(connector *config.ElasticConnector) (*Overlapper, error) {
+	if err := connector.EnsureIndex(OverlapIndex, overlapMapping); err != nil {
+		return nil, err
+	}
+
+	return &Overlapper{
+		MinShared: 5,
+		Top:       25,
+		Ignore:    DefaultIgnoredChatters,
+		connector: connector,
+	}, nil
+}
+
+// chatterSets collects the chatters of channels between from and to.
+type chatterSets struct {
+	channels []string
+	index    map[string]int
+	counts   []int64
+	// users maps every chatter to the channels they chatted in, for exact sets
+	users map[string][]int
+	// sketches are the per channel HyperLogLogs of approximate sets
+	sketches []*hyperLogLog
+}
+
+func (s *chatterSets) add(channel, user string, approximate bool) {
+	i, ok := s.index[channel]
+	if !ok {
+		i = len(s.channels)
+		s.index[channel] = i
+		s.channels = append(s.channels, channel)
+		s.counts = append(s.counts, 0)
+		if approximate {
+			s.sketches = append(s.sketches, newHyperLogLog())
+		}
+	}
+
+	if approximate {
+		s.sketches[i].add(user)
+		return
+	}
+	s.counts[i]++
+	s.users[user] = append(s.users[user], i)
+}
+
+// Compute returns the overlap of every channel with messages between from and
+// to, or of channels only when given.
+func (o *Overlapper) Compute(ctx context.Context, channels []string, from, to time.Time) ([]*Overlap, error) {
+	sets, err := o.collect(ctx, channels, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(sets.channels)
+	related := make([][]*RelatedChannel, n)
+	relate := func(a, b int, shared int64, union float64) {
+		if shared < o.MinShared || union <= 0 {
+			return
+		}
+		jaccard := float64(shared) / union
+		related[a] = append(related[a], &RelatedChannel{Channel: sets.channels[b], Chatters: sets.counts[b], Shared: shared, Jaccard: jaccard})
+		related[b] = append(related[b], &RelatedChannel{Channel: sets.channels[a], Chatters: sets.counts[a], Shared: shared, Jaccard: jaccard})
+	}
+
+	if o.Approximate {
+		for i, sketch := range sets.sketches {
+			sets.counts[i] = int64(estimate(sketch) + 0.5)
+		}
+		for a := 0; a < n; a++ {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			for b := a + 1; b < n; b++ {
+				union := estimate(sets.sketches[a], sets.sketches[b])
+				shared := int64(float64(sets.counts[a]+sets.counts[b]) - union + 0.5)
+				relate(a, b, shared, union)
+			}
+		}
+	} else {
+		shared := map[[2]int]int64{}
+		for _, in := range sets.users {
+			for x, a := range in {
+				for _, b := range in[x+1:] {
+					shared[[2]int{a, b}]++
+				}
+			}
+		}
+		for pair, count := range shared {
+			a, b := pair[0], pair[1]
+			relate(a, b, count, float64(sets.counts[a]+sets.counts[b]-count))
+		}
+	}
+
+	now := time.Now().UTC()
+	overlaps := make([]*Overlap, n)
+	for i, channel := range sets.channels {
+		r := related[i]
+		sort.Slice(r, func(x, y int) bool {
+			if r[x].Jaccard != r[y].Jaccard {
+				return r[x].Jaccard > r[y].Jaccard
+			}
+			return r[x].Channel < r[y].Channel
+		})
+		if len(r) > o.Top {
+			r = r[:o.Top]
+		}
+		if r == nil {
+			r = []*RelatedChannel{}
+		}
+
+		overlaps[i] = &Overlap{
+			Channel:     channel,
+			Chatters:    sets.counts[i],
+			From:        from,
+			To:          to,
+			Approximate: o.Approximate,
+			Related:     r,
+			ComputedAt:  now,
+		}
+	}
+	sort.Slice(overlaps, func(x, y int) bool { return overlaps[x].Channel < overlaps[y].Channel })
+	return overlaps, nil
+}
+
+// collect pages through every distinct channel and chatter pair.
+func (o *Overlapper) collect(ctx context.Context, channels []string, from, to time.Time) (*chatterSets, error) {
+	q := elastic.NewBoolQuery().
+		Filter(elastic.NewRangeQuery("Timestamp").Gte(from).Lt(to)).
+		MustNot(elastic.NewTermsQuery("Type", irc.TypeBan, irc.TypeTimeout, irc.TypeClearChat, irc.TypeDelete))
+	if len(channels) > 0 {
+		values := make([]interface{}, len(channels))
+		for i, ch := range channels {
+			values[i] = "#" + strings.TrimPrefix(strings.ToLower(ch), "#")
+		}
+		q = q.Filter(elastic.NewTermsQuery("Channel.keyword", values...))
+	}
+
+	ignored := map[string]bool{}
+	for _, u := range o.Ignore {
+		ignored[strings.ToLower(u)] = true
+	}
+
+	sets := &chatterSets{index: map[string]int{}, users: map[string][]int{}}
+	var after map[string]interface{}
+	for {
+		pairs := elastic.NewCompositeAggregation().Size(10000).Sources(
+			elastic.NewCompositeAggregationTermsValuesSource("channel").Field("Channel.keyword"),
+			elastic.NewCompositeAggregationTermsValuesSource("user").Field("User.keyword"),
+		)
+		if after != nil {
+			pairs = pairs.AggregateAfter(after)
+		}
+
+		sr, err := o.connector.GetClient().Search().Index("twitch").Query(q).Size(0).Aggregation("pairs", pairs).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		agg, ok := sr.Aggregations.Composite("pairs")
+		if !ok || len(agg.Buckets) == 0 {
+			return sets, nil
+		}
+		for _, b := range agg.Buckets {
+			channel := strings.TrimPrefix(fmt.Sprint(b.Key["channel"]), "#")
+			user := fmt.Sprint(b.Key["user"])
+			if ignored[user] {
+				continue
+			}
+			sets.add(channel, user, o.Approximate)
+		}
+		after = agg.AfterKey
+	}
+}
+
+// Save stores overlaps, replacing the previous results of their channels.
+func (o *Overlapper) Save(ctx context.Context, overlaps []*Overlap) error {
+	if len(overlaps) == 0 {
+		return nil
+	}
+
+	bulk := o.connector.GetClient().Bulk().Index(OverlapIndex)
+	for _, ov := range overlaps {
+		bulk.Add(elastic.NewBulkIndexRequest().Id(ov.Channel).Doc(ov))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("could not store %d overlaps: %s", len(failed), failed[0].Error.Reason)
+	}
+	return nil
+}
+
+// FindOverlap returns the stored overlap of channel, ok is false when it was never computed.
+func FindOverlap(ctx context.Context, client *elastic.Client, channel string) (overlap *Overlap, ok bool, err error) {
+	res, err := client.Get().Index(OverlapIndex).Id(strings.TrimPrefix(strings.ToLower(channel), "#")).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	overlap = new(Overlap)
+	if err := json.Unmarshal(res.Source, overlap); err != nil {
+		return nil, false, err
+	}
+	return overlap, true, nil
+}
+
+// OverlapGraph returns the channels as nodes weighted by chatters, connected
+// by edges weighted by their Jaccard index.
+func OverlapGraph(overlaps []*Overlap) *graph.Graph {
+	g := graph.New(false)
+	for _, ov := range overlaps {
+		g.Node(ov.Channel).Attrs["chatters"] = ov.Chatters
+	}
+
+	seen := map[[2]string]bool{}
+	for _, ov := range overlaps {
+		for _, r := range ov.Related {
+			pair := [2]string{ov.Channel, r.Channel}
+			if pair[1] < pair[0] {
+				pair[0], pair[1] = pair[1], pair[0]
+			}
+			if seen[pair] {
+				continue
+			}
+			seen[pair] = true
+
+			g.Node(r.Channel).Attrs["chatters"] = r.Chatters
+			g.Connect(pair[0], pair[1], map[string]interface{}{
+				"weight": r.Jaccard,
+				"shared": r.Shared,
+			})
+		}
+	}
+	return g
+}
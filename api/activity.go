@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/julienschmidt/httprouter"
+	"github.com/olivere/elastic/v7"
+)
+
+// ActivityPath is the path to the chat activity time series of one or more streams.
+const ActivityPath = StreamPath + "/:name/activity"
+
+// maxActivityBuckets limits the number of buckets per channel of an activity request
+const maxActivityBuckets = 5000
+
+// ActivityBucket is the chat activity of a stream in one interval.
+type ActivityBucket struct {
+	Time      time.Time `json:"time"`
+	Messages  int64     `json:"messages"`
+	Chatters  int64     `json:"chatters"`
+	Subs      int64     `json:"subs"`
+	BitEvents int64     `json:"bit_events"`
+	Bits      int64     `json:"bits"`
+}
+
+// ChannelActivity is the activity time series of one stream.
+type ChannelActivity struct {
+	ChannelName string            `json:"channel_name"`
+	Buckets     []*ActivityBucket `json:"buckets"`
+}
+
+// StreamActivityResponse holds a time series per requested stream, all with the same buckets.
+type StreamActivityResponse struct {
+	Interval string             `json:"interval"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Channels []*ChannelActivity `json:"channels"`
+}
+
+// StreamActivity returns the number of messages, unique chatters, subs and
+// cheers per interval. The interval takes d and w for days and weeks, weeks
+// start on mondays. Several streams can be compared by passing a comma
+// separated name or a compare parameter.
+//
+// swagger:route GET /api/streams/{name}/activity streams getStreamActivity
+//
+// Get chat activity of streams over time
+func (h *Handler) StreamActivity(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	channels := listParam(url.Values{"name": {ps.ByName("name")}}, "name")
+	for _, ch := range listParam(queryValues, "compare") {
+		if !contains(channels, ch) {
+			channels = append(channels, ch)
+		}
+	}
+	for i, ch := range channels {
+		channels[i] = strings.ToLower(strings.TrimPrefix(ch, "#"))
+	}
+
+	interval := time.Minute
+	if v := queryValues.Get("interval"); v != "" {
+		var err error
+		if interval, err = parseInterval(v); err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		if interval < time.Second {
+			h.R.Text(rw, http.StatusBadRequest, "interval must be at least 1s")
+			return
+		}
+	}
+
+	from, to, err := timeRange(queryValues, 24*time.Hour)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !to.After(from) {
+		h.R.Text(rw, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from)/interval > maxActivityBuckets {
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("the range holds more than %d intervals, use a larger interval", maxActivityBuckets))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 10*time.Second)
+	defer cancel()
+
+	resp, err := findActivity(ctx, h.E.GetClient(), channels, from, to, interval)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, resp)
+}
+
+// findActivity runs a date histogram per channel with a sub aggregation for every bucket field.
+func findActivity(ctx context.Context, client *elastic.Client, channels []string, from, to time.Time, interval time.Duration) (*StreamActivityResponse, error) {
+	from, offset := histogramStart(from, interval)
+	histogram := elastic.NewDateHistogramAggregation().
+		Field("Timestamp").
+		Interval(fmt.Sprintf("%dms", interval/time.Millisecond)).
+		Offset(offset).
+		MinDocCount(0).
+		ExtendedBounds(from, to).
+		SubAggregation("messages", elastic.NewFilterAggregation().
+			Filter(NewFinder().Types(irc.TypeMessage, irc.TypeAction).Filter()).
+			SubAggregation("chatters", elastic.NewCardinalityAggregation().Field("User.keyword"))).
+		SubAggregation("subs", elastic.NewFilterAggregation().
+			Filter(NewFinder().Types(irc.SubTypes...).Filter())).
+		SubAggregation("cheers", elastic.NewFilterAggregation().
+			Filter(NewFinder().HasBits(true).Filter()).
+			SubAggregation("bits", elastic.NewSumAggregation().Field("Bits")))
+
+	agg := elastic.NewTermsAggregation().
+		Field("Channel.keyword").
+		Size(len(channels)).
+		SubAggregation("activity", histogram)
+
+	sr, err := client.Search().Index("twitch").
+		Query(NewFinder().Channels(channels...).Between(from, to).Filter()).
+		Size(0).
+		Aggregation("channels", agg).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]*ChannelActivity{}
+	if terms, ok := sr.Aggregations.Terms("channels"); ok {
+		for _, bucket := range terms.Buckets {
+			name := strings.TrimPrefix(bucket.Key.(string), "#")
+			found[name] = &ChannelActivity{ChannelName: name, Buckets: activityBuckets(bucket.Aggregations)}
+		}
+	}
+
+	resp := &StreamActivityResponse{
+		Interval: interval.String(),
+		From:     from,
+		To:       to,
+	}
+	for _, ch := range channels {
+		activity, ok := found[ch]
+		if !ok {
+			// Channels without a single message in the range still get their empty buckets
+			activity = &ChannelActivity{ChannelName: ch, Buckets: emptyBuckets(from, to, interval)}
+		}
+		resp.Channels = append(resp.Channels, activity)
+	}
+	return resp, nil
+}
+
+func activityBuckets(aggs elastic.Aggregations) []*ActivityBucket {
+	buckets := []*ActivityBucket{}
+	histogram, ok := aggs.DateHistogram("activity")
+	if !ok {
+		return buckets
+	}
+
+	for _, b := range histogram.Buckets {
+		bucket := &ActivityBucket{Time: time.Unix(0, int64(b.Key)*int64(time.Millisecond)).UTC()}
+		if messages, ok := b.Filter("messages"); ok {
+			bucket.Messages = messages.DocCount
+			if chatters, ok := messages.Cardinality("chatters"); ok && chatters.Value != nil {
+				bucket.Chatters = int64(*chatters.Value)
+			}
+		}
+		if subs, ok := b.Filter("subs"); ok {
+			bucket.Subs = subs.DocCount
+		}
+		if cheers, ok := b.Filter("cheers"); ok {
+			bucket.BitEvents = cheers.DocCount
+			if bits, ok := cheers.Sum("bits"); ok && bits.Value != nil {
+				bucket.Bits = int64(*bits.Value)
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+func emptyBuckets(from, to time.Time, interval time.Duration) []*ActivityBucket {
+	buckets := []*ActivityBucket{}
+	for t := from; !t.After(to); t = t.Add(interval) {
+		buckets = append(buckets, &ActivityBucket{Time: t})
+	}
+	return buckets
+}
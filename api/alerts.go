@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/alert"
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// AlertRulesPath is the path of the alert rules.
+	AlertRulesPath = "/api/alerts/rules"
+	// AlertRulePath is the path of one alert rule.
+	AlertRulePath = AlertRulesPath + "/:id"
+)
+
+// AlertRulesResponse lists the alert rules. Secrets are never returned.
+type AlertRulesResponse struct {
+	Rules []alert.Rule `json:"rules"`
+}
+
+// ListAlertRules returns the rules of the config file and the API.
+//
+// swagger:route GET /api/alerts/rules alerts listAlertRules
+//
+// List alert rules
+func (h *Handler) ListAlertRules(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.authorizeAlerts(rw, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	stored, err := h.Alerts.List(ctx)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := AlertRulesResponse{Rules: []alert.Rule{}}
+	for _, rule := range append(append([]alert.Rule{}, h.AlertRules...), stored...) {
+		resp.Rules = append(resp.Rules, rule.Redacted())
+	}
+	h.R.JSON(rw, http.StatusOK, &resp)
+}
+
+// GetAlertRule returns one rule.
+//
+// swagger:route GET /api/alerts/rules/{id} alerts getAlertRule
+//
+// Get an alert rule
+func (h *Handler) GetAlertRule(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !h.authorizeAlerts(rw, r) {
+		return
+	}
+
+	id := ps.ByName("id")
+	if rule, ok := h.configAlertRule(id); ok {
+		h.R.JSON(rw, http.StatusOK, rule.Redacted())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	rule, ok, err := h.Alerts.Get(ctx, id)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("alert rule %s does not exist", id))
+		return
+	}
+	h.R.JSON(rw, http.StatusOK, rule.Redacted())
+}
+
+// CreateAlertRule stores a new rule, an id is generated when the body has none.
+// Bots pick it up within ALERT_RELOAD_INTERVAL.
+//
+// swagger:route POST /api/alerts/rules alerts createAlertRule
+//
+// Create an alert rule
+func (h *Handler) CreateAlertRule(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !h.authorizeAlerts(rw, r) {
+		return
+	}
+
+	rule, ok := h.decodeAlertRule(rw, r)
+	if !ok {
+		return
+	}
+	if rule.ID == "" {
+		rule.ID = newAlertRuleID()
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	if _, exists := h.configAlertRule(rule.ID); exists {
+		h.R.Text(rw, http.StatusConflict, fmt.Sprintf("alert rule %s already exists", rule.ID))
+		return
+	}
+	_, exists, err := h.Alerts.Get(ctx, rule.ID)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if exists {
+		h.R.Text(rw, http.StatusConflict, fmt.Sprintf("alert rule %s already exists", rule.ID))
+		return
+	}
+
+	h.saveAlertRule(ctx, rw, rule, http.StatusCreated)
+}
+
+// UpdateAlertRule replaces a rule created through the API. The stored secret
+// is kept when the body has none.
+//
+// swagger:route PUT /api/alerts/rules/{id} alerts updateAlertRule
+//
+// Replace an alert rule
+func (h *Handler) UpdateAlertRule(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !h.authorizeAlerts(rw, r) {
+		return
+	}
+
+	id := ps.ByName("id")
+	if _, ok := h.configAlertRule(id); ok {
+		h.R.Text(rw, http.StatusConflict, fmt.Sprintf("alert rule %s is defined in the config file", id))
+		return
+	}
+
+	rule, ok := h.decodeAlertRule(rw, r)
+	if !ok {
+		return
+	}
+	if rule.ID != "" && rule.ID != id {
+		h.R.Text(rw, http.StatusBadRequest, "the id of a rule cannot be changed")
+		return
+	}
+	rule.ID = id
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	current, exists, err := h.Alerts.Get(ctx, id)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("alert rule %s does not exist", id))
+		return
+	}
+	if rule.Secret == "" {
+		rule.Secret = current.Secret
+	}
+
+	h.saveAlertRule(ctx, rw, rule, http.StatusOK)
+}
+
+// DeleteAlertRule deletes a rule created through the API.
+//
+// swagger:route DELETE /api/alerts/rules/{id} alerts deleteAlertRule
+//
+// Delete an alert rule
+func (h *Handler) DeleteAlertRule(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if !h.authorizeAlerts(rw, r) {
+		return
+	}
+
+	id := ps.ByName("id")
+	if _, ok := h.configAlertRule(id); ok {
+		h.R.Text(rw, http.StatusConflict, fmt.Sprintf("alert rule %s is defined in the config file", id))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := h.Alerts.Delete(ctx, id)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("alert rule %s does not exist", id))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeAlerts checks that the request was made with an admin API key.
+// Rules send webhooks to arbitrary urls, so they can't be managed without one.
+func (h *Handler) authorizeAlerts(rw http.ResponseWriter, r *http.Request) bool {
+	if h.Alerts == nil {
+		h.R.Text(rw, http.StatusForbidden, "alert rules can't be managed through the api")
+		return false
+	}
+	if !apikey.FromContext(r.Context()).Allows(apikey.ScopeAdmin) {
+		h.R.Text(rw, http.StatusForbidden, "managing alert rules requires an API key with the admin scope")
+		return false
+	}
+	return true
+}
+
+func (h *Handler) configAlertRule(id string) (alert.Rule, bool) {
+	for _, rule := range h.AlertRules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return alert.Rule{}, false
+}
+
+func (h *Handler) decodeAlertRule(rw http.ResponseWriter, r *http.Request) (rule alert.Rule, ok bool) {
+	dec := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 64*1024))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rule); err != nil {
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("invalid rule: %s", err))
+		return rule, false
+	}
+	rule.Source = alert.SourceAPI
+	return rule, true
+}
+
+func (h *Handler) saveAlertRule(ctx context.Context, rw http.ResponseWriter, rule alert.Rule, status int) {
+	if err := rule.Validate(); err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.Alerts.Put(ctx, rule); err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.R.JSON(rw, status, rule.Redacted())
+}
+
+func newAlertRuleID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
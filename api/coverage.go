@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/coverage"
+	"github.com/julienschmidt/httprouter"
+)
+
+// CoveragePath is the path to a stream's logged and unlogged intervals.
+const CoveragePath = StreamPath + "/:name/coverage"
+
+// StreamCoverageResponse tells which parts of a time range a stream was logged in.
+type StreamCoverageResponse struct {
+	ChannelName string `json:"channel_name"`
+	*coverage.Report
+}
+
+// StreamCoverage returns the intervals in which the stream was and wasn't logged,
+// so an empty time range can be told apart from missing data.
+//
+// swagger:route GET /api/streams/{name}/coverage streams getStreamCoverage
+//
+// Get logging coverage of a stream
+func (h *Handler) StreamCoverage(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	channelName := ps.ByName("name")
+	from, to, err := timeRange(r.URL.Query(), 24*time.Hour)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !to.After(from) {
+		h.R.Text(rw, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	report, err := coverage.Find(ctx, h.E.GetClient(), fmt.Sprintf("#%s", channelName), from, to, coverage.StaleAfter)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, &StreamCoverageResponse{
+		ChannelName: channelName,
+		Report:      report,
+	})
+}
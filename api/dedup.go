@@ -0,0 +1,56 @@
+package api
+
+import (
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+)
+
+// Dedupe drops messages that were logged more than once by redundant workers.
+// Messages carrying a twitch message id already share a document, this catches
+// the remaining copies whose timestamps fell into neighbouring dedup windows,
+// matching them like irc.Message.Duplicates does. messages must be sorted by
+// timestamp, in either direction.
+func Dedupe(messages []*Message, window time.Duration) []*Message {
+	if window <= 0 || len(messages) < 2 {
+		return messages
+	}
+
+	kept := messages[:0]
+	for _, m := range messages {
+		duplicate := false
+		for i := len(kept) - 1; i >= 0; i-- {
+			prev := kept[i]
+			if abs(m.Timestamp.Sub(prev.Timestamp)) > window {
+				break
+			}
+			if dedupKey(prev).Duplicates(dedupKey(m), window) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// dedupKey returns the fields of m irc.Message.Duplicates compares.
+func dedupKey(m *Message) irc.Message {
+	return irc.Message{
+		ID:        irc.TwitchID(m.ID),
+		Type:      m.Type,
+		Channel:   m.Channel,
+		User:      m.User,
+		Message:   m.Message,
+		Timestamp: m.Timestamp,
+	}
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// EmotesPath is the path of the top emotes over all messages.
+	EmotesPath = "/api/emotes"
+	// EmoteUsagePath is the path of an emote's usage over time.
+	EmoteUsagePath = EmotesPath + "/:emote/usage"
+	// StreamEmotesPath is the path of a stream's top emotes.
+	StreamEmotesPath = StreamPath + "/:name/emotes"
+	// UserEmotesPath is the path of a user's top emotes.
+	UserEmotesPath = UserPath + "/:name/emotes"
+)
+
+// EmoteCount is how often an emote was used. Messages using an emote several times count once.
+type EmoteCount struct {
+	Name        string `json:"name"`
+	NumMessages int64  `json:"num_messages"`
+	NumUsers    int64  `json:"num_users"`
+}
+
+// EmotesResponse lists the most used emotes.
+type EmotesResponse struct {
+	ChannelName string        `json:"channel_name,omitempty"`
+	UserName    string        `json:"user_name,omitempty"`
+	Emotes      []*EmoteCount `json:"emotes"`
+}
+
+// EmoteUsageBucket is the usage of an emote in one interval.
+type EmoteUsageBucket struct {
+	Time        time.Time `json:"time"`
+	NumMessages int64     `json:"num_messages"`
+	NumUsers    int64     `json:"num_users"`
+}
+
+// EmoteUsageResponse is the usage of an emote over time.
+type EmoteUsageResponse struct {
+	Emote    string              `json:"emote"`
+	Interval string              `json:"interval"`
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Buckets  []*EmoteUsageBucket `json:"buckets"`
+}
+
+// ListEmotes returns the most used emotes, filtered like Search.
+//
+// swagger:route GET /api/emotes emotes listEmotes
+//
+// List top emotes
+func (h *Handler) ListEmotes(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.topEmotes(rw, r, finder, &EmotesResponse{})
+}
+
+// StreamEmotes returns the most used emotes of a stream between from and to.
+//
+// swagger:route GET /api/streams/{name}/emotes streams listStreamEmotes
+//
+// List top emotes of a stream
+func (h *Handler) StreamEmotes(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := ps.ByName("name")
+	h.topEmotes(rw, r, finder.Channels(name), &EmotesResponse{ChannelName: name})
+}
+
+// UserEmotes returns the emotes a user used most, filtered by channel, from and to.
+//
+// swagger:route GET /api/users/{name}/emotes users listUserEmotes
+//
+// List top emotes of a user
+func (h *Handler) UserEmotes(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	at, err := atParam(r.URL.Query())
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	login := strings.ToLower(ps.ByName("name"))
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+	userID, err := ResolveUserID(ctx, h.E.GetClient(), login, at)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	legacy, err := LegacyLogin(ctx, h.E.GetClient(), userID, login)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.topEmotes(rw, r, finder.Account(userID, legacy), &EmotesResponse{UserName: login})
+}
+
+func (h *Handler) topEmotes(rw http.ResponseWriter, r *http.Request, finder *Finder, resp *EmotesResponse) {
+	limit, err := intParam(r.URL.Query(), "limit", 25, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	agg := elastic.NewTermsAggregation().Field("Emotes").Size(limit).
+		SubAggregation("users", elastic.NewCardinalityAggregation().Field("User.keyword"))
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 10*time.Second)
+	defer cancel()
+
+	sr, err := h.E.GetClient().Search().Index("twitch").
+		Query(finder.Filter()).
+		Size(0).
+		Aggregation("emotes", agg).
+		Do(ctx)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp.Emotes = []*EmoteCount{}
+	if terms, ok := sr.Aggregations.Terms("emotes"); ok {
+		for _, bucket := range terms.Buckets {
+			emote := &EmoteCount{
+				Name:        bucket.Key.(string),
+				NumMessages: bucket.DocCount,
+			}
+			if users, ok := bucket.Cardinality("users"); ok && users.Value != nil {
+				emote.NumUsers = int64(*users.Value)
+			}
+			resp.Emotes = append(resp.Emotes, emote)
+		}
+	}
+
+	h.R.JSON(rw, http.StatusOK, resp)
+}
+
+// EmoteUsage returns how many messages used an emote per interval, filtered like Search.
+//
+// swagger:route GET /api/emotes/{emote}/usage emotes getEmoteUsage
+//
+// Get usage of an emote over time
+func (h *Handler) EmoteUsage(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	emote := ps.ByName("emote")
+
+	interval := time.Hour
+	if v := queryValues.Get("interval"); v != "" {
+		var err error
+		if interval, err = parseInterval(v); err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		if interval < time.Second {
+			h.R.Text(rw, http.StatusBadRequest, "interval must be at least 1s")
+			return
+		}
+	}
+
+	from, to, err := timeRange(queryValues, 7*24*time.Hour)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !to.After(from) {
+		h.R.Text(rw, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from)/interval > maxActivityBuckets {
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("the range holds more than %d intervals, use a larger interval", maxActivityBuckets))
+		return
+	}
+	from, offset := histogramStart(from, interval)
+
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := finder.Between(from, to).Filter().Filter(elastic.NewTermQuery("Emotes", emote))
+
+	histogram := elastic.NewDateHistogramAggregation().
+		Field("Timestamp").
+		Interval(fmt.Sprintf("%dms", interval/time.Millisecond)).
+		Offset(offset).
+		MinDocCount(0).
+		ExtendedBounds(from, to).
+		SubAggregation("users", elastic.NewCardinalityAggregation().Field("User.keyword"))
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 10*time.Second)
+	defer cancel()
+
+	sr, err := h.E.GetClient().Search().Index("twitch").
+		Query(query).
+		Size(0).
+		Aggregation("usage", histogram).
+		Do(ctx)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := EmoteUsageResponse{
+		Emote:    emote,
+		Interval: interval.String(),
+		From:     from,
+		To:       to,
+		Buckets:  []*EmoteUsageBucket{},
+	}
+	if usage, ok := sr.Aggregations.DateHistogram("usage"); ok {
+		for _, b := range usage.Buckets {
+			bucket := &EmoteUsageBucket{
+				Time:        time.Unix(0, int64(b.Key)*int64(time.Millisecond)).UTC(),
+				NumMessages: b.DocCount,
+			}
+			if users, ok := b.Cardinality("users"); ok && users.Value != nil {
+				bucket.NumUsers = int64(*users.Value)
+			}
+			resp.Buckets = append(resp.Buckets, bucket)
+		}
+	}
+
+	h.R.JSON(rw, http.StatusOK, &resp)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/export"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ExportPath is the path of the streaming log export.
+const ExportPath = "/api/export"
+
+// responseStream flushes to the client whenever the exporter finished a batch.
+type responseStream struct {
+	rw http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func (s *responseStream) Write(p []byte) (int, error) {
+	if s.gz != nil {
+		return s.gz.Write(p)
+	}
+	return s.rw.Write(p)
+}
+
+func (s *responseStream) Flush() error {
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if f, ok := s.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Export streams the logs of a channel or user in the text, csv or ndjson
+// format, filtered like Search. A whole UTC day can be selected with date. The response is gzip compressed for clients
+// accepting it and is never buffered as a whole.
+//
+// swagger:route GET /api/export export exportMessages
+//
+// Export logs
+func (h *Handler) Export(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	queryValues := r.URL.Query()
+	format := queryValues.Get("format")
+	if format == "" {
+		format = export.Text
+	}
+	if !contains(export.Formats, format) {
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("format must be one of %s", strings.Join(export.Formats, ", ")))
+		return
+	}
+
+	channels := listParam(queryValues, "channel")
+	users := listParam(queryValues, "user")
+	if len(channels) == 0 && len(users) == 0 {
+		h.R.Text(rw, http.StatusBadRequest, "export needs at least a channel or a user")
+		return
+	}
+
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := queryValues.Get("date"); v != "" {
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		finder = finder.Day(day)
+	}
+
+	// Large exports take longer than the server's write timeout
+	keepStreaming(r)
+
+	name := strings.Join(append(channels, users...), "_")
+	rw.Header().Set("Content-Type", export.ContentType(format))
+	rw.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, export.Extension(format)))
+	rw.Header().Set("Vary", "Accept-Encoding")
+
+	stream := &responseStream{rw: rw}
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		rw.Header().Set("Content-Encoding", "gzip")
+		stream.gz = gzip.NewWriter(rw)
+	}
+
+	w, err := export.NewWriter(format, stream)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	n, err := export.Export(r.Context(), h.E.GetClient(), finder.Filter(), w, h.DedupWindow)
+	if err != nil && n == 0 {
+		// Nothing was flushed yet, so the status can still be changed
+		rw.Header().Del("Content-Encoding")
+		rw.Header().Del("Content-Disposition")
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err != nil {
+		// Headers are gone with the first batch, all that's left is cutting the export short
+		h.L.WithError(err).Warnf("Export of %s was aborted after %d messages", name, n)
+	}
+
+	if stream.gz != nil {
+		stream.gz.Close()
+	}
+}
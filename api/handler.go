@@ -6,13 +6,19 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/djdduty/ttv-log/alert"
+	"github.com/djdduty/ttv-log/apikey"
 	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/directory"
+	"github.com/djdduty/ttv-log/live"
 	"github.com/julienschmidt/httprouter"
 	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
 	"github.com/unrolled/render"
 )
 
@@ -29,13 +35,24 @@ const (
 type Handler struct {
 	R *render.Render
 	E *config.ElasticConnector
+	L logrus.FieldLogger
+
+	// DedupWindow is the window in which identical messages are treated as duplicates
+	DedupWindow time.Duration
+	// Live feeds the live tail, it is disabled when nil
+	Live *live.Broker
+	// Alerts stores the alert rules managed through the API with admin keys.
+	// AlertRules are the read-only rules of the config file.
+	Alerts     *alert.Store
+	AlertRules []alert.Rule
 }
 
 // NewHandler instantiates a handler.
-func NewHandler(r *render.Render, e *config.ElasticConnector) *Handler {
+func NewHandler(r *render.Render, e *config.ElasticConnector, l logrus.FieldLogger) *Handler {
 	return &Handler{
 		R: r,
 		E: e,
+		L: l,
 	}
 }
 
@@ -44,13 +61,42 @@ func (h *Handler) SetRoutes(r *httprouter.Router) {
 	r.GET(StreamPath, h.ListStreams)
 	r.GET(UserPath, h.ListUsers)
 	r.GET(MessagePath, h.ListMessages)
+	r.GET(MessageContextPath, h.MessageContext)
+	r.GET(CoveragePath, h.StreamCoverage)
+	r.GET(ActivityPath, h.StreamActivity)
+	r.GET(StreamEmotesPath, h.StreamEmotes)
+	r.GET(HighlightsPath, h.StreamHighlights)
+	r.GET(RelatedPath, h.RelatedStreams)
+	r.GET(RaidsPath, h.StreamRaids)
+	r.GET(TopRaidsPath, h.TopRaids)
+	r.GET(LivePath, h.StreamLive)
+	r.GET(SearchPath, h.Search)
+	r.GET(OpenAPIPath, h.GetOpenAPI)
+	r.GET(ExportPath, h.Export)
+	r.GET(UserDetailPath, h.GetUser)
+	r.GET(UserMessagesPath, h.ListUserMessages)
+	r.GET(AccountPath, h.GetAccount)
+	r.GET(UserEmotesPath, h.UserEmotes)
+	r.GET(EmotesPath, h.ListEmotes)
+	r.GET(EmoteUsagePath, h.EmoteUsage)
+	r.GET(CopypastaPath, h.ListCopypastas)
+	r.GET(SpamClustersPath, h.ListSpamClusters)
+	r.GET(AlertRulesPath, h.ListAlertRules)
+	r.POST(AlertRulesPath, h.CreateAlertRule)
+	r.GET(AlertRulePath, h.GetAlertRule)
+	r.PUT(AlertRulePath, h.UpdateAlertRule)
+	r.DELETE(AlertRulePath, h.DeleteAlertRule)
 }
 
 type healthStatus struct {
 	Status string `json:"status"`
 }
 
-// ListStreams ...
+// ListStreams returns the streams with the most logged messages.
+//
+// swagger:route GET /api/streams streams listStreams
+//
+// List logged streams
 func (h *Handler) ListStreams(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	queryValues := r.URL.Query()
 	limit, err := url.QueryUnescape(queryValues.Get("limit"))
@@ -63,7 +109,8 @@ func (h *Handler) ListStreams(rw http.ResponseWriter, r *http.Request, _ httprou
 	defer cancel()
 
 	search := client.Search().Index("twitch")
-	search = search.Query(elastic.NewBoolQuery()).Size(0)
+	q := NewFinder().ExcludeChannels(apikey.FromContext(r.Context()).Hidden()...).Filter()
+	search = search.Query(q).Size(0)
 	agg := elastic.NewTermsAggregation().Field("Channel.keyword").NumPartitions(1)
 	if limit != "" {
 		limit, err := strconv.Atoi(limit)
@@ -97,54 +144,132 @@ func (h *Handler) ListStreams(rw http.ResponseWriter, r *http.Request, _ httprou
 	h.R.JSON(rw, http.StatusOK, &channels)
 }
 
-// ListUsers ...
+// ListUsers returns the accounts with the most logged messages. Accounts are
+// counted by twitch user id, so renamed users are listed once under their
+// latest name. Messages logged before user ids were captured are counted by
+// login and added to the account whose name history contains that login.
+//
+// swagger:route GET /api/users users listUsers
+//
+// List the users with the most logged messages
 func (h *Handler) ListUsers(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	queryValues := r.URL.Query()
-	limit, err := url.QueryUnescape(queryValues.Get("limit"))
+	limit, err := intParam(r.URL.Query(), "limit", 10, 1000)
 	if err != nil {
 		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	client := h.E.GetClient()
 	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
 	defer cancel()
 
-	search := client.Search().Index("twitch")
-	search = search.Query(elastic.NewBoolQuery()).Size(0)
-	agg := elastic.NewTermsAggregation().Field("User.keyword")
-	if limit != "" {
-		limit, err := strconv.Atoi(limit)
-		if err != nil {
-			h.R.Text(rw, http.StatusBadRequest, err.Error())
+	latest := elastic.NewTopHitsAggregation().Size(1).Sort("Timestamp", false).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("User"))
+	accounts := elastic.NewTermsAggregation().Field("UserID").Size(limit).SubAggregation("latest", latest)
+	legacy := elastic.NewFilterAggregation().Filter(elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("UserID"))).
+		SubAggregation("logins", elastic.NewTermsAggregation().Field("User.keyword").Size(limit))
+
+	q := NewFinder().ExcludeChannels(apikey.FromContext(r.Context()).Hidden()...).Filter()
+	sr, err := client.Search().Index("twitch").Query(q).Size(0).
+		Aggregation("accounts", accounts).
+		Aggregation("legacy", legacy).
+		Do(ctx)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	users := []*UserCount{}
+	if agg, found := sr.Aggregations.Terms("accounts"); found {
+		for _, bucket := range agg.Buckets {
+			user := &UserCount{UserID: fmt.Sprint(bucket.Key), NumMessages: bucket.DocCount}
+			if hits, ok := bucket.TopHits("latest"); ok && len(hits.Hits.Hits) > 0 {
+				var m Message
+				if err := json.Unmarshal(hits.Hits.Hits[0].Source, &m); err == nil {
+					user.Name = m.User
+				}
+			}
+			users = append(users, user)
 		}
-		if limit > 1000 {
-			h.R.Text(rw, http.StatusBadRequest, "limit cannot exceed 1000")
+	}
+	if filter, found := sr.Aggregations.Filter("legacy"); found {
+		if agg, found := filter.Terms("logins"); found {
+			if users, err = foldLegacy(ctx, client, q, users, agg.Buckets); err != nil {
+				h.R.Text(rw, http.StatusInternalServerError, err.Error())
+				return
+			}
 		}
-		agg = agg.Size(limit)
 	}
-	search = search.Aggregation("users", agg)
 
-	sr, err := search.Do(ctx)
+	sort.SliceStable(users, func(i, j int) bool { return users[i].NumMessages > users[j].NumMessages })
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	h.R.JSON(rw, http.StatusOK, &users)
+}
+
+// foldLegacy adds the counts of logins logged before user ids were into the
+// accounts whose directory history contains them, so no user is listed twice.
+// Accounts that weren't among the top ones are counted in full. Logins that
+// no account in the directory used are listed on their own.
+func foldLegacy(ctx context.Context, client *elastic.Client, q elastic.Query, users []*UserCount, buckets []*elastic.AggregationBucketKeyItem) ([]*UserCount, error) {
+	logins := make([]string, 0, len(buckets))
+	for _, bucket := range buckets {
+		logins = append(logins, fmt.Sprint(bucket.Key))
+	}
+	owners, err := directory.Owners(ctx, client, logins)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	var users []*Channel
-	// Deserialize aggregations
-	if agg, found := sr.Aggregations.Terms("users"); found {
+	byID := map[string]*UserCount{}
+	for _, u := range users {
+		byID[u.UserID] = u
+	}
+	missing := []interface{}{}
+	for _, bucket := range buckets {
+		login := fmt.Sprint(bucket.Key)
+		owner, ok := owners[strings.ToLower(login)]
+		if !ok {
+			users = append(users, &UserCount{Name: login, NumMessages: bucket.DocCount})
+			continue
+		}
+		u, ok := byID[owner.UserID]
+		if !ok {
+			u = &UserCount{Name: owner.Login, UserID: owner.UserID}
+			byID[owner.UserID] = u
+			users = append(users, u)
+			missing = append(missing, owner.UserID)
+		}
+		u.NumMessages += bucket.DocCount
+	}
+	if len(missing) == 0 {
+		return users, nil
+	}
+
+	q = elastic.NewBoolQuery().Filter(q, elastic.NewTermsQuery("UserID", missing...))
+	sr, err := client.Search().Index("twitch").Query(q).Size(0).
+		Aggregation("accounts", elastic.NewTermsAggregation().Field("UserID").Size(len(missing))).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if agg, found := sr.Aggregations.Terms("accounts"); found {
 		for _, bucket := range agg.Buckets {
-			user := &Channel{
-				Name:        bucket.Key.(string),
-				NumMessages: bucket.DocCount,
+			if u, ok := byID[fmt.Sprint(bucket.Key)]; ok {
+				u.NumMessages += bucket.DocCount
 			}
-			users = append(users, user)
 		}
 	}
-
-	h.R.JSON(rw, http.StatusOK, &users)
+	return users, nil
 }
 
-// ListMessages ...
+// ListMessages returns a page of messages of a stream or matching the channel,
+// user, type, bits and time filters, paged with the after and before cursors.
+//
+// swagger:route GET /api/messages messages listMessages
+//
+// List messages
 func (h *Handler) ListMessages(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	queryValues := r.URL.Query()
 	limit, err := url.QueryUnescape(queryValues.Get("limit"))
@@ -171,20 +296,21 @@ func (h *Handler) ListMessages(rw http.ResponseWriter, r *http.Request, _ httpro
 		return
 	}
 
-	client := h.E.GetClient()
-	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
-	defer cancel()
+	order := queryValues.Get("order")
+	if order != "" && order != "asc" && order != "desc" {
+		h.R.Text(rw, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
 
-	search := client.Search().Index("twitch")
-	q := elastic.NewBoolQuery()
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
 	if channelName != "" {
-		q = q.Must(elastic.NewTermQuery("Channel.keyword", fmt.Sprintf("#%s", channelName)))
+		finder = finder.Channels(channelName)
 	}
 
-	search = search.Query(q)
-	search = search.Sort("Timestamp", false)
-	search = search.Sort("_id", false)
-
 	if limit != "" {
 		limit, err := strconv.ParseInt(limit, 10, 32)
 		if err != nil {
@@ -195,48 +321,45 @@ func (h *Handler) ListMessages(rw http.ResponseWriter, r *http.Request, _ httpro
 			h.R.Text(rw, http.StatusBadRequest, "limit cannot exceed 1000")
 			return
 		}
-		search = search.Size(int(limit))
+		finder = finder.Size(int(limit))
 	}
 
+	var after, before []interface{}
 	if afterTime != "" && afterID != "" {
 		_, err := strconv.ParseInt(afterTime, 10, 64)
 		if err != nil {
 			h.R.Text(rw, http.StatusBadRequest, err.Error())
 			return
 		}
-		search = search.SearchAfter(afterTime, afterID)
+		after = []interface{}{afterTime, afterID}
+	}
+	if cursor := queryValues.Get("after"); cursor != "" {
+		if after, err = DecodeCursor(cursor); err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if cursor := queryValues.Get("before"); cursor != "" {
+		if before, err = DecodeCursor(cursor); err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	sr, err := search.Do(ctx)
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	messages, err := findPage(ctx, h.E.GetClient(), finder, order == "asc", after, before)
 	if err != nil {
 		h.R.Text(rw, http.StatusInternalServerError, err.Error())
-		panic(err)
+		return
 	}
 
 	var resp StreamMessagesResponse
 	resp.ChannelName = channelName
-	var lastMessage *Message
-	if sr.TotalHits() > 0 {
-		for _, hit := range sr.Hits.Hits {
-			message := new(Message)
-			if err := json.Unmarshal(hit.Source, message); err != nil {
-				h.R.Text(rw, http.StatusInternalServerError, err.Error())
-				panic(err)
-			}
-			message.ID = hit.Id
-			lastMessage = message
-			resp.Messages = append(resp.Messages, message)
-		}
-
-		if lastMessage != nil {
-			queryValues.Set("after_timestamp", strconv.FormatInt(lastMessage.Timestamp.UnixNano()/int64(time.Millisecond), 10))
-			queryValues.Set("after_id", lastMessage.ID)
-			resp.Next = fmt.Sprintf(
-				"%s?%s",
-				r.URL.Path,
-				queryValues.Encode(),
-			)
-		}
+	if n := len(messages); n > 0 {
+		resp.Next, resp.Prev = pageLinks(r.URL.Path, queryValues, messages)
+		resp.Messages = Dedupe(messages, h.DedupWindow)
 	}
 
 	h.R.JSON(rw, http.StatusOK, &resp)
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/analysis"
+	"github.com/julienschmidt/httprouter"
+)
+
+// HighlightsPath is the path to the detected highlights of a stream.
+const HighlightsPath = StreamPath + "/:name/highlights"
+
+// StreamHighlightsResponse lists the highlights of a stream.
+type StreamHighlightsResponse struct {
+	ChannelName string                `json:"channel_name"`
+	Highlights  []*analysis.Highlight `json:"highlights"`
+}
+
+// StreamHighlights returns the bursts of chat activity detected by
+// "ttv-log analyze highlights" between from and to, highest score first.
+//
+// swagger:route GET /api/streams/{name}/highlights streams listStreamHighlights
+//
+// List highlight moments of a stream
+func (h *Handler) StreamHighlights(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	channelName := ps.ByName("name")
+
+	from, to, err := timeRange(queryValues, 7*24*time.Hour)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := intParam(queryValues, "limit", 25, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	highlights, err := analysis.FindHighlights(ctx, h.E.GetClient(), channelName, from, to, limit)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, &StreamHighlightsResponse{
+		ChannelName: channelName,
+		Highlights:  highlights,
+	})
+}
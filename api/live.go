@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/live"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+// LivePath is the path of a stream's live tail.
+const LivePath = StreamPath + "/:name/live"
+
+const (
+	liveBuffer    = 256
+	liveKeepAlive = 15 * time.Second
+	liveBacklog   = 1000
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// LiveEvent is pushed to live tail subscribers. Pass the cursor back to resume after it.
+type LiveEvent struct {
+	Cursor  string   `json:"cursor"`
+	Message *Message `json:"message"`
+}
+
+// StreamLive pushes a stream's messages and moderation events as they are
+// logged, as server-sent events or over a WebSocket when the request asks for
+// an upgrade. Filter with type and user. Reconnecting clients resume with the
+// cursor parameter or the Last-Event-ID header and first receive what they
+// missed, up to 1000 messages.
+//
+// swagger:route GET /api/streams/{name}/live streams streamLive
+//
+// Tail a stream live
+func (h *Handler) StreamLive(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if h.Live == nil {
+		h.R.Text(rw, http.StatusServiceUnavailable, "live tail is not enabled")
+		return
+	}
+
+	channelName := ps.ByName("name")
+	queryValues := r.URL.Query()
+	types := listParam(queryValues, "type")
+	users := listParam(queryValues, "user")
+
+	cursor := queryValues.Get("cursor")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+
+	// Subscribe before catching up so nothing falls between the backlog and the live events
+	sub := h.Live.Subscribe(fmt.Sprintf("#%s", channelName), liveBuffer)
+	defer sub.Close()
+
+	var backlog []*Message
+	if cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+		defer cancel()
+
+		finder := NewFinder().Channels(channelName).Types(types...).Users(users...).Size(liveBacklog)
+		if backlog, err = findPage(ctx, h.E.GetClient(), finder, true, after, nil); err != nil {
+			h.R.Text(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	f := &liveFilter{types: types, users: users, sent: map[string]bool{}}
+	for _, m := range backlog {
+		f.sent[m.ID] = true
+	}
+
+	keepStreaming(r)
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebSocket(rw, r, sub, backlog, f)
+		return
+	}
+	h.serveEvents(rw, r, sub, backlog, f)
+}
+
+// serveEvents streams server-sent events.
+func (h *Handler) serveEvents(rw http.ResponseWriter, r *http.Request, sub *live.Subscription, backlog []*Message, f *liveFilter) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		h.R.Text(rw, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+
+	send := func(m *Message) error {
+		data, err := json.Marshal(newLiveEvent(m))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(rw, "id: %s\nevent: message\ndata: %s\n\n", encodeCursor(m.sort), data)
+		return err
+	}
+
+	for _, m := range backlog {
+		if err := send(m); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			m := liveMessage(e)
+			if !f.match(m) {
+				continue
+			}
+			if err := send(m); err != nil {
+				return
+			}
+		case <-time.After(liveKeepAlive):
+			if _, err := fmt.Fprint(rw, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// serveWebSocket streams events as JSON text frames.
+func (h *Handler) serveWebSocket(rw http.ResponseWriter, r *http.Request, sub *live.Subscription, backlog []*Message, f *liveFilter) {
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		// Upgrade already replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// Clients don't send anything, reading is only needed to notice them leaving
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, m := range backlog {
+		if err := conn.WriteJSON(newLiveEvent(m)); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			m := liveMessage(e)
+			if !f.match(m) {
+				continue
+			}
+			if err := conn.WriteJSON(newLiveEvent(m)); err != nil {
+				return
+			}
+		case <-time.After(liveKeepAlive):
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+type liveFilter struct {
+	types []string
+	users []string
+	sent  map[string]bool
+}
+
+// match reports whether a live message passes the filters and wasn't already sent with the backlog.
+func (f *liveFilter) match(m *Message) bool {
+	if f.sent[m.ID] {
+		delete(f.sent, m.ID)
+		return false
+	}
+	if len(f.types) > 0 && !contains(f.types, m.Type) && !(m.Type == "" && contains(f.types, "message")) {
+		return false
+	}
+	if len(f.users) > 0 && !contains(f.users, m.User) {
+		return false
+	}
+	return true
+}
+
+func newLiveEvent(m *Message) *LiveEvent {
+	return &LiveEvent{Cursor: encodeCursor(m.sort), Message: m}
+}
+
+func liveMessage(e live.Event) *Message {
+	return &Message{
+		ID:        e.ID,
+		Timestamp: e.Message.Timestamp,
+		Message:   e.Message.Message,
+		Channel:   e.Message.Channel,
+		User:      e.Message.User,
+		UserID:    e.Message.UserID,
+		Type:      e.Message.Type,
+		Bits:      e.Message.Bits,
+		Emotes:    e.Message.Emotes,
+		sort:      []interface{}{e.Message.Timestamp.UnixNano() / int64(time.Millisecond), e.ID},
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
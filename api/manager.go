@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -15,28 +16,70 @@ type Channel struct {
 	NumMessages int64  `json:"num_messages_logged"`
 }
 
+// UserCount is the number of messages logged of a twitch account.
+type UserCount struct {
+	Name        string `json:"name"`
+	UserID      string `json:"user_id,omitempty"`
+	NumMessages int64  `json:"num_messages_logged"`
+}
+
 // Message represents a twitch chat message.
 type Message struct {
-	ID        string    `json:"Id"`
-	Timestamp time.Time `json:"Timestamp"`
-	Message   string    `json:"Message"`
-	Channel   string    `json:"Channel"`
-	User      string    `json:"User"`
+	ID         string    `json:"Id"`
+	Timestamp  time.Time `json:"Timestamp"`
+	Message    string    `json:"Message"`
+	Channel    string    `json:"Channel"`
+	User       string    `json:"User"`
+	UserID     string    `json:"UserID,omitempty"`
+	Type       string    `json:"Type,omitempty"`
+	Bits       int       `json:"Bits,omitempty"`
+	Emotes     []string  `json:"Emotes,omitempty"`
+	Highlights []string  `json:"Highlights,omitempty"`
+
+	sort []interface{}
 }
 
 // StreamMessagesResponse represents a stream with all it's messages
 type StreamMessagesResponse struct {
 	ChannelName string `json:"channel_name"`
 	Next        string `json:"next_page"`
+	Prev        string `json:"prev_page,omitempty"`
 	Messages    []*Message
 }
 
+// Text query modes supported by Finder.Text.
+const (
+	// MatchAll requires every word of the query to appear, in any order.
+	MatchAll = "match"
+	// MatchPhrase requires the words to appear in order.
+	MatchPhrase = "phrase"
+	// MatchPrefix is a phrase match where the last word may be incomplete.
+	MatchPrefix = "prefix"
+	// MatchFuzzy tolerates typos in every word.
+	MatchFuzzy = "fuzzy"
+)
+
 // Finder specifies a finder for messages.
 type Finder struct {
-	name       string
-	from, size int
-	sort       []string
-	pretty     bool
+	name        string
+	from, size  int
+	sort        []string
+	pretty      bool
+	text        string
+	mode        string
+	channels    []string
+	notChannels []string
+	users       []string
+	userID      string
+	login       string
+	types       []string
+	notTypes    []string
+	hasBits     bool
+	start, end  time.Time
+	endOpen     bool
+	searchAfter []interface{}
+	highlight   bool
+	aggregate   bool
 }
 
 // FinderResponse is the outcome of calling StreamFinder.Find.
@@ -83,18 +126,108 @@ func (f *Finder) Pretty(pretty bool) *Finder {
 	return f
 }
 
+// Text searches the message text using one of the Match modes.
+func (f *Finder) Text(text, mode string) *Finder {
+	f.text = text
+	f.mode = mode
+	return f
+}
+
+// Channels restricts the search to the given channel names, without the leading #.
+func (f *Finder) Channels(channels ...string) *Finder {
+	f.channels = append(f.channels, channels...)
+	return f
+}
+
+// ExcludeChannels leaves the given channels out of the search, without the leading #.
+func (f *Finder) ExcludeChannels(channels ...string) *Finder {
+	f.notChannels = append(f.notChannels, channels...)
+	return f
+}
+
+// Users restricts the search to messages of the given users.
+func (f *Finder) Users(users ...string) *Finder {
+	f.users = append(f.users, users...)
+	return f
+}
+
+// Account restricts the search to the messages of a twitch account. Messages
+// logged before user ids were captured are matched by login instead, pass the
+// login returned by LegacyLogin so they aren't given to the login's later owner.
+// Without a user id all messages of login are matched.
+func (f *Finder) Account(userID, login string) *Finder {
+	f.userID = userID
+	f.login = login
+	return f
+}
+
+// Types restricts the search to the given message and event types.
+func (f *Finder) Types(types ...string) *Finder {
+	f.types = append(f.types, types...)
+	return f
+}
+
+// ExcludeTypes leaves the given message and event types out of the search.
+func (f *Finder) ExcludeTypes(types ...string) *Finder {
+	f.notTypes = append(f.notTypes, types...)
+	return f
+}
+
+// HasBits restricts the search to cheers.
+func (f *Finder) HasBits(hasBits bool) *Finder {
+	f.hasBits = hasBits
+	return f
+}
+
+// Between restricts the search to messages sent in the time range.
+// Zero times leave that end of the range open.
+func (f *Finder) Between(start, end time.Time) *Finder {
+	f.start = start
+	f.end = end
+	f.endOpen = false
+	return f
+}
+
+// Day restricts the search to messages sent on the UTC day of t. The next
+// midnight belongs to the following day and is left out.
+func (f *Finder) Day(t time.Time) *Finder {
+	f.start = t.UTC().Truncate(24 * time.Hour)
+	f.end = f.start.Add(24 * time.Hour)
+	f.endOpen = true
+	return f
+}
+
+// SearchAfter continues a search after the sort values of the last message of the previous page.
+func (f *Finder) SearchAfter(values ...interface{}) *Finder {
+	f.searchAfter = values
+	return f
+}
+
+// Highlight adds snippets of the matched text to each message.
+func (f *Finder) Highlight(highlight bool) *Finder {
+	f.highlight = highlight
+	return f
+}
+
+// Aggregate counts the matches per channel.
+func (f *Finder) Aggregate(aggregate bool) *Finder {
+	f.aggregate = aggregate
+	return f
+}
+
 // Find executes the search and returns a response.
 func (f *Finder) Find(ctx context.Context, client *elastic.Client) (FinderResponse, error) {
 	var resp FinderResponse
 
 	// Create service and use query, aggregations, sort, filter, pagination funcs
-	search := client.Search().Index("twitch").Pretty(f.pretty)
+	search := client.Search().Index("twitch").Pretty(f.pretty).TrackTotalHits(true)
 	search = f.query(search)
 	search = f.aggs(search)
 	search = f.sorting(search)
 	search = f.paginate(search)
-
-	// TODO Add other properties here, e.g. timeouts, explain or pretty printing
+	if f.highlight && f.text != "" {
+		search = search.Highlight(elastic.NewHighlight().Field("Message").NumOfFragments(3))
+	}
 
 	// Execute query
 	sr, err := search.Do(ctx)
@@ -108,90 +241,112 @@ func (f *Finder) Find(ctx context.Context, client *elastic.Client) (FinderRespon
 		return resp, err
 	}
 	resp.Messages = messages
-	resp.Total = sr.Hits.TotalHits.Value
+	resp.Total = sr.TotalHits()
 
 	// Deserialize aggregations
 	if agg, found := sr.Aggregations.Terms("channels"); found {
 		for _, bucket := range agg.Buckets {
 			channel := &Channel{
-				Name:        bucket.Key.(string),
+				Name:        strings.TrimPrefix(bucket.Key.(string), "#"),
 				NumMessages: bucket.DocCount,
 			}
 			resp.Channels = append(resp.Channels, channel)
 		}
 	}
 
-	/*/ Use the correct function on sr.Aggregations.XXX. It must match the
-	// aggregation type specified at query time.
-	// See https://github.com/olivere/elastic/blob/release-branch.v6/search_aggs.go
-	// for all kinds of aggregation types.
-	if agg, found := sr.Aggregations.Terms("years_and_genres"); found {
-		resp.YearsAndGenres = make(map[int][]NameCount)
-		for _, bucket := range agg.Buckets {
-			// JSON doesn't have integer types: All numeric values are float64
-			floatValue, ok := bucket.Key.(float64)
-			if !ok {
-				panic("expected a float64")
+	return resp, nil
+}
+
+// Filter returns the query matching every filter of the finder, for use in
+// other searches and aggregations over the same messages.
+func (f *Finder) Filter() *elastic.BoolQuery {
+	q := elastic.NewBoolQuery()
+
+	switch {
+	case f.text == "":
+	case f.mode == MatchPhrase:
+		q = q.Must(elastic.NewMatchPhraseQuery("Message", f.text))
+	case f.mode == MatchPrefix:
+		q = q.Must(elastic.NewMatchPhrasePrefixQuery("Message", f.text))
+	case f.mode == MatchFuzzy:
+		q = q.Must(elastic.NewMatchQuery("Message", f.text).Fuzziness("AUTO").Operator("and"))
+	default:
+		q = q.Must(elastic.NewMatchQuery("Message", f.text).Operator("and"))
+	}
+
+	if len(f.channels) > 0 {
+		q = q.Filter(elastic.NewTermsQuery("Channel.keyword", prefixed(f.channels)...))
+	}
+	if len(f.notChannels) > 0 {
+		q = q.MustNot(elastic.NewTermsQuery("Channel.keyword", prefixed(f.notChannels)...))
+	}
+	if len(f.users) > 0 {
+		q = q.Filter(elastic.NewTermsQuery("User.keyword", interfaces(f.users)...))
+	}
+	if f.userID != "" && f.login == "" {
+		q = q.Filter(elastic.NewTermQuery("UserID", f.userID))
+	} else if f.userID != "" {
+		q = q.Filter(elastic.NewBoolQuery().Should(
+			elastic.NewTermQuery("UserID", f.userID),
+			elastic.NewBoolQuery().
+				Must(elastic.NewTermQuery("User.keyword", f.login)).
+				MustNot(elastic.NewExistsQuery("UserID")),
+		))
+	} else if f.login != "" {
+		q = q.Filter(elastic.NewTermQuery("User.keyword", f.login))
+	}
+	if len(f.types) > 0 {
+		types := elastic.NewBoolQuery().Should(elastic.NewTermsQuery("Type", interfaces(f.types)...))
+		for _, t := range f.types {
+			if t == "message" {
+				// Messages logged before types were stored have no Type
+				types = types.Should(elastic.NewBoolQuery().MustNot(elastic.NewExistsQuery("Type")))
 			}
-			var (
-				year          = int(floatValue)
-				genresForYear []NameCount
-			)
-			// Iterate over the sub-aggregation
-			if subAgg, found := bucket.Terms("genres_by_year"); found {
-				for _, subBucket := range subAgg.Buckets {
-					genresForYear = append(genresForYear, NameCount{
-						Name:  subBucket.Key.(string),
-						Count: subBucket.DocCount,
-					})
-				}
+		}
+		q = q.Filter(types)
+	}
+	if len(f.notTypes) > 0 {
+		q = q.MustNot(elastic.NewTermsQuery("Type", interfaces(f.notTypes)...))
+		for _, t := range f.notTypes {
+			if t == "message" {
+				q = q.Filter(elastic.NewExistsQuery("Type"))
 			}
-			resp.YearsAndGenres[year] = genresForYear
 		}
-	}*/
+	}
+	if f.hasBits {
+		q = q.Filter(elastic.NewRangeQuery("Bits").Gt(0))
+	}
+	if !f.start.IsZero() || !f.end.IsZero() {
+		r := elastic.NewRangeQuery("Timestamp")
+		if !f.start.IsZero() {
+			r = r.Gte(f.start)
+		}
+		if !f.end.IsZero() && f.endOpen {
+			r = r.Lt(f.end)
+		} else if !f.end.IsZero() {
+			r = r.Lte(f.end)
+		}
+		q = q.Filter(r)
+	}
 
-	return resp, nil
+	return q
 }
 
 // query sets up the query in the search service.
 func (f *Finder) query(service *elastic.SearchService) *elastic.SearchService {
-	/*if f.genre == "" && f.year == 0 {
-		service = service.Query(elastic.NewMatchAllQuery())
-		return service
-	}*/
-
-	q := elastic.NewBoolQuery()
-	/*if f.genre != "" {
-		q = q.Must(elastic.NewTermQuery("genre", f.genre))
-	}
-	if f.year > 0 {
-		q = q.Must(elastic.NewTermQuery("year", f.year))
-	}*/
-
-	// TODO Add other queries and filters here, maybe differentiating between AND/OR etc.
-
-	service = service.Query(q)
-	return service
+	return service.Query(f.Filter())
 }
 
 // aggs sets up the aggregations in the service.
 func (f *Finder) aggs(service *elastic.SearchService) *elastic.SearchService {
+	if !f.aggregate {
+		return service
+	}
+
 	// Terms aggregation by channel
 	agg := elastic.NewTermsAggregation().Field("Channel.keyword")
-	/*if f.from > 0 {
-		agg = agg.From(f.from)
-	}
-	if f.size > 0 {
-		agg = agg.Size(f.size)
-	}*/
 	service = service.Aggregation("channels", agg)
 
-	/*/ Add a terms aggregation of Year, and add a sub-aggregation for Genre
-	subAgg := elastic.NewTermsAggregation().Field("genre")
-	agg = elastic.NewTermsAggregation().Field("year").
-		SubAggregation("genres_by_year", subAgg)
-	service = service.Aggregation("years_and_genres", agg)*/
-
 	return service
 }
 
@@ -203,6 +358,9 @@ func (f *Finder) paginate(service *elastic.SearchService) *elastic.SearchService
 	if f.size > 0 {
 		service = service.Size(f.size)
 	}
+	if len(f.searchAfter) > 0 {
+		service = service.SearchAfter(f.searchAfter...)
+	}
 	return service
 }
 
@@ -236,21 +394,40 @@ func (f *Finder) sorting(service *elastic.SearchService) *elastic.SearchService
 	return service
 }
 
-// decodeMessages takes a search result and deserializes the films.
+// decodeMessages takes a search result and deserializes the messages.
 func (f *Finder) decodeMessages(res *elastic.SearchResult) ([]*Message, error) {
-	if res == nil || res.TotalHits() == 0 {
+	if res == nil || res.Hits == nil {
 		return nil, nil
 	}
 
 	var messages []*Message
 	for _, hit := range res.Hits.Hits {
 		message := new(Message)
-		if err := json.Unmarshal(*&hit.Source, message); err != nil {
+		if err := json.Unmarshal(hit.Source, message); err != nil {
 			return nil, err
 		}
-		// TODO Add Score here, e.g.:
-		// film.Score = *hit.Score
+		message.ID = hit.Id
+		message.Highlights = hit.Highlight["Message"]
+		message.sort = hit.Sort
 		messages = append(messages, message)
 	}
 	return messages, nil
 }
+
+// prefixed turns channel names into the #channel form they are stored in.
+func prefixed(channels []string) []interface{} {
+	values := make([]interface{}, len(channels))
+	for i, ch := range channels {
+		values[i] = fmt.Sprintf("#%s", strings.TrimPrefix(ch, "#"))
+	}
+	return values
+}
+
+// interfaces converts a string slice for use in terms queries.
+func interfaces(values []string) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, v := range values {
+		converted[i] = v
+	}
+	return converted
+}
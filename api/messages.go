@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/julienschmidt/httprouter"
+	"github.com/olivere/elastic/v7"
+)
+
+// MessageContextPath is the path of the conversation around a message.
+const MessageContextPath = MessagePath + "/:id/context"
+
+// MessageContextResponse is a message with the messages sent right before and after it in the same channel.
+type MessageContextResponse struct {
+	ChannelName string     `json:"channel_name"`
+	Message     *Message   `json:"message"`
+	Before      []*Message `json:"before"`
+	After       []*Message `json:"after"`
+	Prev        string     `json:"prev_page,omitempty"`
+	Next        string     `json:"next_page,omitempty"`
+}
+
+// MessageContext returns up to before (default 50) earlier and after (default
+// 50) later messages of the channel a message was sent in, oldest first. The
+// page links continue in either direction through ListMessages.
+//
+// swagger:route GET /api/messages/{id}/context messages getMessageContext
+//
+// Get the conversation around a message
+func (h *Handler) MessageContext(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	numBefore, err := intParam(queryValues, "before", 50, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	numAfter, err := intParam(queryValues, "after", 50, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	client := h.E.GetClient()
+	res, err := client.Get().Index("twitch").Id(ps.ByName("id")).Do(ctx)
+	if elastic.IsNotFound(err) {
+		h.R.Text(rw, http.StatusNotFound, "message not found")
+		return
+	}
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	message := new(Message)
+	if err := json.Unmarshal(res.Source, message); err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	message.ID = res.Id
+	message.sort = []interface{}{message.Timestamp.UnixNano() / int64(time.Millisecond), message.ID}
+
+	channelName := strings.TrimPrefix(message.Channel, "#")
+	if !apikey.FromContext(r.Context()).CanRead(channelName) {
+		h.R.Text(rw, http.StatusNotFound, "message not found")
+		return
+	}
+	resp := MessageContextResponse{
+		ChannelName: channelName,
+		Message:     message,
+		Before:      []*Message{},
+		After:       []*Message{},
+	}
+
+	if numBefore > 0 {
+		finder := NewFinder().Channels(channelName).Size(numBefore)
+		if resp.Before, err = findPage(ctx, client, finder, true, nil, message.sort); err != nil {
+			h.R.Text(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if numAfter > 0 {
+		finder := NewFinder().Channels(channelName).Size(numAfter)
+		if resp.After, err = findPage(ctx, client, finder, true, message.sort, nil); err != nil {
+			h.R.Text(rw, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	page := append(append(append([]*Message{}, resp.Before...), message), resp.After...)
+	listing := url.Values{}
+	listing.Set("stream", channelName)
+	listing.Set("order", "asc")
+	listing.Set("limit", "100")
+	resp.Next, resp.Prev = pageLinks(MessagePath, listing, page)
+	resp.Before = Dedupe(resp.Before, h.DedupWindow)
+	resp.After = Dedupe(resp.After, h.DedupWindow)
+
+	h.R.JSON(rw, http.StatusOK, &resp)
+}
+
+// findPage finds a page of messages ordered by time, and by id between messages
+// sent in the same millisecond so cursors are stable. Pass the sort values of a
+// message as after to get the page following it, or as before to get the page
+// preceding it. Either way the messages are returned in the requested order.
+func findPage(ctx context.Context, client *elastic.Client, finder *Finder, asc bool, after, before []interface{}) ([]*Message, error) {
+	forward := asc
+	cursor := after
+	if before != nil {
+		// Walk backwards from the cursor and flip the page afterwards
+		forward = !asc
+		cursor = before
+	}
+
+	if forward {
+		finder = finder.Sort("Timestamp", "_id")
+	} else {
+		finder = finder.Sort("-Timestamp", "-_id")
+	}
+	if cursor != nil {
+		finder = finder.SearchAfter(cursor...)
+	}
+
+	found, err := finder.Find(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := found.Messages
+	if before != nil {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	if messages == nil {
+		messages = []*Message{}
+	}
+	return messages, nil
+}
+
+// pageLinks returns the links to the pages following and preceding messages.
+func pageLinks(path string, queryValues url.Values, messages []*Message) (next, prev string) {
+	if len(messages) == 0 {
+		return "", ""
+	}
+
+	values := url.Values{}
+	for k, v := range queryValues {
+		values[k] = v
+	}
+	values.Del("after_timestamp")
+	values.Del("after_id")
+	values.Del("before")
+
+	values.Set("after", encodeCursor(messages[len(messages)-1].sort))
+	next = fmt.Sprintf("%s?%s", path, values.Encode())
+
+	values.Del("after")
+	values.Set("before", encodeCursor(messages[0].sort))
+	prev = fmt.Sprintf("%s?%s", path, values.Encode())
+
+	return next, prev
+}
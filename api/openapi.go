@@ -0,0 +1,28 @@
+package api
+
+import (
+	_ "embed" // embeds the OpenAPI document
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OpenAPIPath is the path of the OpenAPI document describing the API.
+const OpenAPIPath = "/api/openapi.json"
+
+// OpenAPI is the OpenAPI 3 document of the health, stream, user, message and
+// search endpoints. It is maintained by hand, so changing one of their
+// parameters or responses means changing openapi.json too.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// GetOpenAPI serves the OpenAPI document.
+//
+// swagger:route GET /api/openapi.json meta getOpenAPI
+//
+// Get the OpenAPI document
+func (h *Handler) GetOpenAPI(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rw.Header().Set("Content-Type", "application/json")
+	h.R.Data(rw, http.StatusOK, OpenAPI)
+}
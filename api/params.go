@@ -0,0 +1,148 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTime reads a query value as either unix milliseconds or an RFC3339 timestamp.
+func parseTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// timeRange reads the from and to query values, defaulting to the given duration before now.
+func timeRange(queryValues url.Values, fallback time.Duration) (from, to time.Time, err error) {
+	to = time.Now().UTC()
+	if v := queryValues.Get("to"); v != "" {
+		if to, err = parseTime(v); err != nil {
+			return
+		}
+	}
+
+	from = to.Add(-fallback)
+	if v := queryValues.Get("from"); v != "" {
+		if from, err = parseTime(v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseInterval reads a histogram interval. Besides the units of
+// time.ParseDuration it takes whole days and weeks, like 1d or 2w.
+func parseInterval(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) {
+			if n <= 0 {
+				return 0, fmt.Errorf("interval must be positive")
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(value)
+}
+
+// weekStart is the first monday after the unix epoch. Buckets of whole weeks
+// start on mondays, not on the thursday the epoch fell on.
+var weekStart = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// histogramStart returns the start of the histogram bucket from falls into and
+// the offset that makes elasticsearch, which counts buckets from the unix
+// epoch, use the same buckets. The offset is empty when none is needed.
+func histogramStart(from time.Time, interval time.Duration) (time.Time, string) {
+	origin := time.Unix(0, 0).UTC()
+	if interval%(7*24*time.Hour) == 0 {
+		origin = weekStart
+	}
+
+	start := origin.Add(from.Sub(origin) / interval * interval)
+	if start.After(from) {
+		start = start.Add(-interval)
+	}
+	offset := origin.Sub(time.Unix(0, 0)) % interval
+	if offset == 0 {
+		return start, ""
+	}
+	return start, fmt.Sprintf("+%dms", offset/time.Millisecond)
+}
+
+// atParam reads the at query value, the time a login is resolved at, defaulting to now.
+func atParam(queryValues url.Values) (time.Time, error) {
+	if v := queryValues.Get("at"); v != "" {
+		return parseTime(v)
+	}
+	return time.Now().UTC(), nil
+}
+
+// listParam reads a query value that may be repeated or comma separated.
+func listParam(queryValues url.Values, key string) []string {
+	var values []string
+	for _, v := range queryValues[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// intParam reads an integer query value, returning fallback when it is missing.
+func intParam(queryValues url.Values, key string, fallback, max int) (int, error) {
+	v := queryValues.Get(key)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s cannot be negative", key)
+	}
+	if max > 0 && n > max {
+		return 0, fmt.Errorf("%s cannot exceed %d", key, max)
+	}
+	return n, nil
+}
+
+// encodeCursor turns the sort values of the last message of a page into an opaque cursor.
+func encodeCursor(values []interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Cursor returns the cursor continuing a search after m.
+func (m *Message) Cursor() string {
+	return encodeCursor(m.sort)
+}
+
+// DecodeCursor reads a cursor created by encodeCursor.
+func DecodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var values []interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&values); err != nil || len(values) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return values, nil
+}
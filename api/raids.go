@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/raid"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// RaidsPath is the path to the raids of a stream.
+	RaidsPath = StreamPath + "/:name/raids"
+	// TopRaidsPath is the path to the channels raiding a stream most.
+	TopRaidsPath = RaidsPath + "/top"
+)
+
+// StreamRaidsResponse lists raids of a stream.
+type StreamRaidsResponse struct {
+	ChannelName string       `json:"channel_name"`
+	Direction   string       `json:"direction"`
+	Raids       []*raid.Raid `json:"raids"`
+}
+
+// TopRaidsResponse ranks the channels raiding a stream, or raided by it.
+type TopRaidsResponse struct {
+	ChannelName string          `json:"channel_name"`
+	Direction   string          `json:"direction"`
+	Channels    []*raid.Partner `json:"channels"`
+}
+
+// StreamRaids returns the raids a stream received, or sent with direction=out,
+// between from and to, newest first. Raids from or to private channels the
+// request can't read are left out.
+//
+// swagger:route GET /api/streams/{name}/raids streams listStreamRaids
+//
+// List raids of a stream
+func (h *Handler) StreamRaids(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := raidQuery(r.URL.Query(), ps.ByName("name"))
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.ExcludeChannels = apikey.FromContext(r.Context()).Hidden()
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	raids, err := raid.Find(ctx, h.E.GetClient(), q)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, &StreamRaidsResponse{
+		ChannelName: q.Channel,
+		Direction:   q.Direction,
+		Raids:       raids,
+	})
+}
+
+// TopRaids ranks the channels that raided a stream between from and to, or
+// that it raided with direction=out, by the viewers raided in total.
+//
+// swagger:route GET /api/streams/{name}/raids/top streams listTopRaids
+//
+// Rank the raiders of a stream
+func (h *Handler) TopRaids(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := raidQuery(r.URL.Query(), ps.ByName("name"))
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.ExcludeChannels = apikey.FromContext(r.Context()).Hidden()
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	top, err := raid.Top(ctx, h.E.GetClient(), q)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, &TopRaidsResponse{
+		ChannelName: q.Channel,
+		Direction:   q.Direction,
+		Channels:    top,
+	})
+}
+
+// raidQuery reads direction, from, to and limit, looking back 30 days by default.
+func raidQuery(queryValues url.Values, channel string) (raid.Query, error) {
+	q := raid.Query{Channel: channel, Direction: raid.In}
+	if d := queryValues.Get("direction"); d != "" {
+		if d != raid.In && d != raid.Out {
+			return q, fmt.Errorf("direction must be %s or %s", raid.In, raid.Out)
+		}
+		q.Direction = d
+	}
+
+	var err error
+	if q.From, q.To, err = timeRange(queryValues, 30*24*time.Hour); err != nil {
+		return q, err
+	}
+	q.Limit, err = intParam(queryValues, "limit", 25, 1000)
+	return q, err
+}
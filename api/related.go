@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/analysis"
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/julienschmidt/httprouter"
+)
+
+// RelatedPath is the path to the channels sharing chatters with a stream.
+const RelatedPath = StreamPath + "/:name/related"
+
+// RelatedStreamsResponse lists the channels sharing the most chatters with a stream.
+type RelatedStreamsResponse struct {
+	ChannelName string                     `json:"channel_name"`
+	Chatters    int64                      `json:"chatters"`
+	From        time.Time                  `json:"from"`
+	To          time.Time                  `json:"to"`
+	Approximate bool                       `json:"approximate"`
+	ComputedAt  time.Time                  `json:"computed_at"`
+	Related     []*analysis.RelatedChannel `json:"related"`
+}
+
+// RelatedStreams returns the channels sharing the most chatters with a stream
+// by Jaccard index, as computed by "ttv-log analyze overlap". Private channels
+// the request can't read are left out.
+//
+// swagger:route GET /api/streams/{name}/related streams listRelatedStreams
+//
+// List channels sharing chatters with a stream
+func (h *Handler) RelatedStreams(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	channelName := ps.ByName("name")
+
+	limit, err := intParam(r.URL.Query(), "limit", 25, 100)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	overlap, ok, err := analysis.FindOverlap(ctx, h.E.GetClient(), channelName)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("the overlap of %s was never computed", channelName))
+		return
+	}
+
+	access := apikey.FromContext(r.Context())
+	related := []*analysis.RelatedChannel{}
+	for _, rc := range overlap.Related {
+		if len(related) == limit {
+			break
+		}
+		if access.CanRead(rc.Channel) {
+			related = append(related, rc)
+		}
+	}
+	h.R.JSON(rw, http.StatusOK, &RelatedStreamsResponse{
+		ChannelName: overlap.Channel,
+		Chatters:    overlap.Chatters,
+		From:        overlap.From,
+		To:          overlap.To,
+		Approximate: overlap.Approximate,
+		ComputedAt:  overlap.ComputedAt,
+		Related:     related,
+	})
+}
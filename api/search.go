@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/julienschmidt/httprouter"
+)
+
+// SearchPath is the path of the full-text message search.
+const SearchPath = "/api/search"
+
+// maxSearchWindow is the deepest page elasticsearch serves with from/size pagination
+const maxSearchWindow = 10000
+
+// SearchResponse is a page of search results.
+type SearchResponse struct {
+	Total    int64      `json:"total"`
+	Next     string     `json:"next_page,omitempty"`
+	Channels []*Channel `json:"channels"`
+	Messages []*Message `json:"messages"`
+}
+
+// Search finds messages by text (q, with mode match, phrase, prefix or fuzzy),
+// channel, user, type, has_bits and a from/to time range. Channels, users and
+// types may be repeated or comma separated. Matches are highlighted.
+//
+// swagger:route GET /api/search search searchMessages
+//
+// Search messages
+func (h *Handler) Search(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	queryValues := r.URL.Query()
+
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mode := queryValues.Get("mode")
+	switch mode {
+	case "", MatchAll, MatchPhrase, MatchPrefix, MatchFuzzy:
+	default:
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("unknown mode %q", mode))
+		return
+	}
+	text := queryValues.Get("q")
+	finder = finder.Text(text, mode).Highlight(true).Aggregate(true)
+
+	limit, err := intParam(queryValues, "limit", 50, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := intParam(queryValues, "offset", 0, 0)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	if offset+limit > maxSearchWindow {
+		h.R.Text(rw, http.StatusBadRequest, fmt.Sprintf("offset + limit cannot exceed %d, narrow the search instead", maxSearchWindow))
+		return
+	}
+	finder = finder.From(offset).Size(limit)
+
+	if text != "" {
+		finder = finder.Sort("-_score", "-Timestamp")
+	} else {
+		finder = finder.Sort("-Timestamp")
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 10*time.Second)
+	defer cancel()
+
+	found, err := finder.Find(ctx, h.E.GetClient())
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := SearchResponse{
+		Total:    found.Total,
+		Channels: found.Channels,
+		Messages: Dedupe(found.Messages, h.DedupWindow),
+	}
+	if next := offset + limit; int64(next) < found.Total && next < maxSearchWindow {
+		queryValues.Set("offset", strconv.Itoa(next))
+		resp.Next = fmt.Sprintf("%s?%s", r.URL.Path, queryValues.Encode())
+	}
+
+	h.R.JSON(rw, http.StatusOK, &resp)
+}
+
+// finderFromRequest sets up a finder with the channel, user, type, bits and time
+// filters of a request. Private channels the request can't read are left out.
+func finderFromRequest(r *http.Request) (*Finder, error) {
+	queryValues := r.URL.Query()
+	finder := NewFinder().
+		Channels(listParam(queryValues, "channel")...).
+		ExcludeChannels(apikey.FromContext(r.Context()).Hidden()...).
+		Users(listParam(queryValues, "user")...).
+		Types(listParam(queryValues, "type")...)
+
+	if v := queryValues.Get("has_bits"); v != "" {
+		hasBits, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		finder = finder.HasBits(hasBits)
+	}
+
+	var start, end time.Time
+	var err error
+	if v := queryValues.Get("from"); v != "" {
+		if start, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := queryValues.Get("to"); v != "" {
+		if end, err = parseTime(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return finder.Between(start, end), nil
+}
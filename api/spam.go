@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/spam"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// CopypastaPath is the path of the copypastas spreading through chat.
+	CopypastaPath = "/api/copypastas"
+	// SpamClustersPath is the path of the clusters of spam.
+	SpamClustersPath = "/api/spam/clusters"
+)
+
+// ClustersResponse lists clusters of near-duplicate messages.
+type ClustersResponse struct {
+	Clusters []*spam.Cluster `json:"clusters"`
+}
+
+// ListCopypastas returns the messages posted by many users, most users first.
+// Filter with channel, user, from and to.
+//
+// swagger:route GET /api/copypastas spam listCopypastas
+//
+// List copypastas
+func (h *Handler) ListCopypastas(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	h.listClusters(rw, r, func(q *spam.Query) { q.Copypasta = true })
+}
+
+// ListSpamClusters returns the messages repeated by the same accounts or
+// spread over many channels, most recent first. Filter with channel, user, from and to.
+//
+// swagger:route GET /api/spam/clusters spam listSpamClusters
+//
+// List spam clusters
+func (h *Handler) ListSpamClusters(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	h.listClusters(rw, r, func(q *spam.Query) { q.Spam = true })
+}
+
+func (h *Handler) listClusters(rw http.ResponseWriter, r *http.Request, kind func(q *spam.Query)) {
+	queryValues := r.URL.Query()
+	q, err := clusterQuery(queryValues)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	kind(&q)
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	clusters, err := spam.Find(ctx, h.E.GetClient(), q)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Clusters quote messages, leave out those posted in private channels
+	access := apikey.FromContext(r.Context())
+	visible := []*spam.Cluster{}
+	for _, c := range clusters {
+		if readable(access, c) {
+			visible = append(visible, c)
+		}
+	}
+
+	h.R.JSON(rw, http.StatusOK, &ClustersResponse{Clusters: visible})
+}
+
+func readable(access *apikey.Access, c *spam.Cluster) bool {
+	for _, ch := range c.Channels {
+		if !access.CanRead(ch.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+func clusterQuery(queryValues url.Values) (spam.Query, error) {
+	q := spam.Query{
+		Channel: strings.ToLower(strings.TrimPrefix(queryValues.Get("channel"), "#")),
+		User:    strings.ToLower(queryValues.Get("user")),
+	}
+
+	var err error
+	if q.Limit, err = intParam(queryValues, "limit", 25, 1000); err != nil {
+		return q, err
+	}
+	if v := queryValues.Get("from"); v != "" {
+		if q.From, err = parseTime(v); err != nil {
+			return q, err
+		}
+	}
+	if v := queryValues.Get("to"); v != "" {
+		if q.To, err = parseTime(v); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
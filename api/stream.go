@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type streamKey int
+
+const deadlineKey streamKey = 0
+
+// writeDeadliner is implemented by the server's own response writers.
+type writeDeadliner interface {
+	SetWriteDeadline(time.Time) error
+}
+
+// AllowStreaming lets the live tail and the export lift the server's write
+// timeout for their own responses. It must wrap the router directly, the
+// response writers of the middlewares in between can't set deadlines.
+func AllowStreaming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if d, ok := rw.(writeDeadliner); ok {
+			r = r.WithContext(context.WithValue(r.Context(), deadlineKey, d))
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// keepStreaming clears the write deadline of a response that streams for as
+// long as the client stays connected. Servers built with Go before 1.20 can't
+// change deadlines, their streams end with the write timeout.
+func keepStreaming(r *http.Request) {
+	if d, ok := r.Context().Value(deadlineKey).(writeDeadliner); ok {
+		d.SetWriteDeadline(time.Time{})
+	}
+}
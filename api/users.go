@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/directory"
+	"github.com/julienschmidt/httprouter"
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// UserDetailPath is the path of a user's summary.
+	UserDetailPath = UserPath + "/:name"
+	// UserMessagesPath is the path of a user's messages across channels.
+	UserMessagesPath = UserPath + "/:name/messages"
+	// AccountPath is the path of a twitch account's name history by user id.
+	AccountPath = "/api/accounts/:id"
+)
+
+// NameHistory is a login name a twitch account used and when.
+type NameHistory struct {
+	Name        string    `json:"name"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	NumMessages int64     `json:"num_messages_logged"`
+}
+
+// UserSummary describes a user's activity over all logged channels.
+type UserSummary struct {
+	Name        string         `json:"name"`
+	UserID      string         `json:"user_id,omitempty"`
+	CurrentName string         `json:"current_name,omitempty"`
+	FirstSeen   *time.Time     `json:"first_seen"`
+	LastSeen    *time.Time     `json:"last_seen"`
+	NumMessages int64          `json:"num_messages_logged"`
+	Channels    []*Channel     `json:"channels"`
+	Names       []*NameHistory `json:"names"`
+}
+
+// UserMessagesResponse is a page of a user's messages.
+type UserMessagesResponse struct {
+	UserName string     `json:"user_name"`
+	UserID   string     `json:"user_id,omitempty"`
+	Next     string     `json:"next_page"`
+	Messages []*Message `json:"messages"`
+}
+
+// GetUser returns when a user was first and last seen, how many messages they
+// sent per channel and which names their account used. A login that several
+// accounts used resolves to the one using it at the time given as at.
+//
+// swagger:route GET /api/users/{name} users getUser
+//
+// Get a user's summary
+func (h *Handler) GetUser(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	login := strings.ToLower(ps.ByName("name"))
+	at, err := atParam(r.URL.Query())
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	client := h.E.GetClient()
+	userID, err := ResolveUserID(ctx, client, login, at)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	summary, err := FindUserSummary(ctx, client, userID, login, apikey.FromContext(r.Context()).Hidden()...)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if summary.NumMessages == 0 {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("user %s was never seen", login))
+		return
+	}
+
+	h.R.JSON(rw, http.StatusOK, summary)
+}
+
+// ListUserMessages returns a user's messages across channels, newest first.
+// Filter with channel, from and to, and page with the cursor of next_page.
+// The login is resolved at the time given as at, see GetUser.
+//
+// swagger:route GET /api/users/{name}/messages users listUserMessages
+//
+// List a user's messages
+func (h *Handler) ListUserMessages(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	login := strings.ToLower(ps.ByName("name"))
+	queryValues := r.URL.Query()
+
+	finder, err := finderFromRequest(r)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := intParam(queryValues, "limit", 100, 1000)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+	finder = finder.Size(limit).Sort("-Timestamp", "-_id")
+
+	at, err := atParam(queryValues)
+	if err != nil {
+		h.R.Text(rw, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if cursor := queryValues.Get("cursor"); cursor != "" {
+		after, err := DecodeCursor(cursor)
+		if err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+		finder = finder.SearchAfter(after...)
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	client := h.E.GetClient()
+	userID, err := ResolveUserID(ctx, client, login, at)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	legacy, err := LegacyLogin(ctx, client, userID, login)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	found, err := finder.Account(userID, legacy).Find(ctx, client)
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := UserMessagesResponse{
+		UserName: login,
+		UserID:   userID,
+		Messages: []*Message{},
+	}
+	if n := len(found.Messages); n > 0 {
+		queryValues.Set("cursor", encodeCursor(found.Messages[n-1].sort))
+		resp.Next = fmt.Sprintf("%s?%s", r.URL.Path, queryValues.Encode())
+		resp.Messages = Dedupe(found.Messages, h.DedupWindow)
+	}
+
+	h.R.JSON(rw, http.StatusOK, &resp)
+}
+
+// FindUserSummary sums up the messages of the account with userID, or of login
+// for users only logged before user ids were captured. NumMessages is 0 when
+// the user was never seen. Messages in the hidden channels aren't counted.
+func FindUserSummary(ctx context.Context, client *elastic.Client, userID, login string, hidden ...string) (*UserSummary, error) {
+	legacy, err := LegacyLogin(ctx, client, userID, login)
+	if err != nil {
+		return nil, err
+	}
+	q := NewFinder().Account(userID, legacy).ExcludeChannels(hidden...).Filter()
+	names := elastic.NewTermsAggregation().Field("User.keyword").Size(100).
+		SubAggregation("first_seen", elastic.NewMinAggregation().Field("Timestamp")).
+		SubAggregation("last_seen", elastic.NewMaxAggregation().Field("Timestamp"))
+
+	sr, err := client.Search().Index("twitch").Query(q).Size(0).TrackTotalHits(true).
+		Aggregation("first_seen", elastic.NewMinAggregation().Field("Timestamp")).
+		Aggregation("last_seen", elastic.NewMaxAggregation().Field("Timestamp")).
+		Aggregation("channels", elastic.NewTermsAggregation().Field("Channel.keyword").Size(1000)).
+		Aggregation("names", names).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := UserSummary{
+		Name:        login,
+		UserID:      userID,
+		NumMessages: sr.TotalHits(),
+		Channels:    []*Channel{},
+		Names:       []*NameHistory{},
+	}
+	if u, ok, err := directory.Get(ctx, client, userID); err == nil && ok {
+		summary.CurrentName = u.Login
+	}
+	summary.FirstSeen = aggTime(sr.Aggregations, "first_seen")
+	summary.LastSeen = aggTime(sr.Aggregations, "last_seen")
+
+	if agg, found := sr.Aggregations.Terms("channels"); found {
+		for _, bucket := range agg.Buckets {
+			summary.Channels = append(summary.Channels, &Channel{
+				Name:        strings.TrimPrefix(bucket.Key.(string), "#"),
+				NumMessages: bucket.DocCount,
+			})
+		}
+	}
+
+	if agg, found := sr.Aggregations.Terms("names"); found {
+		for _, bucket := range agg.Buckets {
+			name := &NameHistory{
+				Name:        bucket.Key.(string),
+				NumMessages: bucket.DocCount,
+			}
+			if t := aggTime(bucket.Aggregations, "first_seen"); t != nil {
+				name.FirstSeen = *t
+			}
+			if t := aggTime(bucket.Aggregations, "last_seen"); t != nil {
+				name.LastSeen = *t
+			}
+			summary.Names = append(summary.Names, name)
+		}
+	}
+
+	return &summary, nil
+}
+
+// LegacyLogin returns login when the messages logged of it before user ids
+// were captured belong to the account with userID, which is the account
+// directory.Owners gives the login to, and "" when they belong to another one.
+// Without a user id login is returned as is.
+func LegacyLogin(ctx context.Context, client *elastic.Client, userID, login string) (string, error) {
+	if userID == "" {
+		return login, nil
+	}
+	owners, err := directory.Owners(ctx, client, []string{login})
+	if err != nil {
+		return "", err
+	}
+	if owner, ok := owners[strings.ToLower(login)]; ok && owner.UserID == userID {
+		return login, nil
+	}
+	return "", nil
+}
+
+// ResolveUserID returns the id of the twitch account that used login at t.
+// Accounts missing from the user directory are looked up in the messages, and
+// an empty id is returned for users only logged before user ids were captured.
+func ResolveUserID(ctx context.Context, client *elastic.Client, login string, t time.Time) (string, error) {
+	u, ok, err := directory.Resolve(ctx, client, login, t)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return u.UserID, nil
+	}
+
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("User.keyword", login),
+		elastic.NewExistsQuery("UserID"),
+		elastic.NewRangeQuery("Timestamp").Lte(t),
+	)
+
+	sr, err := client.Search().Index("twitch").Query(q).Sort("Timestamp", false).Size(1).
+		FetchSourceContext(elastic.NewFetchSourceContext(true).Include("UserID")).
+		Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(sr.Hits.Hits) == 0 {
+		return "", nil
+	}
+
+	var m Message
+	if err := json.Unmarshal(sr.Hits.Hits[0].Source, &m); err != nil {
+		return "", err
+	}
+	return m.UserID, nil
+}
+
+// aggTime reads a min or max aggregation over a date field.
+func aggTime(aggs elastic.Aggregations, name string) *time.Time {
+	agg, found := aggs.Min(name)
+	if !found || agg.Value == nil {
+		return nil
+	}
+
+	t := time.Unix(0, int64(*agg.Value)*int64(time.Millisecond)).UTC()
+	return &t
+}
+
+// GetAccount returns the login names a twitch account used and when, as
+// stored in the user directory by "ttv-log analyze users".
+//
+// swagger:route GET /api/accounts/{id} users getAccount
+//
+// Get the name history of an account
+func (h *Handler) GetAccount(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	u, ok, err := directory.Get(ctx, h.E.GetClient(), ps.ByName("id"))
+	if err != nil {
+		h.R.Text(rw, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		h.R.Text(rw, http.StatusNotFound, fmt.Sprintf("account %s is not in the user directory", ps.ByName("id")))
+		return
+	}
+	h.R.JSON(rw, http.StatusOK, u)
+}
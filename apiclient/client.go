@@ -0,0 +1,389 @@
+// Package apiclient is a typed client of the ttv-log HTTP API, as described
+// by the OpenAPI document served at /api/openapi.json.
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a response with an unexpected status. The API answers errors in plain text.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ttv-log api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls the API of one ttv-log server.
+type Client struct {
+	base *url.URL
+	http *http.Client
+
+	// Token is sent as bearer token when set.
+	Token string
+}
+
+// New creates a client of the server at baseURL, e.g. "https://ttvlog.djdduty.com".
+// A nil httpClient uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("base url %q must be absolute", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: base, http: httpClient}, nil
+}
+
+// Filter narrows down the messages of a listing or search. Empty fields don't filter.
+type Filter struct {
+	Channels []string
+	Users    []string
+	Types    []string
+	HasBits  *bool
+	From     time.Time
+	To       time.Time
+}
+
+func (f *Filter) encode(values url.Values) {
+	if f == nil {
+		return
+	}
+	for _, ch := range f.Channels {
+		values.Add("channel", ch)
+	}
+	for _, u := range f.Users {
+		values.Add("user", u)
+	}
+	for _, t := range f.Types {
+		values.Add("type", t)
+	}
+	if f.HasBits != nil {
+		values.Set("has_bits", strconv.FormatBool(*f.HasBits))
+	}
+	setTime(values, "from", f.From)
+	setTime(values, "to", f.To)
+}
+
+// Alive tells whether the server handles requests.
+func (c *Client) Alive(ctx context.Context) error {
+	return c.get(ctx, aliveCheckPath, nil, nil)
+}
+
+// Ready tells whether the server and its dependencies are ready. Failed checks
+// are returned by name along with an *Error of status 503.
+func (c *Client) Ready(ctx context.Context) (map[string]string, error) {
+	err := c.get(ctx, readyCheckPath, nil, nil)
+	if e, ok := err.(*Error); ok && e.StatusCode == http.StatusServiceUnavailable {
+		var status struct {
+			Errors map[string]string `json:"errors"`
+		}
+		if json.Unmarshal([]byte(e.Message), &status) == nil {
+			return status.Errors, err
+		}
+	}
+	return nil, err
+}
+
+// Version returns the build version of the server.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var v struct {
+		Version string `json:"version"`
+	}
+	err := c.get(ctx, versionPath, nil, &v)
+	return v.Version, err
+}
+
+// ListStreams returns the limit streams with the most logged messages, 10 when limit is 0.
+func (c *Client) ListStreams(ctx context.Context, limit int) ([]*Channel, error) {
+	values := url.Values{}
+	setInt(values, "limit", limit)
+
+	channels := []*Channel{}
+	err := c.get(ctx, streamsPath, values, &channels)
+	return channels, err
+}
+
+// Coverage returns the intervals in which a stream was and wasn't logged. Zero
+// times default to the 24 hours before now.
+func (c *Client) Coverage(ctx context.Context, stream string, from, to time.Time) (*StreamCoverageResponse, error) {
+	values := url.Values{}
+	setTime(values, "from", from)
+	setTime(values, "to", to)
+
+	resp := new(StreamCoverageResponse)
+	err := c.get(ctx, streamPath(coveragePath, stream), values, resp)
+	return resp, err
+}
+
+// ActivityQuery selects the time series of Activity.
+type ActivityQuery struct {
+	// Compare adds more streams, all with the same buckets.
+	Compare []string
+	// Interval is the bucket size, one minute when 0.
+	Interval time.Duration
+	From     time.Time
+	To       time.Time
+}
+
+// Activity returns the messages, chatters, subs and cheers of streams per interval.
+func (c *Client) Activity(ctx context.Context, stream string, q *ActivityQuery) (*StreamActivityResponse, error) {
+	values := url.Values{}
+	if q != nil {
+		for _, ch := range q.Compare {
+			values.Add("compare", ch)
+		}
+		if q.Interval > 0 {
+			values.Set("interval", q.Interval.String())
+		}
+		setTime(values, "from", q.From)
+		setTime(values, "to", q.To)
+	}
+
+	resp := new(StreamActivityResponse)
+	err := c.get(ctx, streamPath(activityPath, stream), values, resp)
+	return resp, err
+}
+
+// MessageQuery selects a page of ListMessages.
+type MessageQuery struct {
+	Filter
+	// Stream limits the messages to one stream.
+	Stream string
+	// Limit is the page size, 10 when 0.
+	Limit int
+	// Ascending lists the oldest messages first.
+	Ascending bool
+	// After and Before continue from the cursors of a previous page.
+	After  string
+	Before string
+}
+
+// ListMessages returns a page of messages. Use Page to follow its next_page or prev_page.
+func (c *Client) ListMessages(ctx context.Context, q *MessageQuery) (*StreamMessagesResponse, error) {
+	values := url.Values{}
+	if q != nil {
+		q.Filter.encode(values)
+		setString(values, "stream", q.Stream)
+		setInt(values, "limit", q.Limit)
+		if q.Ascending {
+			values.Set("order", "asc")
+		}
+		setString(values, "after", q.After)
+		setString(values, "before", q.Before)
+	}
+
+	resp := new(StreamMessagesResponse)
+	err := c.get(ctx, messagePath, values, resp)
+	return resp, err
+}
+
+// MessageContext returns a message with up to before earlier and after later
+// messages of its channel. Zero counts default to 50.
+func (c *Client) MessageContext(ctx context.Context, id string, before, after int) (*MessageContextResponse, error) {
+	values := url.Values{}
+	setInt(values, "before", before)
+	setInt(values, "after", after)
+
+	resp := new(MessageContextResponse)
+	err := c.get(ctx, strings.Replace(messageContextPath, ":id", url.PathEscape(id), 1), values, resp)
+	return resp, err
+}
+
+// SearchQuery selects a page of Search.
+type SearchQuery struct {
+	Filter
+	// Text is searched for according to Mode, MatchAll when empty.
+	Text string
+	Mode string
+	// Limit is the page size, 50 when 0.
+	Limit  int
+	Offset int
+}
+
+// Search finds messages by text and filters.
+func (c *Client) Search(ctx context.Context, q *SearchQuery) (*SearchResponse, error) {
+	values := url.Values{}
+	if q != nil {
+		q.Filter.encode(values)
+		setString(values, "q", q.Text)
+		setString(values, "mode", q.Mode)
+		setInt(values, "limit", q.Limit)
+		setInt(values, "offset", q.Offset)
+	}
+
+	resp := new(SearchResponse)
+	err := c.get(ctx, searchPath, values, resp)
+	return resp, err
+}
+
+// ListUsers returns the limit users with the most logged messages, 10 when limit is 0.
+func (c *Client) ListUsers(ctx context.Context, limit int) ([]*UserCount, error) {
+	values := url.Values{}
+	setInt(values, "limit", limit)
+
+	users := []*UserCount{}
+	err := c.get(ctx, usersPath, values, &users)
+	return users, err
+}
+
+// GetUser returns the summary of the account that used login at the time at, now when zero.
+func (c *Client) GetUser(ctx context.Context, login string, at time.Time) (*UserSummary, error) {
+	values := url.Values{}
+	setTime(values, "at", at)
+
+	resp := new(UserSummary)
+	err := c.get(ctx, userPath(userDetailPath, login), values, resp)
+	return resp, err
+}
+
+// UserMessagesQuery selects a page of ListUserMessages. Filter.Users is ignored.
+type UserMessagesQuery struct {
+	Filter
+	// At resolves the login, see GetUser.
+	At time.Time
+	// Limit is the page size, 100 when 0.
+	Limit int
+	// Cursor continues from a previous page.
+	Cursor string
+}
+
+// ListUserMessages returns a page of a user's messages, newest first.
+func (c *Client) ListUserMessages(ctx context.Context, login string, q *UserMessagesQuery) (*UserMessagesResponse, error) {
+	values := url.Values{}
+	if q != nil {
+		filter := q.Filter
+		filter.Users = nil
+		filter.encode(values)
+		setTime(values, "at", q.At)
+		setInt(values, "limit", q.Limit)
+		setString(values, "cursor", q.Cursor)
+	}
+
+	resp := new(UserMessagesResponse)
+	err := c.get(ctx, userPath(userMessagesPath, login), values, resp)
+	return resp, err
+}
+
+// GetAccount returns the name history of a twitch account by user id.
+func (c *Client) GetAccount(ctx context.Context, userID string) (*Account, error) {
+	resp := new(Account)
+	err := c.get(ctx, strings.Replace(accountPath, ":id", url.PathEscape(userID), 1), nil, resp)
+	return resp, err
+}
+
+// Page follows a next_page or prev_page link of a previous response into v,
+// which has the type of that response. Links are paths of the API, so they are
+// joined with the base url like every other request, keeping its path prefix.
+// Absolute links are only followed to the host of the base url, which is the
+// only one the token is sent to.
+func (c *Client) Page(ctx context.Context, link string, v interface{}) error {
+	ref, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	if ref.IsAbs() {
+		if ref.Scheme != c.base.Scheme || ref.Host != c.base.Host {
+			return fmt.Errorf("link %q leaves %s", link, c.base.Host)
+		}
+		return c.do(ctx, ref, v)
+	}
+
+	u, err := c.resolve("/"+strings.TrimPrefix(ref.EscapedPath(), "/"), ref.RawQuery)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, u, v)
+}
+
+// get requests path, whose segments are already escaped, below the base url.
+func (c *Client) get(ctx context.Context, path string, values url.Values, v interface{}) error {
+	u, err := c.resolve(path, values.Encode())
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, u, v)
+}
+
+// resolve joins the escaped path with the path of the base url.
+func (c *Client) resolve(path, query string) (*url.URL, error) {
+	raw := strings.TrimSuffix(c.base.EscapedPath(), "/") + path
+	unescaped, err := url.PathUnescape(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *c.base
+	u.Path = unescaped
+	u.RawPath = raw
+	u.RawQuery = query
+	return &u, nil
+}
+
+func (c *Client) do(ctx context.Context, u *url.URL, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64<<10))
+		return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func streamPath(path, stream string) string {
+	return strings.Replace(path, ":name", url.PathEscape(strings.TrimPrefix(stream, "#")), 1)
+}
+
+func userPath(path, login string) string {
+	return strings.Replace(path, ":name", url.PathEscape(login), 1)
+}
+
+func setString(values url.Values, key, value string) {
+	if value != "" {
+		values.Set(key, value)
+	}
+}
+
+func setInt(values url.Values, key string, value int) {
+	if value > 0 {
+		values.Set(key, strconv.Itoa(value))
+	}
+}
+
+func setTime(values url.Values, key string, t time.Time) {
+	if !t.IsZero() {
+		values.Set(key, t.UTC().Format(time.RFC3339Nano))
+	}
+}
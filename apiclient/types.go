@@ -0,0 +1,175 @@
+package apiclient
+
+import (
+	"time"
+)
+
+// Paths of the API, with :name and :id replaced by the stream, login or id.
+const (
+	aliveCheckPath     = "/health/alive"
+	readyCheckPath     = "/health/ready"
+	versionPath        = "/version"
+	streamsPath        = "/api/streams"
+	coveragePath       = streamsPath + "/:name/coverage"
+	activityPath       = streamsPath + "/:name/activity"
+	messagePath        = "/api/messages"
+	messageContextPath = messagePath + "/:id/context"
+	searchPath         = "/api/search"
+	usersPath          = "/api/users"
+	userDetailPath     = usersPath + "/:name"
+	userMessagesPath   = usersPath + "/:name/messages"
+	accountPath        = "/api/accounts/:id"
+)
+
+// Text query modes of SearchQuery.
+const (
+	// MatchAll requires every word of the query to appear, in any order.
+	MatchAll = "match"
+	// MatchPhrase requires the words to appear in order.
+	MatchPhrase = "phrase"
+	// MatchPrefix is a phrase match where the last word may be incomplete.
+	MatchPrefix = "prefix"
+	// MatchFuzzy tolerates typos in every word.
+	MatchFuzzy = "fuzzy"
+)
+
+// Channel is a stream with its number of logged messages.
+type Channel struct {
+	Name        string `json:"name"`
+	NumMessages int64  `json:"num_messages_logged"`
+}
+
+// UserCount is a user with its number of logged messages. UserID is empty
+// for logins no account in the directory used.
+type UserCount struct {
+	Name        string `json:"name"`
+	UserID      string `json:"user_id,omitempty"`
+	NumMessages int64  `json:"num_messages_logged"`
+}
+
+// Message is a logged chat message or moderation event.
+type Message struct {
+	ID         string    `json:"Id"`
+	Timestamp  time.Time `json:"Timestamp"`
+	Message    string    `json:"Message"`
+	Channel    string    `json:"Channel"`
+	User       string    `json:"User"`
+	UserID     string    `json:"UserID,omitempty"`
+	Type       string    `json:"Type,omitempty"`
+	Bits       int       `json:"Bits,omitempty"`
+	Emotes     []string  `json:"Emotes,omitempty"`
+	Highlights []string  `json:"Highlights,omitempty"`
+}
+
+// StreamMessagesResponse is a page of ListMessages.
+type StreamMessagesResponse struct {
+	ChannelName string `json:"channel_name"`
+	Next        string `json:"next_page"`
+	Prev        string `json:"prev_page,omitempty"`
+	Messages    []*Message
+}
+
+// MessageContextResponse is a message with the ones sent around it in its channel.
+type MessageContextResponse struct {
+	ChannelName string     `json:"channel_name"`
+	Message     *Message   `json:"message"`
+	Before      []*Message `json:"before"`
+	After       []*Message `json:"after"`
+	Prev        string     `json:"prev_page,omitempty"`
+	Next        string     `json:"next_page,omitempty"`
+}
+
+// SearchResponse is a page of Search.
+type SearchResponse struct {
+	Total    int64      `json:"total"`
+	Next     string     `json:"next_page,omitempty"`
+	Channels []*Channel `json:"channels"`
+	Messages []*Message `json:"messages"`
+}
+
+// Span is a time range of a coverage report.
+type Span struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Workers []string  `json:"workers,omitempty"`
+}
+
+// StreamCoverageResponse tells when a stream was logged, and by which workers.
+type StreamCoverageResponse struct {
+	ChannelName string    `json:"channel_name"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Logged      []Span    `json:"logged"`
+	Unlogged    []Span    `json:"unlogged"`
+	Ratio       float64   `json:"coverage_ratio"`
+}
+
+// ActivityBucket is the chat activity of a stream in one interval.
+type ActivityBucket struct {
+	Time      time.Time `json:"time"`
+	Messages  int64     `json:"messages"`
+	Chatters  int64     `json:"chatters"`
+	Subs      int64     `json:"subs"`
+	BitEvents int64     `json:"bit_events"`
+	Bits      int64     `json:"bits"`
+}
+
+// ChannelActivity is the activity of one stream.
+type ChannelActivity struct {
+	ChannelName string            `json:"channel_name"`
+	Buckets     []*ActivityBucket `json:"buckets"`
+}
+
+// StreamActivityResponse is the activity of the streams asked for.
+type StreamActivityResponse struct {
+	Interval string             `json:"interval"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Channels []*ChannelActivity `json:"channels"`
+}
+
+// NameHistory is a login a user had and when.
+type NameHistory struct {
+	Name        string    `json:"name"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	NumMessages int64     `json:"num_messages_logged"`
+}
+
+// UserSummary describes a user's activity over all logged channels.
+type UserSummary struct {
+	Name        string         `json:"name"`
+	UserID      string         `json:"user_id,omitempty"`
+	CurrentName string         `json:"current_name,omitempty"`
+	FirstSeen   *time.Time     `json:"first_seen"`
+	LastSeen    *time.Time     `json:"last_seen"`
+	NumMessages int64          `json:"num_messages_logged"`
+	Channels    []*Channel     `json:"channels"`
+	Names       []*NameHistory `json:"names"`
+}
+
+// UserMessagesResponse is a page of ListUserMessages.
+type UserMessagesResponse struct {
+	UserName string     `json:"user_name"`
+	UserID   string     `json:"user_id,omitempty"`
+	Next     string     `json:"next_page"`
+	Messages []*Message `json:"messages"`
+}
+
+// Name is a login an account used and when.
+type Name struct {
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Messages  int64     `json:"messages"`
+}
+
+// Account is a twitch account with its name history, oldest name first.
+type Account struct {
+	UserID    string    `json:"user_id"`
+	Login     string    `json:"login"`
+	Names     []*Name   `json:"names"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
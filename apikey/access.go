@@ -0,0 +1,73 @@
+package apikey
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const accessKey contextKey = 0
+
+// Access is what a request may read, as decided by the keyring from its key,
+// or from the anonymous scopes when it has none.
+//
+// A nil Access means the request didn't pass through the keyring, it allows
+// no scope but hides no channel, so handlers still check what they always did.
+type Access struct {
+	// Key is the key the request was made with, nil for anonymous requests.
+	Key *Key
+
+	scopes []string
+	hidden []string
+}
+
+// Allows reports whether the request was granted scope, by its key or
+// because anonymous requests are.
+func (a *Access) Allows(scope string) bool {
+	if a == nil {
+		return false
+	}
+	if a.Key != nil && a.Key.Allows(scope) {
+		return true
+	}
+	for _, s := range a.scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether the request may read the channel.
+func (a *Access) CanRead(channel string) bool {
+	if a == nil {
+		return true
+	}
+	channel = normalize([]string{channel})[0]
+	for _, c := range a.hidden {
+		if c == channel {
+			return false
+		}
+	}
+	return true
+}
+
+// Hidden returns the private channels the request can't read, to be left out
+// of searches and listings.
+func (a *Access) Hidden() []string {
+	if a == nil {
+		return nil
+	}
+	return a.hidden
+}
+
+// WithAccess returns a copy of ctx carrying a.
+func WithAccess(ctx context.Context, a *Access) context.Context {
+	return context.WithValue(ctx, accessKey, a)
+}
+
+// FromContext returns the access of the request ctx belongs to, nil when there is none.
+func FromContext(ctx context.Context) *Access {
+	a, _ := ctx.Value(accessKey).(*Access)
+	return a
+}
@@ -0,0 +1,194 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/pkg/errors"
+)
+
+// Scopes a key can be granted.
+const (
+	// ScopeReadMessages allows reading logged messages, streams and search results.
+	ScopeReadMessages = "read:messages"
+	// ScopeReadUsers allows reading users, their names and activity.
+	ScopeReadUsers = "read:users"
+	// ScopeExport allows bulk exports of logs.
+	ScopeExport = "export"
+	// ScopeAdmin allows everything, including managing alert rules and reading
+	// every private channel.
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every scope.
+var Scopes = []string{ScopeReadMessages, ScopeReadUsers, ScopeExport, ScopeAdmin}
+
+// Sources of keys.
+const (
+	// SourceConfig keys come from API_KEYS and can't be revoked with the apikey command.
+	SourceConfig = "config"
+	// SourceIndex keys are stored in the apikeys index.
+	SourceIndex = "index"
+)
+
+// tokenPrefix starts every generated token, so leaked tokens are easy to grep for.
+const tokenPrefix = "ttvlog_"
+
+var keyID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Key is an API key. Only the hash of its token is kept, the token itself
+// is shown once when the key is created.
+type Key struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+	// Channels are the private channels the key can read, admin keys read all of them.
+	Channels  []string   `json:"channels,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	Source    string     `json:"source"`
+}
+
+// Generate creates a key with a random token, which is returned along with
+// it and can't be recovered later.
+func Generate(name string, scopes, channels []string) (*Key, string, error) {
+	id, err := random(8)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := random(24)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := tokenPrefix + id + "_" + secret
+	k := &Key{
+		ID:        id,
+		Name:      name,
+		Hash:      Hash(token),
+		Scopes:    scopes,
+		Channels:  normalize(channels),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := k.Validate(); err != nil {
+		return nil, "", err
+	}
+	return k, token, nil
+}
+
+// Hash returns the hex encoded SHA-256 of a token. Tokens are long random
+// strings, so a fast hash is enough to keep them from being recovered.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate checks that the key has an id, a hash and only known scopes.
+func (k *Key) Validate() error {
+	if !keyID.MatchString(k.ID) {
+		return errors.Errorf("key id %q must be 1 to 64 letters, digits, dashes or underscores", k.ID)
+	}
+	if len(k.Hash) != sha256.Size*2 {
+		return errors.Errorf("key %s must have the hex encoded SHA-256 of its token as hash", k.ID)
+	}
+	if _, err := hex.DecodeString(k.Hash); err != nil {
+		return errors.Errorf("key %s must have the hex encoded SHA-256 of its token as hash", k.ID)
+	}
+	if len(k.Scopes) == 0 {
+		return errors.Errorf("key %s needs at least one scope", k.ID)
+	}
+	for _, s := range k.Scopes {
+		if !known(s) {
+			return errors.Errorf("unknown scope %q, use one of %s", s, strings.Join(Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// Revoked reports whether the key was revoked.
+func (k *Key) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// Allows reports whether the key was granted scope, admin keys are granted every scope.
+func (k *Key) Allows(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether the key may read the private channel.
+func (k *Key) CanRead(channel string) bool {
+	if k.Allows(ScopeAdmin) {
+		return true
+	}
+	channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+	for _, c := range k.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// FromConfig returns the keys of the config file. ALERT_API_TOKEN, which used
+// to guard the alert rules, is kept working as an admin key.
+func FromConfig(c *config.Config) []*Key {
+	keys := make([]*Key, 0, len(c.APIKeys)+1)
+	for _, k := range c.APIKeys {
+		keys = append(keys, &Key{
+			ID:       k.ID,
+			Name:     k.Name,
+			Hash:     strings.ToLower(k.Hash),
+			Scopes:   k.Scopes,
+			Channels: normalize(k.Channels),
+			Source:   SourceConfig,
+		})
+	}
+	if c.AlertAPIToken != "" {
+		keys = append(keys, &Key{
+			ID:     "alert-api-token",
+			Name:   "ALERT_API_TOKEN",
+			Hash:   Hash(c.AlertAPIToken),
+			Scopes: []string{ScopeAdmin},
+			Source: SourceConfig,
+		})
+	}
+	return keys
+}
+
+func known(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lowercases channel names and drops their leading #.
+func normalize(channels []string) []string {
+	out := make([]string, 0, len(channels))
+	for _, c := range channels {
+		out = append(out, strings.ToLower(strings.TrimPrefix(c, "#")))
+	}
+	return out
+}
+
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate a token: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
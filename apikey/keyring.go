@@ -0,0 +1,119 @@
+package apikey
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Keyring authenticates the keys of the config file and the apikeys index.
+// Stored keys are reloaded periodically, so keys created or revoked with the
+// apikey command take effect without a restart.
+type Keyring struct {
+	store     *Store
+	static    []*Key
+	private   []string
+	anonymous []string
+	l         logrus.FieldLogger
+
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// NewKeyring creates a keyring with the keys, private channels and anonymous
+// scopes of c. store may be nil to only use the keys of the config file.
+func NewKeyring(c *config.Config, store *Store, l logrus.FieldLogger) *Keyring {
+	k := &Keyring{
+		store:   store,
+		private: normalize(c.PrivateChannels),
+		l:       l,
+	}
+	for _, key := range FromConfig(c) {
+		if err := key.Validate(); err != nil {
+			l.WithError(err).Warnln("Skipping invalid API key")
+			continue
+		}
+		k.static = append(k.static, key)
+	}
+	for _, s := range c.APIAnonymousScopes {
+		if !known(s) || s == ScopeAdmin {
+			l.WithField("scope", s).Warnln("Skipping invalid anonymous scope")
+			continue
+		}
+		k.anonymous = append(k.anonymous, s)
+	}
+	k.setKeys(nil)
+	return k
+}
+
+// Reload reloads the stored keys.
+func (k *Keyring) Reload(ctx context.Context) error {
+	if k.store == nil {
+		return nil
+	}
+
+	stored, err := k.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	k.setKeys(stored)
+	return nil
+}
+
+func (k *Keyring) setKeys(stored []*Key) {
+	keys := map[string]*Key{}
+	for _, key := range append(append([]*Key{}, k.static...), stored...) {
+		keys[key.Hash] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = keys
+}
+
+// Run reloads the stored keys every interval until ctx is done. Call Reload
+// first, so keys work as soon as the server starts.
+func (k *Keyring) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		if err := k.Reload(ctx); err != nil {
+			k.l.WithError(err).Warnln("Could not reload API keys")
+		}
+	}
+}
+
+// Authenticate returns the key of a token.
+func (k *Keyring) Authenticate(token string) (*Key, error) {
+	k.mu.RLock()
+	key, ok := k.keys[Hash(token)]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.New("invalid API key")
+	}
+	if key.Revoked() {
+		return nil, errors.Errorf("API key %s was revoked", key.ID)
+	}
+	return key, nil
+}
+
+// Access returns what requests made with key may read, key is nil for
+// anonymous requests.
+func (k *Keyring) Access(key *Key) *Access {
+	a := &Access{Key: key, scopes: k.anonymous}
+	for _, c := range k.private {
+		if key == nil || !key.CanRead(c) {
+			a.hidden = append(a.hidden, c)
+		}
+	}
+	return a
+}
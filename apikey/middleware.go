@@ -0,0 +1,106 @@
+package apikey
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ServeHTTP makes the keyring a negroni middleware. It authenticates the
+// bearer token of the request, if any, checks that the request was granted
+// the scopes its path requires and may read the channels it names, and passes
+// the access on in the request context for handlers to hide private channels.
+func (k *Keyring) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	var key *Key
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		var err error
+		if key, err = k.Authenticate(strings.TrimPrefix(auth, "Bearer ")); err != nil {
+			unauthorized(rw, err.Error())
+			return
+		}
+	}
+
+	a := k.Access(key)
+	for _, scope := range RequiredScopes(r.URL.Path) {
+		if a.Allows(scope) {
+			continue
+		}
+		if key == nil {
+			unauthorized(rw, fmt.Sprintf("an API key with the %s scope is required", scope))
+		} else {
+			http.Error(rw, fmt.Sprintf("API key %s lacks the %s scope", key.ID, scope), http.StatusForbidden)
+		}
+		return
+	}
+
+	for _, channel := range requestedChannels(r) {
+		if a.CanRead(channel) {
+			continue
+		}
+		if key == nil {
+			unauthorized(rw, fmt.Sprintf("channel %s is private", channel))
+		} else {
+			http.Error(rw, fmt.Sprintf("API key %s can't read channel %s", key.ID, channel), http.StatusForbidden)
+		}
+		return
+	}
+
+	next(rw, r.WithContext(WithAccess(r.Context(), a)))
+}
+
+func unauthorized(rw http.ResponseWriter, message string) {
+	rw.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(rw, message, http.StatusUnauthorized)
+}
+
+// RequiredScopes returns the scopes a request to path needs. Health checks,
+// the OpenAPI document and static files need none.
+func RequiredScopes(path string) []string {
+	switch {
+	case path == "/api/openapi.json":
+		return nil
+	case strings.HasPrefix(path, "/api/alerts/"):
+		return []string{ScopeAdmin}
+	case path == "/api/export":
+		return []string{ScopeExport}
+	case path == "/api/graphql":
+		return []string{ScopeReadMessages, ScopeReadUsers}
+	case strings.HasPrefix(path, "/api/users/") && strings.HasSuffix(path, "/messages"),
+		strings.HasPrefix(path, "/users/"):
+		return []string{ScopeReadUsers, ScopeReadMessages}
+	case path == "/api/users", strings.HasPrefix(path, "/api/users/"), strings.HasPrefix(path, "/api/accounts/"):
+		return []string{ScopeReadUsers}
+	case strings.HasPrefix(path, "/api/"), path == "/", path == "/search", strings.HasPrefix(path, "/channels/"):
+		return []string{ScopeReadMessages}
+	}
+	return nil
+}
+
+// requestedChannels returns the channels a request names in its path or query.
+// Requests for private channels are rejected up front, the handlers leave them
+// out of requests that don't name channels.
+func requestedChannels(r *http.Request) []string {
+	var names []string
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, "/api/streams/"):
+		name := strings.SplitN(strings.TrimPrefix(path, "/api/streams/"), "/", 2)[0]
+		names = append(names, name)
+	case strings.HasPrefix(path, "/channels/"):
+		names = append(names, strings.TrimPrefix(path, "/channels/"))
+	}
+
+	queryValues := r.URL.Query()
+	for _, key := range []string{"channel", "stream", "compare"} {
+		names = append(names, queryValues[key]...)
+	}
+
+	var channels []string
+	for _, v := range names {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				channels = append(channels, c)
+			}
+		}
+	}
+	return normalize(channels)
+}
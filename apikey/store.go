@@ -0,0 +1,111 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+)
+
+// Index holds the keys created with the apikey command.
+const Index = "apikeys"
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"id":{
+				"type":"keyword"
+			},
+			"name":{
+				"type":"keyword"
+			},
+			"hash":{
+				"type":"keyword"
+			},
+			"scopes":{
+				"type":"keyword"
+			},
+			"channels":{
+				"type":"keyword"
+			},
+			"created_at":{
+				"type":"date"
+			},
+			"revoked_at":{
+				"type":"date"
+			}
+		}
+	}
+}`
+
+// Store keeps the keys created with the apikey command.
+type Store struct {
+	connector *config.ElasticConnector
+}
+
+// NewStore creates the apikeys index if it doesn't exist yet.
+func NewStore(connector *config.ElasticConnector) (*Store, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+	return &Store{connector: connector}, nil
+}
+
+// List returns every stored key, revoked ones included.
+func (s *Store) List(ctx context.Context) ([]*Key, error) {
+	sr, err := s.connector.GetClient().Search().Index(Index).Sort("created_at", true).Size(10000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{}
+	for _, hit := range sr.Hits.Hits {
+		k := &Key{}
+		if err := json.Unmarshal(hit.Source, k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Get returns the key with id, ok is false when there is none.
+func (s *Store) Get(ctx context.Context, id string) (key *Key, ok bool, err error) {
+	res, err := s.connector.GetClient().Get().Index(Index).Id(id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	key = &Key{}
+	err = json.Unmarshal(res.Source, key)
+	return key, err == nil, err
+}
+
+// Put creates or replaces a key.
+func (s *Store) Put(ctx context.Context, k *Key) error {
+	k.Source = SourceIndex
+	_, err := s.connector.GetClient().Index().Index(Index).Id(k.ID).BodyJson(k).Refresh("true").Do(ctx)
+	return err
+}
+
+// Revoke marks a key as revoked, ok is false when there is none. Revoked keys
+// are kept so they show up in the key list.
+func (s *Store) Revoke(ctx context.Context, id string) (bool, error) {
+	k, ok, err := s.Get(ctx, id)
+	if err != nil || !ok {
+		return false, err
+	}
+	if k.Revoked() {
+		return true, nil
+	}
+
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	return true, s.Put(ctx, k)
+}
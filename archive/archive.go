@@ -0,0 +1,33 @@
+package archive
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Extension is the extension of archive files.
+const Extension = ".irc.gz"
+
+// FormatLine returns the archived form of a raw IRC line, the receive time in
+// unix milliseconds followed by the line exactly as twitch sent it.
+func FormatLine(at time.Time, raw string) string {
+	return strconv.FormatInt(at.UnixNano()/int64(time.Millisecond), 10) + " " + raw
+}
+
+// ParseLine splits an archived line into its receive time and the raw IRC line.
+func ParseLine(s string) (time.Time, string, error) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return time.Time{}, "", errors.New("archive line has no receive time")
+	}
+
+	ms, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.Wrap(err, "invalid receive time")
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC(), s[i+1:], nil
+}
@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flushInterval bounds how much of the archive is lost when the process dies
+const flushInterval = 10 * time.Second
+
+// Writer appends raw IRC lines to gzip compressed files in a directory. A new
+// file is started every rotate interval and whenever maxSize compressed bytes
+// were written to the current one.
+type Writer struct {
+	dir     string
+	prefix  string
+	rotate  time.Duration
+	maxSize int64
+	l       logrus.FieldLogger
+
+	mu     sync.Mutex
+	f      *os.File
+	gz     *gzip.Writer
+	size   *countingWriter
+	opened time.Time
+}
+
+// NewWriter creates a writer for files named "<prefix>-20060102T150405Z.irc.gz" in dir.
+// A zero rotate or maxSize disables that limit.
+func NewWriter(dir, prefix string, rotate time.Duration, maxSize int64, l logrus.FieldLogger) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		dir:     dir,
+		prefix:  prefix,
+		rotate:  rotate,
+		maxSize: maxSize,
+		l:       l,
+	}, nil
+}
+
+// Write archives a raw line received at the given time.
+func (w *Writer) Write(at time.Time, raw string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.gz != nil && w.full(at) {
+		if err := w.close(); err != nil {
+			w.l.WithError(err).Errorln("Could not close raw archive file")
+		}
+	}
+	if w.gz == nil {
+		if err := w.open(at); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.gz.Write([]byte(FormatLine(at, raw) + "\n"))
+	return err
+}
+
+func (w *Writer) full(at time.Time) bool {
+	if w.rotate > 0 && at.Sub(w.opened) >= w.rotate {
+		return true
+	}
+	return w.maxSize > 0 && w.size.n >= w.maxSize
+}
+
+func (w *Writer) open(at time.Time) error {
+	name := fmt.Sprintf("%s-%s%s", w.prefix, at.UTC().Format("20060102T150405Z"), Extension)
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	w.f = f
+	w.size = &countingWriter{w: f}
+	w.gz = gzip.NewWriter(w.size)
+	w.opened = at
+	return nil
+}
+
+func (w *Writer) close() error {
+	gz, f := w.gz, w.f
+	w.gz, w.f = nil, nil
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Run flushes the current file regularly until ctx is done, then closes it.
+func (w *Writer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(flushInterval):
+			w.mu.Lock()
+			if w.gz != nil {
+				if err := w.gz.Flush(); err != nil {
+					w.l.WithError(err).Errorln("Could not flush raw archive")
+				}
+			}
+			w.mu.Unlock()
+		case <-ctx.Done():
+			if err := w.Close(); err != nil {
+				w.l.WithError(err).Errorln("Could not close raw archive file")
+			}
+			return
+		}
+	}
+}
+
+// Close finishes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.gz == nil {
+		return nil
+	}
+	return w.close()
+}
+
+// countingWriter counts the compressed bytes written to the current file.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,92 @@
+// Package client serves the web client built into the binary, or a directory
+// given with --client-dir. Build the client before the binary to include it:
+//
+//	cd client && yarn build && cd .. && go build
+package client
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Path is where the client is mounted, it is built with this as homepage.
+const Path = "/app"
+
+// FileSystem returns dir when it is set, the embedded build otherwise.
+func FileSystem(dir string) http.FileSystem {
+	if dir != "" {
+		return http.Dir(dir)
+	}
+	return embeddedFileSystem()
+}
+
+// Handler serves the client below Path. Paths without a file are history
+// routes of the single page app and get index.html. Build assets have a
+// content hash in their name and are cached for good, everything else is
+// revalidated.
+type Handler struct {
+	fs      http.FileSystem
+	started time.Time
+}
+
+// NewHandler serves the files of fs.
+func NewHandler(fs http.FileSystem) *Handler {
+	return &Handler{fs: fs, started: time.Now()}
+}
+
+// ServeHTTP implements negroni.Handler, passing requests outside of Path on to next.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		next(rw, r)
+		return
+	}
+	if r.URL.Path == Path {
+		http.Redirect(rw, r, Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, Path+"/") {
+		next(rw, r)
+		return
+	}
+
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, Path))
+	if name != "/" && h.serveFile(rw, r, name) {
+		return
+	}
+	if strings.HasPrefix(name, "/static/") {
+		// A missing asset must not turn into the app
+		http.NotFound(rw, r)
+		return
+	}
+	if !h.serveFile(rw, r, "/index.html") {
+		http.Error(rw, "the web client was not built, run yarn build in client/", http.StatusNotFound)
+	}
+}
+
+func (h *Handler) serveFile(rw http.ResponseWriter, r *http.Request, name string) bool {
+	f, err := h.fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	modified := info.ModTime()
+	if modified.IsZero() {
+		// Embedded files have no modification time, use the start of the server for If-Modified-Since
+		modified = h.started
+	}
+	if strings.HasPrefix(name, "/static/") {
+		rw.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		rw.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeContent(rw, r, info.Name(), modified, f)
+	return true
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// placeholder is served instead of the client when the binary was built without it.
+//
+//go:embed placeholder
+var placeholder embed.FS
+
+func embedded() fs.FS {
+	if Built() {
+		return built()
+	}
+	sub, err := fs.Sub(placeholder, "placeholder")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Built reports whether the binary contains a build of the client, not just the placeholder.
+func Built() bool {
+	b := built()
+	if b == nil {
+		return false
+	}
+	_, err := fs.Stat(b, "asset-manifest.json")
+	return err == nil
+}
+
+func embeddedFileSystem() http.FileSystem {
+	return http.FS(embedded())
+}
@@ -0,0 +1,22 @@
+//go:build client
+// +build client
+
+package client
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// build holds client/build as it was when the binary was built with the client tag.
+//
+//go:embed build
+var build embed.FS
+
+func built() fs.FS {
+	sub, err := fs.Sub(build, "build")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
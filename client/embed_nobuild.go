@@ -0,0 +1,11 @@
+//go:build !client
+// +build !client
+
+package client
+
+import "io/fs"
+
+// built returns nil, binaries built without the client tag only have the placeholder.
+func built() fs.FS {
+	return nil
+}
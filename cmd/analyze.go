@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/djdduty/ttv-log/analysis"
+	"github.com/djdduty/ttv-log/cmd/analyzer"
+	"github.com/djdduty/ttv-log/graph"
+	"github.com/spf13/cobra"
+)
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Analyze the logged chat",
+}
+
+var highlightOptions = &analyzer.HighlightOptions{}
+
+var highlightsCmd = &cobra.Command{
+	Use:   "highlights",
+	Short: "Detect bursts of chat activity and store them as highlights",
+	Long: `Compares the message rate of every channel to its rolling baseline and stores
+the intervals far above it as highlights, together with the phrases, words and
+emotes that dominated them. The highlights are served at
+/api/streams/:name/highlights.
+
+  ttv-log analyze highlights --since 168h
+  ttv-log analyze highlights --watch --channel xqcow`,
+	Run: analyzer.RunHighlights(c, highlightOptions),
+}
+
+var spamOptions = &analyzer.SpamOptions{}
+
+var spamCmd = &cobra.Command{
+	Use:   "spam",
+	Short: "Cluster copypastas and spam as messages come in",
+	Long: `Follows the ingested messages of every channel and groups near-duplicates,
+recording which users and channels posted each group and when. Groups posted
+by many users are copypastas, groups repeated by the same accounts or spread
+over many channels are spam. They are served at /api/copypastas and
+/api/spam/clusters.`,
+	Run: analyzer.RunSpam(c, spamOptions),
+}
+
+var overlapOptions = &analyzer.OverlapOptions{}
+
+var overlapCmd = &cobra.Command{
+	Use:   "overlap",
+	Short: "Compute which channels share chatters",
+	Long: `Collects the unique chatters of every channel over a window and scores each
+pair of channels by the Jaccard index of their chatters. The most related
+channels of each channel are stored and served at /api/streams/:name/related,
+and the whole network can be written as a graph for Gephi or Cytoscape.
+
+  ttv-log analyze overlap --since 720h --approximate
+  ttv-log analyze overlap --dry-run -o overlap.graphml`,
+	Run: analyzer.RunOverlap(c, overlapOptions),
+}
+
+var raidOptions = &analyzer.RaidOptions{}
+
+var raidsCmd = &cobra.Command{
+	Use:   "raids",
+	Short: "Store the logged raids and export the raid network",
+	Long: `Bots store every raid they see in the raids index. This stores the raids found
+in the logged messages as well, e.g. imported or replayed ones, and writes
+the network of channels raiding each other as a graph for Gephi or Cytoscape.
+Raids are served at /api/streams/:name/raids and /api/streams/:name/raids/top.
+
+  ttv-log analyze raids --since 8760h
+  ttv-log analyze raids -o raids.graphml`,
+	Run: analyzer.RunRaids(c, raidOptions),
+}
+
+var userOptions = &analyzer.UserOptions{}
+
+var usersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "Track which login names every twitch account used",
+	Long: `Rebuilds the name history of every account that sent messages in the window,
+keyed on its twitch user id, so renamed users keep their history and names
+reused by another account aren't merged into it. User endpoints resolve logins
+through the directory, and histories are served at /api/accounts/:id.
+
+  ttv-log analyze users --since 87600h
+  ttv-log analyze users --watch`,
+	Run: analyzer.RunUsers(c, userOptions),
+}
+
+func init() {
+	RootCmd.AddCommand(analyzeCmd)
+	analyzeCmd.AddCommand(highlightsCmd)
+
+	flags := highlightsCmd.PersistentFlags()
+	flags.StringSliceVar(&highlightOptions.Channels, "channel", nil, "Channels to analyze, defaults to every channel with messages.")
+	flags.DurationVar(&highlightOptions.Since, "since", 24*time.Hour, "How far back to look for highlights.")
+	flags.BoolVar(&highlightOptions.Watch, "watch", false, "Keep analyzing new messages.")
+	flags.DurationVar(&highlightOptions.Every, "every", time.Minute, "How often to analyze new messages with --watch.")
+	flags.DurationVar(&highlightOptions.Interval, "interval", 30*time.Second, "Length of the intervals message rates are compared in.")
+	flags.Float64Var(&highlightOptions.Threshold, "threshold", 3, "Standard deviations above the baseline an interval must reach.")
+	flags.Float64Var(&highlightOptions.MinRatio, "min-ratio", 2, "Times the baseline rate an interval must reach.")
+
+	analyzeCmd.AddCommand(spamCmd)
+	flags = spamCmd.PersistentFlags()
+	flags.DurationVar(&spamOptions.Every, "every", 10*time.Second, "How often changed clusters are stored.")
+	flags.IntVar(&spamOptions.MinLength, "min-length", 30, "Characters a message needs to be considered.")
+	flags.IntVar(&spamOptions.MaxDistance, "max-distance", 3, "Simhash bits near-duplicates may differ in, 0 to 3.")
+
+	analyzeCmd.AddCommand(overlapCmd)
+	flags = overlapCmd.PersistentFlags()
+	flags.StringSliceVar(&overlapOptions.Channels, "channel", nil, "Channels to compare, defaults to every channel with messages.")
+	flags.DurationVar(&overlapOptions.Since, "since", 7*24*time.Hour, "Window to collect chatters in.")
+	flags.BoolVar(&overlapOptions.Approximate, "approximate", false, "Count chatters with HyperLogLog sketches instead of exact sets.")
+	flags.Int64Var(&overlapOptions.MinShared, "min-shared", 5, "Chatters two channels must share to be related.")
+	flags.IntVar(&overlapOptions.Top, "top", 25, "Related channels stored per channel.")
+	flags.StringSliceVar(&overlapOptions.Ignore, "ignore-user", analysis.DefaultIgnoredChatters, "Chatters to leave out, e.g. bots.")
+	flags.StringVarP(&overlapOptions.Output, "output", "o", "", "Write the channel graph to this file, - for stdout.")
+	flags.StringVar(&overlapOptions.GraphFormat, "graph-format", graph.FormatGraphML, "Format of the graph, graphml or json.")
+	flags.BoolVar(&overlapOptions.DryRun, "dry-run", false, "Don't store the results.")
+
+	analyzeCmd.AddCommand(raidsCmd)
+	flags = raidsCmd.PersistentFlags()
+	flags.DurationVar(&raidOptions.Since, "since", 30*24*time.Hour, "How far back to look for raids.")
+	flags.StringVarP(&raidOptions.Output, "output", "o", "", "Write the raid graph to this file, - for stdout.")
+	flags.StringVar(&raidOptions.GraphFormat, "graph-format", graph.FormatGraphML, "Format of the graph, graphml or json.")
+
+	analyzeCmd.AddCommand(usersCmd)
+	flags = usersCmd.PersistentFlags()
+	flags.DurationVar(&userOptions.Since, "since", 24*time.Hour, "Update the accounts seen within this window.")
+	flags.BoolVar(&userOptions.Watch, "watch", false, "Keep updating the accounts of new messages.")
+	flags.DurationVar(&userOptions.Every, "every", 10*time.Minute, "How often to update with --watch.")
+}
@@ -0,0 +1,338 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/djdduty/ttv-log/analysis"
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/directory"
+	"github.com/djdduty/ttv-log/graph"
+	"github.com/djdduty/ttv-log/live"
+	"github.com/djdduty/ttv-log/raid"
+	"github.com/djdduty/ttv-log/spam"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// maxChannels is the number of busiest channels analyzed when none are given
+const maxChannels = 1000
+
+// HighlightOptions are the flags of the highlights command.
+type HighlightOptions struct {
+	Channels  []string
+	Since     time.Duration
+	Watch     bool
+	Every     time.Duration
+	Threshold float64
+	MinRatio  float64
+	Interval  time.Duration
+}
+
+// RunHighlights detects chat bursts and stores them as highlights
+func RunHighlights(c *config.Config, o *HighlightOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		runHighlights(c, o)
+	}
+}
+
+func runHighlights(c *config.Config, o *HighlightOptions) {
+	l := c.GetLogger()
+	ctx := signalContext(l)
+
+	detector, err := analysis.NewDetector(c.Context().ElasticConnection)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up the highlight index")
+	}
+	detector.Threshold = o.Threshold
+	detector.MinRatio = o.MinRatio
+	detector.Interval = o.Interval
+
+	to := time.Now().UTC()
+	from := to.Add(-o.Since)
+	for {
+		detect(ctx, c, detector, o.Channels, from, to)
+		if !o.Watch {
+			return
+		}
+
+		select {
+		case <-time.After(o.Every):
+		case <-ctx.Done():
+			return
+		}
+		// Look back over the last run as well, bursts that were still going on get extended
+		to = time.Now().UTC()
+		from = to.Add(-o.Every - detector.Window)
+	}
+}
+
+func detect(ctx context.Context, c *config.Config, detector *analysis.Detector, channels []string, from, to time.Time) {
+	l := c.GetLogger()
+
+	if len(channels) == 0 {
+		var err error
+		channels, err = analysis.ActiveChannels(ctx, c.Context().ElasticConnection.GetClient(), from, to, maxChannels)
+		if err != nil {
+			l.WithError(err).Errorln("Could not list active channels")
+			return
+		}
+	}
+
+	found := 0
+	for _, channel := range channels {
+		if ctx.Err() != nil {
+			return
+		}
+
+		highlights, err := detector.Detect(ctx, channel, from, to)
+		if err == nil {
+			err = detector.Save(ctx, highlights)
+		}
+		if err != nil {
+			l.WithError(err).Errorf("Could not detect highlights of %s", channel)
+			continue
+		}
+		for _, h := range highlights {
+			l.Debugf("Highlight in %s at %s, %.0f messages per minute, %.1f times the baseline", channel, h.Peak, h.PeakRate, h.Score)
+		}
+		found += len(highlights)
+	}
+
+	l.Infof("Found %d highlights in %d channels between %s and %s", found, len(channels), from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM.
+func signalContext(l logrus.FieldLogger) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		l.Infof("Received %s, stopping analysis", sig)
+		cancel()
+	}()
+	return ctx
+}
+
+// SpamOptions are the flags of the spam command.
+type SpamOptions struct {
+	Every       time.Duration
+	MinLength   int
+	MaxDistance int
+}
+
+// RunSpam follows the ingested messages and clusters copypastas and spam
+func RunSpam(c *config.Config, o *SpamOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		runSpam(c, o)
+	}
+}
+
+func runSpam(c *config.Config, o *SpamOptions) {
+	l := c.GetLogger()
+	ctx := signalContext(l)
+
+	detector, err := spam.NewDetector(c.Context().ElasticConnection, l)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up the spam index")
+	}
+	detector.MinLength = o.MinLength
+	if o.MaxDistance < 0 || o.MaxDistance > 3 {
+		l.Fatalln("--max-distance must be between 0 and 3")
+	}
+	detector.MaxDistance = o.MaxDistance
+
+	broker := live.NewBroker()
+	sub := broker.Subscribe(live.AllChannels, 10000)
+	defer sub.Close()
+	go live.NewTailer(c.Context().ElasticConnection, broker, time.Second, 10*time.Second, l).Run(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		detector.Run(ctx, o.Every)
+	}()
+
+	l.Infoln("Clustering copypastas and spam")
+	hook := detector.Hook()
+	for {
+		select {
+		case e := <-sub.C:
+			hook(e.ID, e.Message)
+		case <-ctx.Done():
+			<-done
+			return
+		}
+	}
+}
+
+// OverlapOptions are the flags of the overlap command.
+type OverlapOptions struct {
+	Channels    []string
+	Since       time.Duration
+	Approximate bool
+	MinShared   int64
+	Top         int
+	Ignore      []string
+	Output      string
+	GraphFormat string
+	DryRun      bool
+}
+
+// RunOverlap computes which channels share chatters
+func RunOverlap(c *config.Config, o *OverlapOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		runOverlap(c, o)
+	}
+}
+
+func runOverlap(c *config.Config, o *OverlapOptions) {
+	l := c.GetLogger()
+	if err := graph.CheckFormat(o.GraphFormat); o.Output != "" && err != nil {
+		l.WithError(err).Fatalln("Invalid --graph-format")
+	}
+	ctx := signalContext(l)
+
+	overlapper, err := analysis.NewOverlapper(c.Context().ElasticConnection)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up the overlap index")
+	}
+	overlapper.Approximate = o.Approximate
+	overlapper.MinShared = o.MinShared
+	overlapper.Top = o.Top
+	overlapper.Ignore = o.Ignore
+
+	to := time.Now().UTC()
+	from := to.Add(-o.Since)
+	overlaps, err := overlapper.Compute(ctx, o.Channels, from, to)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not compute the channel overlap")
+	}
+	l.Infof("Computed the overlap of %d channels between %s and %s", len(overlaps), from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	if !o.DryRun {
+		if err := overlapper.Save(ctx, overlaps); err != nil {
+			l.WithError(err).Fatalln("Could not store the channel overlap")
+		}
+	}
+
+	if o.Output == "" {
+		return
+	}
+	out := os.Stdout
+	if o.Output != "-" {
+		if out, err = os.Create(o.Output); err != nil {
+			l.WithError(err).Fatalln("Could not create the graph file")
+		}
+		defer out.Close()
+	}
+	if err := analysis.OverlapGraph(overlaps).Write(out, o.GraphFormat); err != nil {
+		l.WithError(err).Fatalln("Could not write the graph")
+	}
+}
+
+// RaidOptions are the flags of the raids command.
+type RaidOptions struct {
+	Since       time.Duration
+	Output      string
+	GraphFormat string
+}
+
+// RunRaids stores the logged raids and exports the raid network
+func RunRaids(c *config.Config, o *RaidOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		runRaids(c, o)
+	}
+}
+
+func runRaids(c *config.Config, o *RaidOptions) {
+	l := c.GetLogger()
+	if err := graph.CheckFormat(o.GraphFormat); o.Output != "" && err != nil {
+		l.WithError(err).Fatalln("Invalid --graph-format")
+	}
+	ctx := signalContext(l)
+
+	store, err := raid.NewStore(ctx, c.Context().ElasticConnection, l)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up the raids index")
+	}
+	defer store.Close()
+
+	to := time.Now().UTC()
+	from := to.Add(-o.Since)
+	n, err := store.Backfill(ctx, from, to)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not store the logged raids")
+	}
+	l.Infof("Stored %d raids between %s and %s, %d failed", n, from.Format(time.RFC3339), to.Format(time.RFC3339), store.Failed())
+
+	if o.Output == "" {
+		return
+	}
+	g, err := raid.Graph(ctx, c.Context().ElasticConnection.GetClient(), from, to)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not read the raid network")
+	}
+
+	out := os.Stdout
+	if o.Output != "-" {
+		if out, err = os.Create(o.Output); err != nil {
+			l.WithError(err).Fatalln("Could not create the graph file")
+		}
+		defer out.Close()
+	}
+	if err := g.Write(out, o.GraphFormat); err != nil {
+		l.WithError(err).Fatalln("Could not write the graph")
+	}
+}
+
+// UserOptions are the flags of the users command.
+type UserOptions struct {
+	Since time.Duration
+	Watch bool
+	Every time.Duration
+}
+
+// RunUsers updates the user directory from the logged messages
+func RunUsers(c *config.Config, o *UserOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		runUsers(c, o)
+	}
+}
+
+func runUsers(c *config.Config, o *UserOptions) {
+	l := c.GetLogger()
+	ctx := signalContext(l)
+
+	syncer, err := directory.NewSyncer(c.Context().ElasticConnection)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up the users index")
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-o.Since)
+	for {
+		n, err := syncer.Sync(ctx, from, to)
+		if err != nil && ctx.Err() == nil {
+			l.WithError(err).Errorln("Could not update the user directory")
+		} else {
+			l.Infof("Updated %d users seen between %s and %s", n, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		}
+		if !o.Watch {
+			return
+		}
+
+		select {
+		case <-time.After(o.Every):
+		case <-ctx.Done():
+			return
+		}
+		// Bots flush in batches, look back a little to catch late messages
+		from = to.Add(-time.Minute)
+		to = time.Now().UTC()
+	}
+}
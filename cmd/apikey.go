@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/cmd/keymanager"
+	"github.com/spf13/cobra"
+)
+
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage the API keys of the server",
+}
+
+var createKeyOptions = &keymanager.CreateOptions{}
+
+var createKeyCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key",
+	Long: `Creates an API key and prints its token, which is shown only this once. Only
+the SHA-256 of the token is stored, in the apikeys index, and running servers
+pick the key up within API_KEY_RELOAD_INTERVAL. With --config the key isn't
+stored but printed as an API_KEYS entry for the config file instead.
+
+Keys list the private channels of PRIVATE_CHANNELS they can read with
+--channel, admin keys read every channel.
+
+  ttv-log apikey create --name dashboard --scope read:messages --scope read:users
+  ttv-log apikey create --name mods --scope read:messages --channel djdduty --config`,
+	Args: cobra.NoArgs,
+	Run:  keymanager.RunCreate(c, createKeyOptions),
+}
+
+var listKeysCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stored API keys",
+	Args:  cobra.NoArgs,
+	Run:   keymanager.RunList(c),
+}
+
+var revokeKeyCmd = &cobra.Command{
+	Use:   "revoke <id>...",
+	Short: "Revoke stored API keys",
+	Long: `Revokes stored API keys, running servers reject them within
+API_KEY_RELOAD_INTERVAL. Keys of the config file are revoked by removing them
+from API_KEYS.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  keymanager.RunRevoke(c),
+}
+
+func init() {
+	RootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(createKeyCmd)
+	apikeyCmd.AddCommand(listKeysCmd)
+	apikeyCmd.AddCommand(revokeKeyCmd)
+
+	flags := createKeyCmd.PersistentFlags()
+	flags.StringVar(&createKeyOptions.Name, "name", "", "What the key is used for.")
+	flags.StringSliceVar(&createKeyOptions.Scopes, "scope", nil, fmt.Sprintf("Scopes of the key, one of %s, can be repeated.", strings.Join(apikey.Scopes, ", ")))
+	flags.StringSliceVar(&createKeyOptions.Channels, "channel", nil, "Private channels the key can read, can be repeated.")
+	flags.BoolVar(&createKeyOptions.Config, "config", false, "Print an API_KEYS entry for the config file instead of storing the key.")
+}
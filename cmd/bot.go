@@ -14,4 +14,6 @@ var botCmd = &cobra.Command{
 
 func init() {
 	RootCmd.AddCommand(botCmd)
+
+	botCmd.PersistentFlags().StringVar(&c.WorkerID, "worker", "", "Join the channels the dispatcher assigned to this worker id instead of discovering streams.")
 }
@@ -1,44 +1,25 @@
 package bot
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/djdduty/ttv-log/alert"
+	"github.com/djdduty/ttv-log/archive"
 	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/coverage"
+	"github.com/djdduty/ttv-log/dispatch"
 	"github.com/djdduty/ttv-log/irc"
+	"github.com/djdduty/ttv-log/raid"
+	"github.com/djdduty/ttv-log/twitch"
 	"github.com/spf13/cobra"
 )
 
-type channel struct {
-	Name string `json:"name"`
-}
-
-type stream struct {
-	Channel channel `json:"channel"`
-}
-
-type streamResponse struct {
-	Total   int      `json:"_total"`
-	Streams []stream `json:"streams"`
-}
-
-// AppendIfMissing adds element to slice if missing
-func AppendIfMissing(slice []string, val string) []string {
-	for _, ele := range slice {
-		if ele == val {
-			return slice
-		}
-	}
-	return append(slice, val)
-}
-
 // RunBot starts the elastic goroutine to start queue flush and the IRC bot
 func RunBot(c *config.Config) func(cmd *cobra.Command, args []string) {
 	return func(cmd *cobra.Command, args []string) {
@@ -47,57 +28,101 @@ func RunBot(c *config.Config) func(cmd *cobra.Command, args []string) {
 }
 
 func run(config *config.Config) {
-	// Start by getting the top 500 streams currently live, won't come out to exactly 500 thanks to duplicates
-	url := "https://api.twitch.tv/kraken/streams/"
-	httpClient := http.Client{
-		Timeout: time.Second * 30, // Maximum of 2 secs
+	config.RequireTwitchLogin()
+
+	streams, err := channels(config)
+	if err != nil {
+		log.Fatal(err)
 	}
-	streams := []string{}
-	streams = append(streams, config.StreamWhilelist...)
-	numStreams := 1000
+	fmt.Printf("Got list of %d streams\n", len(streams))
 
-	for i := 0; i < numStreams/100; i = i + 1 {
-		offset := i * 100
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?limit=100&offset=%d", url, offset), nil)
-		if err != nil {
-			log.Fatal(err)
-		}
+	sigs := make(chan os.Signal, 1)
 
-		req.Header.Set("Accept", "application/vnd.twitchtv.v5+json")
-		req.Header.Set("Client-ID", config.TwitchClientID)
+	//signal.Notify registers the given channel to receive notifications of the specified signals.
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
-		res, getErr := httpClient.Do(req)
-		if getErr != nil {
-			log.Fatal(getErr)
-		}
+	alertStore, err := alert.NewStore(config.Context().ElasticConnection)
+	if err != nil {
+		panic(err)
+	}
+	alerts := alert.NewEngine(config, alertStore, config.GetLogger())
 
-		body, readErr := ioutil.ReadAll(res.Body)
-		if readErr != nil {
-			log.Fatal(readErr)
-		}
+	raids, err := raid.NewStore(context.Background(), config.Context().ElasticConnection, config.GetLogger())
+	if err != nil {
+		panic(err)
+	}
+	defer raids.Close()
 
-		streamData := streamResponse{}
-		jsonErr := json.Unmarshal(body, &streamData)
-		if jsonErr != nil {
-			log.Fatal(jsonErr)
-		}
+	messageChan, quitChan, err := irc.CreateElasticFlusher(config.Context().ElasticConnection, 1*time.Second, config.DedupWindow, alerts.Hook(), raids.Hook())
 
-		for _, stream := range streamData.Streams {
-			streams = AppendIfMissing(streams, stream.Channel.Name)
-		}
+	if err != nil {
+		panic(err)
 	}
-	fmt.Printf("Got list of %d streams\n", len(streams))
 
-	sigs := make(chan os.Signal, 1)
-
-	//signal.Notify registers the given channel to receive notifications of the specified signals.
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	emotes, err := irc.LoadEmoteSet(config.EmoteFile)
+	if err != nil {
+		config.GetLogger().WithError(err).Fatalln("Could not load EMOTE_FILE")
+	}
 
-	messageChan, quitChan, err := irc.CreateElasticFlusher(config.Context().ElasticConnection, 1*time.Second)
+	// Third-party emotes are tagged between the parser and the flusher
+	parsedChan := make(chan irc.Message)
+	go func() {
+		for message := range parsedChan {
+			emotes.Tag(&message)
+			messageChan <- message
+		}
+	}()
 
+	recorder, err := coverage.NewRecorder(config.Context().ElasticConnection, workerName(config), coverage.Heartbeat, config.GetLogger())
 	if err != nil {
 		panic(err)
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan struct{})
+	go func() {
+		recorder.Run(ctx)
+		close(recorded)
+	}()
+	go alerts.Run(ctx, config.AlertReloadInterval)
+
+	var updates <-chan []string
+	if config.WorkerID != "" {
+		store, err := dispatch.NewStore(config)
+		if err != nil {
+			panic(err)
+		}
+		updates = dispatch.Watch(ctx, store, config.WorkerID, streams, config.DispatchWatchInterval, config.GetLogger())
+
+		// Replicas of a channel leave its alerts to the primary
+		assignments, err := store.Load(ctx)
+		if err != nil {
+			panic(err)
+		}
+		primary := assignments.Primary(config.WorkerID)
+		alerts.EvaluateOnly(primary)
+		go func() {
+			for channels := range dispatch.WatchPrimary(ctx, store, config.WorkerID, primary, config.DispatchWatchInterval, config.GetLogger()) {
+				alerts.EvaluateOnly(channels)
+			}
+		}()
+	}
+
+	creds, err := credentials(ctx, config)
+	if err != nil {
+		config.GetLogger().WithError(err).Fatalln("Could not log in to twitch")
+	}
+
+	var rawArchive irc.RawRecorder
+	if config.RawArchiveDir != "" {
+		w, err := archive.NewWriter(config.RawArchiveDir, workerName(config), config.RawArchiveRotate, config.RawArchiveMaxSize, config.GetLogger())
+		if err != nil {
+			config.GetLogger().WithError(err).Fatalln("Could not open raw archive")
+		}
+		defer w.Close()
+		go w.Run(ctx)
+		rawArchive = w
+	}
 
 	go func() {
 		sig := <-sigs
@@ -107,12 +132,87 @@ func run(config *config.Config) {
 	}()
 
 	go irc.StartGoIRC(
-		messageChan,       // channel for IRC to feed messages in to
-		quitChan,          // chanel for done signal or disconnect
-		config.TwitchUser, // twitch IRC username
-		config.TwitchPass, // twitch IRC password "oauth:..."
-		streams,           // twitch live streams to join
+		parsedChan, // channel for IRC to feed messages in to
+		quitChan,   // chanel for done signal or disconnect
+		creds,      // twitch IRC login
+		streams,    // twitch live streams to join
+		updates,    // reassignments by the dispatcher when running as a worker
+		recorder,   // records which channels are being logged
+		rawArchive, // archives the raw lines when RAW_ARCHIVE_DIR is set
+		config.GetLogger(),
 	)
 
 	<-quitChan
+	recorder.Disconnected(time.Now())
+
+	// Let the recorder save the closed intervals before exiting
+	cancel()
+	<-recorded
+}
+
+// credentials returns an anonymous login when TWITCH_ANONYMOUS is set. Otherwise the
+// configured token is validated, and kept valid in the background until ctx is done.
+// Workers only refresh it with TWITCH_TOKEN_REFRESH, so they don't race each other
+// rotating the token file they share.
+func credentials(ctx context.Context, config *config.Config) (irc.Credentials, error) {
+	if config.TwitchAnonymous {
+		return irc.AnonymousCredentials(), nil
+	}
+
+	tokens, err := twitch.NewTokenManager(config)
+	if err != nil {
+		return irc.Credentials{}, err
+	}
+	tokens.AutoRefresh = config.WorkerID == "" || config.TwitchTokenRefresh
+	if err := tokens.Validate(ctx); err != nil {
+		return irc.Credentials{}, err
+	}
+	go tokens.Run(ctx, config.TwitchTokenValidation)
+
+	return irc.Credentials{
+		Username: config.TwitchUser, // twitch IRC username
+		Password: tokens.Password(), // twitch IRC password "oauth:..."
+	}, nil
+}
+
+func workerName(config *config.Config) string {
+	if config.WorkerID != "" {
+		return config.WorkerID
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// channels returns the channels assigned to this worker by the dispatcher, or
+// when running without a worker id the whitelist plus the top live streams
+func channels(config *config.Config) ([]string, error) {
+	if config.WorkerID != "" {
+		store, err := dispatch.NewStore(config)
+		if err != nil {
+			return nil, err
+		}
+
+		assignments, err := store.Load(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return assignments[config.WorkerID], nil
+	}
+
+	streams := []string{}
+	streams = append(streams, config.StreamWhilelist...)
+	if config.TwitchClientID == "" {
+		config.GetLogger().Warnln("TWITCH_CLIENT_ID is not set, only joining STREAM_WHITELIST")
+		return streams, nil
+	}
+
+	// Start by getting the top 1000 streams currently live
+	top, err := twitch.TopStreams(config.TwitchClientID, 1000)
+	if err != nil {
+		return nil, err
+	}
+	for _, stream := range top {
+		streams = twitch.AppendIfMissing(streams, stream)
+	}
+	return streams, nil
 }
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/djdduty/ttv-log/cmd/dispatcher"
+	"github.com/spf13/cobra"
+)
+
+var dispatchCmd = &cobra.Command{
+	Use:   "dispatch",
+	Short: "Run a dispatcher distributing channels to workers",
+	Long: `Runs a dispatcher. Any number of dispatchers can be started, one of them is
+elected leader through DISPATCH_LEASE_BACKEND and the others stand by to take
+over the stored channel assignments if it goes away.`,
+	Run: dispatcher.RunDispatcher(c),
+}
+
+func init() {
+	RootCmd.AddCommand(dispatchCmd)
+
+	dispatchCmd.PersistentFlags().StringVar(&c.DispatchID, "id", "", "Unique id of this dispatcher instance, defaults to hostname and pid.")
+}
@@ -0,0 +1,82 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/dispatch"
+	"github.com/djdduty/ttv-log/twitch"
+	"github.com/spf13/cobra"
+)
+
+const numStreams = 1000
+
+// RunDispatcher campaigns for dispatcher leadership and assigns channels while elected
+func RunDispatcher(c *config.Config) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		run(c)
+	}
+}
+
+func run(c *config.Config) {
+	l := c.GetLogger()
+	c.RequireTwitchClientID()
+
+	if len(c.DispatchWorkers) == 0 {
+		l.Fatalf(`DISPATCH_WORKERS is empty, list the worker ids channels should be assigned to.`)
+	}
+
+	id := c.DispatchID
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	lease, err := dispatch.NewLease(c)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up dispatcher lease")
+	}
+
+	store, err := dispatch.NewStore(c)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not set up assignment store")
+	}
+
+	source := func(ctx context.Context) ([]string, error) {
+		streams := append([]string{}, c.StreamWhilelist...)
+		for _, s := range c.ReplicatedChannels {
+			streams = twitch.AppendIfMissing(streams, s)
+		}
+		top, err := twitch.TopStreams(c.TwitchClientID, numStreams)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range top {
+			streams = twitch.AppendIfMissing(streams, s)
+		}
+		return streams, nil
+	}
+
+	elector := dispatch.NewElector(lease, id, c.DispatchLeaseTTL, l)
+	d := dispatch.NewDispatcher(elector, store, source, c.DispatchWorkers, c.DispatchInterval, l)
+	d.Replication = map[string]int{}
+	for _, ch := range c.ReplicatedChannels {
+		d.Replication[ch] = c.ReplicationFactor
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		l.Infof("Received %s, stepping down", sig)
+		cancel()
+	}()
+
+	l.Infof("Dispatcher %s campaigning for leadership", id)
+	d.Run(ctx)
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/djdduty/ttv-log/cmd/exporter"
+	"github.com/djdduty/ttv-log/export"
+	"github.com/spf13/cobra"
+)
+
+var exportOptions = &exporter.Options{}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the logs of a channel or user",
+	Long: `Streams the logs of the given channels and users to stdout or a file, oldest
+first. Select a whole UTC day with --date or any range with --from and --to.
+
+  ttv-log export --channel xqcow --date 2026-10-17 --gzip -o xqcow.log.gz`,
+	Run: exporter.RunExport(c, exportOptions),
+}
+
+func init() {
+	RootCmd.AddCommand(exportCmd)
+
+	flags := exportCmd.PersistentFlags()
+	flags.StringSliceVar(&exportOptions.Channels, "channel", nil, "Channels to export, can be repeated.")
+	flags.StringSliceVar(&exportOptions.Users, "user", nil, "Users to export, can be repeated.")
+	flags.StringVar(&exportOptions.Date, "date", "", "UTC day to export, e.g. 2026-10-17.")
+	flags.StringVar(&exportOptions.From, "from", "", "Start of the range to export, RFC3339.")
+	flags.StringVar(&exportOptions.To, "to", "", "End of the range to export, RFC3339.")
+	flags.StringVar(&exportOptions.Format, "format", export.Text, fmt.Sprintf("Output format, one of %s.", strings.Join(export.Formats, ", ")))
+	flags.StringVarP(&exportOptions.Output, "output", "o", "", "File to write to, defaults to stdout.")
+	flags.BoolVar(&exportOptions.Gzip, "gzip", false, "Gzip compress the output.")
+}
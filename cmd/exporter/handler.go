@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/djdduty/ttv-log/api"
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/export"
+	"github.com/spf13/cobra"
+)
+
+// Options are the flags of the export command.
+type Options struct {
+	Channels []string
+	Users    []string
+	From     string
+	To       string
+	Date     string
+	Format   string
+	Output   string
+	Gzip     bool
+}
+
+// RunExport writes the selected logs to stdout or a file
+func RunExport(c *config.Config, o *Options) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		run(c, o)
+	}
+}
+
+func run(c *config.Config, o *Options) {
+	l := c.GetLogger()
+
+	if len(o.Channels) == 0 && len(o.Users) == 0 {
+		l.Fatalln("Export needs at least a --channel or a --user")
+	}
+
+	finder, err := o.timeRange(api.NewFinder())
+	if err != nil {
+		l.WithError(err).Fatalln("Invalid time range")
+	}
+
+	var out io.Writer = os.Stdout
+	if o.Output != "" && o.Output != "-" {
+		f, err := os.Create(o.Output)
+		if err != nil {
+			l.WithError(err).Fatalln("Could not create output file")
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var gz *gzip.Writer
+	if o.Gzip {
+		gz = gzip.NewWriter(out)
+		out = gz
+	}
+
+	w, err := export.NewWriter(o.Format, out)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not create export writer")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	query := finder.
+		Channels(o.Channels...).
+		Users(o.Users...).
+		Filter()
+
+	n, err := export.Export(ctx, c.Context().ElasticConnection.GetClient(), query, w, c.DedupWindow)
+	if gz != nil {
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		l.WithError(err).Fatalf("Export aborted after %d messages", n)
+	}
+
+	l.Infof("Exported %d messages", n)
+}
+
+// timeRange restricts finder to the range selected by --date or --from and --to.
+// A missing --from or --to leaves that end of the range open.
+func (o *Options) timeRange(finder *api.Finder) (*api.Finder, error) {
+	if o.Date != "" {
+		day, err := time.Parse("2006-01-02", o.Date)
+		if err != nil {
+			return nil, err
+		}
+		return finder.Day(day), nil
+	}
+
+	var start, end time.Time
+	var err error
+	if o.From != "" {
+		if start, err = time.Parse(time.RFC3339, o.From); err != nil {
+			return nil, err
+		}
+	}
+	if o.To != "" {
+		if end, err = time.Parse(time.RFC3339, o.To); err != nil {
+			return nil, err
+		}
+	}
+	return finder.Between(start, end), nil
+}
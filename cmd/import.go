@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/djdduty/ttv-log/cmd/importer"
+	"github.com/djdduty/ttv-log/logimport"
+	"github.com/spf13/cobra"
+)
+
+var importOptions = &importer.Options{}
+
+var importCmd = &cobra.Command{
+	Use:   "import [flags] PATH...",
+	Short: "Import logs written by other chat loggers",
+	Long: `Imports log files, or every .log, .txt and .gz file below a directory. Messages
+go through the same pipeline as the bot's and are stored under the same ids.
+Raw lines keep their twitch message id, so they are never stored twice. Other
+lines, like justlog text or chatterino logs, get an id from their content and
+time: importing a file twice does not create duplicates, but chat that was
+already logged live is stored again.
+
+  ttv-log import --format justlog /var/justlog/logs
+  ttv-log import --format chatterino --timezone Europe/Berlin ~/Chatterino2/Logs/Twitch/Channels/forsen`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  importer.RunImport(c, importOptions),
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+
+	flags := importCmd.PersistentFlags()
+	flags.StringVar(&importOptions.Format, "format", "justlog", fmt.Sprintf("Log format, one of %s.", strings.Join(logimport.FormatNames(), ", ")))
+	flags.StringVar(&importOptions.Channel, "channel", "", "Channel to store the messages under, for logs that don't name it.")
+	flags.StringVar(&importOptions.Timezone, "timezone", "UTC", "Time zone chatterino logs were written in.")
+	flags.BoolVar(&importOptions.DryRun, "dry-run", false, "Only parse the files and report errors.")
+}
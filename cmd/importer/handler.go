@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/export"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/djdduty/ttv-log/logimport"
+	"github.com/djdduty/ttv-log/raid"
+	"github.com/spf13/cobra"
+)
+
+// progressInterval is how often the import progress is logged
+const progressInterval = 5 * time.Second
+
+// Sinks the replay command can write to besides the export formats.
+const (
+	// ElasticSink indexes the messages.
+	ElasticSink = "elastic"
+)
+
+// Options are the flags of the import and replay commands.
+type Options struct {
+	Format   string
+	Channel  string
+	Timezone string
+	DryRun   bool
+
+	Sink   string
+	Output string
+	Gzip   bool
+}
+
+// RunImport imports the log files and directories given as arguments
+func RunImport(c *config.Config, o *Options) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		run(c, o, args)
+	}
+}
+
+// RunReplay parses the raw line archives given as arguments again and writes the messages to a sink
+func RunReplay(c *config.Config, o *Options) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		o.Format = "archive"
+		run(c, o, args)
+	}
+}
+
+func run(c *config.Config, o *Options, paths []string) {
+	l := c.GetLogger()
+
+	format, err := logimport.LookupFormat(o.Format)
+	if err != nil {
+		l.Fatalln(err)
+	}
+
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		l.WithError(err).Fatalln("Invalid time zone")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		l.Infof("Received %s, stopping import", sig)
+		cancel()
+	}()
+
+	var (
+		sink    logimport.Sink
+		indexer *logimport.ElasticSink
+		closer  io.Closer
+	)
+	switch {
+	case o.DryRun:
+	case o.Sink == "" || o.Sink == ElasticSink:
+		// Imported raid notices are stored like the bot's, alerts are left to live chat
+		raids, err := raid.NewStore(ctx, c.Context().ElasticConnection, l)
+		if err != nil {
+			l.WithError(err).Fatalln("Could not open the raid index")
+		}
+		defer raids.Close()
+
+		indexer = logimport.NewElasticSink(irc.NewElasticFlusher(c.Context().ElasticConnection, time.Second, c.DedupWindow, raids.Hook()))
+		sink, closer = indexer, indexer
+	default:
+		var out io.WriteCloser = os.Stdout
+		if o.Output != "" && o.Output != "-" {
+			if out, err = os.Create(o.Output); err != nil {
+				l.WithError(err).Fatalln("Could not create output file")
+			}
+		}
+		closer = out
+		if o.Gzip {
+			gz := gzip.NewWriter(out)
+			closer = multiCloser{gz, out}
+			out = gz
+		}
+		if sink, err = export.NewWriter(o.Sink, out); err != nil {
+			l.WithError(err).Fatalln("Could not create output writer")
+		}
+	}
+
+	emotes, err := irc.LoadEmoteSet(c.EmoteFile)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not load EMOTE_FILE")
+	}
+
+	imp := logimport.NewImporter(format, logimport.Options{Channel: o.Channel, Location: loc, Emotes: emotes}, sink, c.DedupWindow, l)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-time.After(progressInterval):
+				report(c, imp.Stats(), indexer)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for _, path := range paths {
+		if err := imp.ImportPath(ctx, path); err != nil {
+			l.WithError(err).Errorf("Import of %s stopped", path)
+			break
+		}
+	}
+	close(done)
+
+	if err := imp.Flush(); err != nil {
+		l.WithError(err).Errorln("Could not flush the remaining messages")
+	}
+	if closer != nil {
+		if err := closer.Close(); err != nil {
+			l.WithError(err).Errorln("Could not close the output")
+		}
+	}
+	report(c, imp.Stats(), indexer)
+}
+
+func report(c *config.Config, s logimport.Stats, indexer *logimport.ElasticSink) {
+	fields := map[string]interface{}{
+		"files":   s.Files,
+		"lines":   s.Lines,
+		"skipped": s.Skipped,
+		"errors":  s.Errors,
+	}
+	if indexer != nil {
+		fields["indexed"] = indexer.Indexed()
+		fields["failed"] = indexer.Failed()
+	}
+	c.GetLogger().WithFields(fields).Infof("Parsed %d messages", s.Parsed)
+}
+
+// multiCloser closes a gzip writer before the file below it.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	for _, c := range m {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package keymanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/config"
+	"github.com/spf13/cobra"
+)
+
+// CreateOptions are the flags of the create command.
+type CreateOptions struct {
+	Name     string
+	Scopes   []string
+	Channels []string
+	Config   bool
+}
+
+// RunCreate creates an API key and prints its token
+func RunCreate(c *config.Config, o *CreateOptions) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		create(c, o)
+	}
+}
+
+func create(c *config.Config, o *CreateOptions) {
+	l := c.GetLogger()
+
+	key, token, err := apikey.Generate(o.Name, o.Scopes, o.Channels)
+	if err != nil {
+		l.WithError(err).Fatalln("Could not create API key")
+	}
+
+	if o.Config {
+		printConfig(key)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := store(c).Put(ctx, key); err != nil {
+			l.WithError(err).Fatalln("Could not store API key")
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Created API key %s, its token is shown only once:\n", key.ID)
+	fmt.Println(token)
+}
+
+// printConfig writes key as an API_KEYS entry of the config file.
+func printConfig(key *apikey.Key) {
+	fmt.Println("API_KEYS:")
+	fmt.Printf("  - id: %s\n", key.ID)
+	if key.Name != "" {
+		fmt.Printf("    name: %q\n", key.Name)
+	}
+	fmt.Printf("    hash: %s\n", key.Hash)
+	fmt.Println("    scopes:")
+	for _, s := range key.Scopes {
+		fmt.Printf("      - %s\n", s)
+	}
+	if len(key.Channels) > 0 {
+		fmt.Println("    channels:")
+		for _, ch := range key.Channels {
+			fmt.Printf("      - %s\n", ch)
+		}
+	}
+}
+
+// RunList prints the stored API keys
+func RunList(c *config.Config) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		list(c)
+	}
+}
+
+func list(c *config.Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys, err := store(c).List(ctx)
+	if err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not list API keys")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCHANNELS\tCREATED\tREVOKED")
+	for _, k := range keys {
+		revoked := "-"
+		if k.Revoked() {
+			revoked = k.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, dash(k.Name), strings.Join(k.Scopes, ","), dash(strings.Join(k.Channels, ",")),
+			k.CreatedAt.Format(time.RFC3339), revoked)
+	}
+	w.Flush()
+}
+
+// RunRevoke revokes stored API keys
+func RunRevoke(c *config.Config) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		revoke(c, args)
+	}
+}
+
+func revoke(c *config.Config, ids []string) {
+	l := c.GetLogger()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := store(c)
+	for _, id := range ids {
+		ok, err := s.Revoke(ctx, id)
+		if err != nil {
+			l.WithError(err).Fatalf("Could not revoke API key %s", id)
+		}
+		if !ok {
+			l.Fatalf("There is no stored API key %s", id)
+		}
+		l.Infof("Revoked API key %s", id)
+	}
+}
+
+func store(c *config.Config) *apikey.Store {
+	s, err := apikey.NewStore(c.Context().ElasticConnection)
+	if err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not create the apikeys index")
+	}
+	return s
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
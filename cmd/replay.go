@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/djdduty/ttv-log/cmd/importer"
+	"github.com/djdduty/ttv-log/export"
+	"github.com/spf13/cobra"
+)
+
+var replayOptions = &importer.Options{}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [flags] PATH...",
+	Short: "Parse the raw line archive again",
+	Long: `Runs the files written to RAW_ARCHIVE_DIR, or every archive below a directory,
+through the current parser. Indexing into elasticsearch overwrites the stored
+messages, so fields added to the parser are filled in for old messages too.
+
+  ttv-log replay /var/lib/ttv-log/archive
+  ttv-log replay --sink ndjson -o replayed.ndjson worker-1-20261017T120000Z.irc.gz`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  importer.RunReplay(c, replayOptions),
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+
+	flags := replayCmd.PersistentFlags()
+	flags.StringVar(&replayOptions.Sink, "sink", importer.ElasticSink, fmt.Sprintf("Where the messages go, %s or one of the export formats %s.", importer.ElasticSink, strings.Join(export.Formats, ", ")))
+	flags.StringVarP(&replayOptions.Output, "output", "o", "", "File the export formats are written to, defaults to stdout.")
+	flags.BoolVar(&replayOptions.Gzip, "gzip", false, "Gzip compress the export formats.")
+	flags.BoolVar(&replayOptions.DryRun, "dry-run", false, "Only parse the archive and report errors.")
+	replayOptions.Timezone = "UTC"
+}
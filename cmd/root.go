@@ -75,6 +75,97 @@ func initConfig() {
 	viper.BindEnv("TWITCH_CLIENT_ID")
 	viper.SetDefault("TWITCH_CLIENT_ID", "")
 
+	viper.BindEnv("TWITCH_ANONYMOUS")
+	viper.SetDefault("TWITCH_ANONYMOUS", false)
+
+	viper.BindEnv("TWITCH_CLIENT_SECRET")
+	viper.SetDefault("TWITCH_CLIENT_SECRET", "")
+
+	viper.BindEnv("TWITCH_REFRESH_TOKEN")
+	viper.SetDefault("TWITCH_REFRESH_TOKEN", "")
+
+	viper.BindEnv("TWITCH_TOKEN_FILE")
+	viper.SetDefault("TWITCH_TOKEN_FILE", "")
+
+	viper.BindEnv("TWITCH_TOKEN_REFRESH")
+	viper.SetDefault("TWITCH_TOKEN_REFRESH", false)
+
+	viper.BindEnv("TWITCH_OAUTH_URL")
+	viper.SetDefault("TWITCH_OAUTH_URL", "https://id.twitch.tv")
+
+	viper.BindEnv("TWITCH_TOKEN_VALIDATE_INTERVAL")
+	viper.SetDefault("TWITCH_TOKEN_VALIDATE_INTERVAL", "1h")
+
+	viper.BindEnv("TWITCH_TOKEN_EXPIRY_WARNING")
+	viper.SetDefault("TWITCH_TOKEN_EXPIRY_WARNING", "24h")
+
+	viper.BindEnv("DISPATCH_LEASE_BACKEND")
+	viper.SetDefault("DISPATCH_LEASE_BACKEND", "elastic")
+
+	viper.BindEnv("DISPATCH_LEASE_FILE")
+	viper.SetDefault("DISPATCH_LEASE_FILE", "ttv-log-dispatch.lock")
+
+	viper.BindEnv("DISPATCH_LEASE_TTL")
+	viper.SetDefault("DISPATCH_LEASE_TTL", "15s")
+
+	viper.BindEnv("DISPATCH_ASSIGNMENT_FILE")
+	viper.SetDefault("DISPATCH_ASSIGNMENT_FILE", "ttv-log-assignments.json")
+
+	viper.BindEnv("DISPATCH_INTERVAL")
+	viper.SetDefault("DISPATCH_INTERVAL", "5m")
+
+	viper.BindEnv("DISPATCH_WORKERS")
+	viper.SetDefault("DISPATCH_WORKERS", []string{})
+
+	viper.BindEnv("DISPATCH_WATCH_INTERVAL")
+	viper.SetDefault("DISPATCH_WATCH_INTERVAL", "30s")
+
+	viper.BindEnv("REPLICATION_FACTOR")
+	viper.SetDefault("REPLICATION_FACTOR", 2)
+
+	viper.BindEnv("REPLICATED_CHANNELS")
+	viper.SetDefault("REPLICATED_CHANNELS", []string{})
+
+	viper.BindEnv("DEDUP_WINDOW")
+	viper.SetDefault("DEDUP_WINDOW", "2s")
+
+	viper.BindEnv("RAW_ARCHIVE_DIR")
+	viper.SetDefault("RAW_ARCHIVE_DIR", "")
+
+	viper.BindEnv("RAW_ARCHIVE_ROTATE")
+	viper.SetDefault("RAW_ARCHIVE_ROTATE", "1h")
+
+	viper.BindEnv("RAW_ARCHIVE_MAX_SIZE")
+	viper.SetDefault("RAW_ARCHIVE_MAX_SIZE", 256*1024*1024)
+
+	viper.BindEnv("EMOTE_FILE")
+	viper.SetDefault("EMOTE_FILE", "")
+
+	viper.SetDefault("ALERT_RULES", []interface{}{})
+
+	viper.BindEnv("ALERT_RELOAD_INTERVAL")
+	viper.SetDefault("ALERT_RELOAD_INTERVAL", "30s")
+
+	viper.BindEnv("ALERT_API_TOKEN")
+	viper.SetDefault("ALERT_API_TOKEN", "")
+
+	viper.BindEnv("GRAPHQL_MAX_DEPTH")
+	viper.SetDefault("GRAPHQL_MAX_DEPTH", 10)
+
+	viper.BindEnv("GRAPHQL_MAX_COST")
+	viper.SetDefault("GRAPHQL_MAX_COST", 1000)
+
+	viper.SetDefault("API_KEYS", []interface{}{})
+
+	viper.BindEnv("API_KEY_RELOAD_INTERVAL")
+	viper.SetDefault("API_KEY_RELOAD_INTERVAL", "30s")
+
+	viper.BindEnv("API_ANONYMOUS_SCOPES")
+	viper.SetDefault("API_ANONYMOUS_SCOPES", []string{"read:messages", "read:users"})
+
+	viper.BindEnv("PRIVATE_CHANNELS")
+	viper.SetDefault("PRIVATE_CHANNELS", []string{})
+
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
 	err := viper.ReadInConfig() // Find and read the config file
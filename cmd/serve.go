@@ -25,4 +25,5 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	serveCmd.PersistentFlags().BoolVar(&c.ForceHTTP, "dangerous-force-http", false, "Disable HTTP/2 over TLS (HTTPS) and serve HTTP instead. Never use this in production.")
+	serveCmd.PersistentFlags().String("client-dir", "", "Serve the web client from this directory instead of the one built into the binary, e.g. client/build during development.")
 }
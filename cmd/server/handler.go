@@ -10,7 +10,12 @@ import (
 	"os"
 	"strings"
 
+	"github.com/djdduty/ttv-log/api"
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/client"
 	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/gql"
+	"github.com/djdduty/ttv-log/web"
 	"github.com/gorilla/context"
 	"github.com/gorilla/csrf"
 	"github.com/julienschmidt/httprouter"
@@ -32,6 +37,9 @@ func EnhanceRouter(c *config.Config, serverHandler *Handler, router *httprouter.
 	if rejectInsecure {
 		n.UseFunc(serverHandler.RejectInsecureRequests)
 	}
+	if serverHandler.Keys != nil {
+		n.Use(serverHandler.Keys)
+	}
 
 	CSRF := csrf.Protect(
 		[]byte("32-byte-long-auth-key"), // TODO: Read CSRF auth token from config
@@ -40,7 +48,16 @@ func EnhanceRouter(c *config.Config, serverHandler *Handler, router *httprouter.
 		csrf.Secure(!c.ForceHTTP),
 	)
 
-	n.UseHandler(CSRF(router))
+	// Browsers never send bearer tokens on their own, so requests carrying one
+	// can't be forged and are checked by the keyring instead. GraphQL queries
+	// are POSTed but only read, so there is nothing to forge.
+	protected := CSRF(router)
+	n.UseHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || r.URL.Path == gql.Path {
+			r = csrf.UnsafeSkipCheck(r)
+		}
+		protected.ServeHTTP(rw, r)
+	}))
 	return context.ClearHandler(n)
 }
 
@@ -58,15 +75,18 @@ func setup(c *config.Config, cmd *cobra.Command, args []string) (handler *Handle
 	router = httprouter.New()
 
 	w := render.New(render.Options{
-		/*Funcs: []template.FuncMap{
+		Directory:  web.TemplateDir,
+		Asset:      web.Asset,
+		AssetNames: web.AssetNames,
+		Funcs: []template.FuncMap{
 			template.FuncMap{"noescape": noescape},
-			//template.FuncMap{"getScopeDescription": consent.GetScopeDescription},
-			template.FuncMap{"eq": func(a, b interface{}) bool { return a == b }},
+			web.Funcs,
 		},
-		Layout: "layout",*/
+		Layout: "layout",
 	})
 
 	handler = NewHandler(c, w)
+	handler.Keys = newKeyring(c)
 	handler.RegisterRoutes(router)
 	var err error
 	c.ForceHTTP, err = cmd.Flags().GetBool("dangerous-force-http")
@@ -93,8 +113,15 @@ func setup(c *config.Config, cmd *cobra.Command, args []string) (handler *Handle
 	recovery := negroni.NewRecovery()
 	recovery.PrintStack = false
 
-	static := negroni.NewStatic(http.Dir("client/build"))
-	static.Prefix = "/static"
+	clientDir, err := cmd.Flags().GetString("client-dir")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if clientDir == "" && !client.Built() {
+		c.GetLogger().Warnln("The binary was built without the web client, run yarn build in client/ before go build -tags client or pass --client-dir")
+	}
+	static := client.NewHandler(client.FileSystem(clientDir))
 
 	middlewares = append(
 		middlewares,
@@ -115,6 +142,9 @@ func noescape(str string) template.HTML {
 type Handler struct {
 	R      *render.Render
 	Config *config.Config
+	// Keys authenticates API keys and enforces their scopes and private
+	// channels, nothing is enforced when it is nil.
+	Keys *apikey.Keyring
 }
 
 // NewHandler creates a new handler instance
@@ -128,6 +158,8 @@ func (h *Handler) RegisterRoutes(router *httprouter.Router) {
 	// Setup handlers for all modules
 	newHealthHandler(c, router, h.R)
 	newAPIHandler(c, router, h.R)
+	newWebHandler(c, router, h.R)
+	newGraphQLHandler(c, router, h.R)
 }
 
 // RejectInsecureRequests is a middleware for denying requests that don't fit the secure scheme
@@ -150,7 +182,7 @@ func (h *Handler) RejectInsecureRequests(rw http.ResponseWriter, r *http.Request
 func serve(c *config.Config, cmd *cobra.Command, handler http.Handler, address string, cert []tls.Certificate) {
 	var srv = graceful.WithDefaults(&http.Server{
 		Addr:    address,
-		Handler: handler,
+		Handler: api.AllowStreaming(handler),
 		TLSConfig: &tls.Config{
 			Certificates: cert,
 		},
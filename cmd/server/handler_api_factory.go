@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
+	"time"
+
+	"github.com/djdduty/ttv-log/alert"
 	"github.com/djdduty/ttv-log/api"
 	"github.com/djdduty/ttv-log/config"
 	"github.com/djdduty/ttv-log/health"
+	"github.com/djdduty/ttv-log/live"
 	"github.com/julienschmidt/httprouter"
 	"github.com/unrolled/render"
 )
@@ -12,7 +17,20 @@ func newAPIHandler(c *config.Config, router *httprouter.Router, w *render.Render
 	ctx := c.Context()
 	health.ExpectDependency(c.GetLogger(), ctx.ElasticConnection)
 
-	h := api.NewHandler(w, ctx.ElasticConnection)
+	h := api.NewHandler(w, ctx.ElasticConnection, c.GetLogger())
+	h.DedupWindow = c.DedupWindow
+
+	// The bots run in their own processes, feed the live tail from the index
+	h.Live = live.NewBroker()
+	tailer := live.NewTailer(ctx.ElasticConnection, h.Live, time.Second, 10*time.Second, c.GetLogger())
+	go tailer.Run(context.Background())
+
+	h.AlertRules = alert.FromConfig(c)
+	store, err := alert.NewStore(ctx.ElasticConnection)
+	if err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not create the alerts index")
+	}
+	h.Alerts = store
 	h.SetRoutes(router)
 	return h
 }
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/config"
+)
+
+// newKeyring loads the API keys of the config file and the apikeys index, and
+// keeps reloading the stored ones.
+func newKeyring(c *config.Config) *apikey.Keyring {
+	store, err := apikey.NewStore(c.Context().ElasticConnection)
+	if err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not create the apikeys index")
+	}
+
+	keys := apikey.NewKeyring(c, store, c.GetLogger())
+	if err := keys.Reload(context.Background()); err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not load the API keys")
+	}
+	go keys.Run(context.Background(), c.APIKeyReloadInterval)
+
+	return keys
+}
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/gql"
+	"github.com/julienschmidt/httprouter"
+	"github.com/unrolled/render"
+)
+
+func newGraphQLHandler(c *config.Config, router *httprouter.Router, w *render.Render) *gql.Handler {
+	h, err := gql.NewHandler(w, c.Context().ElasticConnection, c.GetLogger())
+	if err != nil {
+		c.GetLogger().WithError(err).Fatalln("Could not build the GraphQL schema")
+	}
+	h.DedupWindow = c.DedupWindow
+	h.MaxDepth = c.GraphQLMaxDepth
+	h.MaxCost = c.GraphQLMaxCost
+
+	h.SetRoutes(router)
+	return h
+}
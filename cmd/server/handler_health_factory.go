@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
+
 	"github.com/djdduty/ttv-log/config"
 	"github.com/djdduty/ttv-log/health"
+	"github.com/djdduty/ttv-log/twitch"
 	"github.com/julienschmidt/httprouter"
 	"github.com/unrolled/render"
 )
@@ -11,10 +14,35 @@ func newHealthHandler(c *config.Config, router *httprouter.Router, w *render.Ren
 	ctx := c.Context()
 	health.ExpectDependency(c.GetLogger(), ctx.ElasticConnection)
 
-	h := health.NewHandler(w, c.BuildVersion, health.ReadyCheckers{
+	checks := health.ReadyCheckers{
 		"database": ctx.ElasticConnection.Ping,
-	})
+	}
+	if tokens := newTokenChecker(c); tokens != nil {
+		checks["twitch_token"] = tokens.Check
+	}
+
+	h := health.NewHandler(w, c.BuildVersion, checks)
 
 	h.SetRoutes(router)
 	return h
 }
+
+// newTokenChecker watches the twitch token the bots log in with, so its expiry
+// shows up in the readiness check. The bots do the refreshing.
+func newTokenChecker(c *config.Config) *twitch.TokenManager {
+	if c.TwitchAnonymous || (c.TwitchPass == "" && c.TwitchTokenFile == "") {
+		return nil
+	}
+
+	tokens, err := twitch.NewTokenManager(c)
+	if err != nil {
+		c.GetLogger().WithError(err).Errorln("Could not load twitch token")
+		return nil
+	}
+	if err := tokens.Validate(context.Background()); err != nil {
+		c.GetLogger().WithError(err).Warnln("Twitch token is not valid")
+	}
+	go tokens.Run(context.Background(), c.TwitchTokenValidation)
+
+	return tokens
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/web"
+	"github.com/julienschmidt/httprouter"
+	"github.com/unrolled/render"
+)
+
+func newWebHandler(c *config.Config, router *httprouter.Router, w *render.Render) *web.Handler {
+	h := web.NewHandler(w, c.Context().ElasticConnection, c.GetLogger())
+	h.DedupWindow = c.DedupWindow
+
+	h.SetRoutes(router)
+	return h
+}
@@ -26,11 +26,48 @@ const mapping = `
 			},
 			"Timestamp":{
 				"type":"date"
+			},
+			"Type":{
+				"type":"keyword"
+			},
+			"Bits":{
+				"type":"integer"
+			},
+			"Viewers":{
+				"type":"integer"
+			},
+			"UserID":{
+				"type":"keyword"
+			},
+			"Emotes":{
+				"type":"keyword"
 			}
 		}
 	}
 }`
 
+// fieldsMapping adds the fields that were introduced after the index was first created
+const fieldsMapping = `
+{
+	"properties":{
+		"Type":{
+			"type":"keyword"
+		},
+		"Bits":{
+			"type":"integer"
+		},
+		"Viewers":{
+			"type":"integer"
+		},
+		"UserID":{
+			"type":"keyword"
+		},
+		"Emotes":{
+			"type":"keyword"
+		}
+	}
+}`
+
 // ElasticConnector ...
 type ElasticConnector struct {
 	ctx    context.Context
@@ -87,6 +124,10 @@ func (e *ElasticConnector) Init(url, username, password string, l logrus.FieldLo
 			// Not acknowledged
 		}
 	} else {
+		if _, err := client.PutMapping().Index("twitch").BodyString(fieldsMapping).Do(e.ctx); err != nil {
+			l.Warnf("Could not add new fields to the twitch index mapping: %s\n", err)
+		}
+
 		/*/Delete an index.
 		deleteIndex, err := client.DeleteIndex("twitch").Do(e.ctx)
 		if err != nil {
@@ -124,4 +165,29 @@ func (e *ElasticConnector) GetClient() *elastic.Client {
 // GetContext returns the connector's context
 func (e *ElasticConnector) GetContext() context.Context {
 	return e.ctx
-}
\ No newline at end of file
+}
+
+// GetLogger returns the connector's logger
+func (e *ElasticConnector) GetLogger() logrus.FieldLogger {
+	return e.l
+}
+
+// EnsureIndex creates the named index with the given body if it does not exist yet
+func (e *ElasticConnector) EnsureIndex(name, body string) error {
+	exists, err := e.client.IndexExists(name).Do(e.ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	createIndex, err := e.client.CreateIndex(name).Body(body).Do(e.ctx)
+	if err != nil {
+		return err
+	}
+	if !createIndex.Acknowledged {
+		e.l.Warnf("Creation of index %s was not acknowledged\n", name)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/djdduty/ttv-log/health"
 	"github.com/pkg/errors"
@@ -24,9 +25,18 @@ type Config struct {
 	ElasticUser string `mapstructure:"ELASTIC_USER" yaml:"-"`
 	ElasticPass string `mapstructure:"ELASTIC_PASS" yaml:"-"`
 
-	TwitchUser     string `mapstructure:"TWITCH_USER" yaml:"-"`
-	TwitchPass     string `mapstructure:"TWITCH_PASS" yaml:"-"`
-	TwitchClientID string `mapstructure:"TWITCH_CLIENT_ID" yaml:"-"`
+	TwitchUser      string `mapstructure:"TWITCH_USER" yaml:"-"`
+	TwitchPass      string `mapstructure:"TWITCH_PASS" yaml:"-"`
+	TwitchClientID  string `mapstructure:"TWITCH_CLIENT_ID" yaml:"-"`
+	TwitchAnonymous bool   `mapstructure:"TWITCH_ANONYMOUS" yaml:"-"`
+
+	TwitchClientSecret       string        `mapstructure:"TWITCH_CLIENT_SECRET" yaml:"-"`
+	TwitchRefreshToken       string        `mapstructure:"TWITCH_REFRESH_TOKEN" yaml:"-"`
+	TwitchTokenFile          string        `mapstructure:"TWITCH_TOKEN_FILE" yaml:"-"`
+	TwitchTokenRefresh       bool          `mapstructure:"TWITCH_TOKEN_REFRESH" yaml:"-"`
+	TwitchOAuthURL           string        `mapstructure:"TWITCH_OAUTH_URL" yaml:"-"`
+	TwitchTokenValidation    time.Duration `mapstructure:"TWITCH_TOKEN_VALIDATE_INTERVAL" yaml:"-"`
+	TwitchTokenExpiryWarning time.Duration `mapstructure:"TWITCH_TOKEN_EXPIRY_WARNING" yaml:"-"`
 
 	BuildVersion string         `yaml:"-"`
 	BuildHash    string         `yaml:"-"`
@@ -35,6 +45,64 @@ type Config struct {
 	context      *Context       `yaml:"-"`
 
 	StreamWhilelist []string `mapstructure:"STREAM_WHITELIST" yaml:"-"`
+
+	WorkerID string `yaml:"-"`
+
+	DispatchID             string        `yaml:"-"`
+	DispatchLeaseBackend   string        `mapstructure:"DISPATCH_LEASE_BACKEND" yaml:"-"`
+	DispatchLeaseFile      string        `mapstructure:"DISPATCH_LEASE_FILE" yaml:"-"`
+	DispatchLeaseTTL       time.Duration `mapstructure:"DISPATCH_LEASE_TTL" yaml:"-"`
+	DispatchAssignmentFile string        `mapstructure:"DISPATCH_ASSIGNMENT_FILE" yaml:"-"`
+	DispatchInterval       time.Duration `mapstructure:"DISPATCH_INTERVAL" yaml:"-"`
+	DispatchWorkers        []string      `mapstructure:"DISPATCH_WORKERS" yaml:"-"`
+	DispatchWatchInterval  time.Duration `mapstructure:"DISPATCH_WATCH_INTERVAL" yaml:"-"`
+
+	ReplicationFactor  int           `mapstructure:"REPLICATION_FACTOR" yaml:"-"`
+	ReplicatedChannels []string      `mapstructure:"REPLICATED_CHANNELS" yaml:"-"`
+	DedupWindow        time.Duration `mapstructure:"DEDUP_WINDOW" yaml:"-"`
+
+	RawArchiveDir     string        `mapstructure:"RAW_ARCHIVE_DIR" yaml:"-"`
+	RawArchiveRotate  time.Duration `mapstructure:"RAW_ARCHIVE_ROTATE" yaml:"-"`
+	RawArchiveMaxSize int64         `mapstructure:"RAW_ARCHIVE_MAX_SIZE" yaml:"-"`
+
+	EmoteFile string `mapstructure:"EMOTE_FILE" yaml:"-"`
+
+	AlertRules          []AlertRule   `mapstructure:"ALERT_RULES" yaml:"-"`
+	AlertReloadInterval time.Duration `mapstructure:"ALERT_RELOAD_INTERVAL" yaml:"-"`
+	AlertAPIToken       string        `mapstructure:"ALERT_API_TOKEN" yaml:"-"`
+
+	GraphQLMaxDepth int `mapstructure:"GRAPHQL_MAX_DEPTH" yaml:"-"`
+	GraphQLMaxCost  int `mapstructure:"GRAPHQL_MAX_COST" yaml:"-"`
+
+	APIKeys              []APIKey      `mapstructure:"API_KEYS" yaml:"-"`
+	APIKeyReloadInterval time.Duration `mapstructure:"API_KEY_RELOAD_INTERVAL" yaml:"-"`
+	APIAnonymousScopes   []string      `mapstructure:"API_ANONYMOUS_SCOPES" yaml:"-"`
+	PrivateChannels      []string      `mapstructure:"PRIVATE_CHANNELS" yaml:"-"`
+}
+
+// APIKey is an API key defined in the config file. Only the SHA-256 of its
+// token is stored, as printed by "ttv-log apikey create --config".
+type APIKey struct {
+	ID       string   `mapstructure:"id" yaml:"-"`
+	Name     string   `mapstructure:"name" yaml:"-"`
+	Hash     string   `mapstructure:"hash" yaml:"-"`
+	Scopes   []string `mapstructure:"scopes" yaml:"-"`
+	Channels []string `mapstructure:"channels" yaml:"-"`
+}
+
+// AlertRule is an alert rule defined in the config file.
+type AlertRule struct {
+	ID        string        `mapstructure:"id" yaml:"-"`
+	Name      string        `mapstructure:"name" yaml:"-"`
+	Pattern   string        `mapstructure:"pattern" yaml:"-"`
+	Channels  []string      `mapstructure:"channels" yaml:"-"`
+	Users     []string      `mapstructure:"users" yaml:"-"`
+	Threshold int           `mapstructure:"threshold" yaml:"-"`
+	Window    time.Duration `mapstructure:"window" yaml:"-"`
+	Cooldown  time.Duration `mapstructure:"cooldown" yaml:"-"`
+	Webhook   string        `mapstructure:"webhook" yaml:"-"`
+	Secret    string        `mapstructure:"secret" yaml:"-"`
+	Disabled  bool          `mapstructure:"disabled" yaml:"-"`
 }
 
 func newLogger(c *Config) *logrus.Logger {
@@ -109,27 +177,38 @@ func matchesRange(r *http.Request, ranges []string) error {
 	return nil
 }
 
-// Context lazily gets the context from config
-func (c *Config) Context() *Context {
-	if c.context != nil {
-		return c.context
-	}
-
-	if c.ElasticHost == "" {
-		c.GetLogger().Fatalf(`ELASTIC_HOST is not set, use "export ELASTIC_HOST=url".`)
+// RequireTwitchLogin fatals if the IRC credentials are missing. Anonymous
+// deployments don't need them.
+func (c *Config) RequireTwitchLogin() {
+	if c.TwitchAnonymous {
+		return
 	}
 
 	if c.TwitchUser == "" {
-		c.GetLogger().Fatalf(`TWITCH_USER is not set, use "export TWITCH_USER=user".`)
+		c.GetLogger().Fatalf(`TWITCH_USER is not set, use "export TWITCH_USER=user" or "export TWITCH_ANONYMOUS=true".`)
 	}
 
 	if c.TwitchPass == "" {
-		c.GetLogger().Fatalf(`TWITCH_PASS is not set, use "export TWITCH_PASS=pass".`)
+		c.GetLogger().Fatalf(`TWITCH_PASS is not set, use "export TWITCH_PASS=pass" or "export TWITCH_ANONYMOUS=true".`)
 	}
+}
 
+// RequireTwitchClientID fatals if the client id needed for the twitch API is missing.
+func (c *Config) RequireTwitchClientID() {
 	if c.TwitchClientID == "" {
 		c.GetLogger().Fatalf(`TWITCH_CLIENT_ID is not set, use "export TWITCH_CLIENT_ID=client-id".`)
 	}
+}
+
+// Context lazily gets the context from config
+func (c *Config) Context() *Context {
+	if c.context != nil {
+		return c.context
+	}
+
+	if c.ElasticHost == "" {
+		c.GetLogger().Fatalf(`ELASTIC_HOST is not set, use "export ELASTIC_HOST=url".`)
+	}
 
 	connection := &ElasticConnector{}
 	if err := connection.Init(c.ElasticHost, c.ElasticUser, c.ElasticPass, c.GetLogger()); err != nil {
@@ -0,0 +1,59 @@
+package coverage
+
+import (
+	"time"
+)
+
+const (
+	// Index holds the coverage intervals recorded by the bots.
+	Index = "coverage"
+	// Heartbeat is how often bots extend their open intervals.
+	Heartbeat = time.Minute
+	// StaleAfter is how long an open interval may go without a heartbeat before its worker is considered dead.
+	StaleAfter = 2 * Heartbeat
+)
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"Channel":{
+				"type":"keyword"
+			},
+			"Worker":{
+				"type":"keyword"
+			},
+			"Start":{
+				"type":"date"
+			},
+			"End":{
+				"type":"date"
+			},
+			"Open":{
+				"type":"boolean"
+			},
+			"Reason":{
+				"type":"keyword"
+			}
+		}
+	}
+}`
+
+// Interval is a span of time in which a worker was receiving a channel's chat.
+// While the worker is joined the interval is Open and End is pushed forward on
+// every heartbeat, so a crashed worker leaves an interval ending at its last heartbeat.
+type Interval struct {
+	Channel string
+	Worker  string
+	Start   time.Time
+	End     time.Time
+	Open    bool
+	Reason  string `json:",omitempty"`
+}
+
+// Span is a time range in a coverage report.
+type Span struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Workers []string  `json:"workers,omitempty"`
+}
@@ -0,0 +1,188 @@
+package coverage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// Recorder records when a worker joins and leaves channels.
+type Recorder struct {
+	connector *config.ElasticConnector
+	worker    string
+	heartbeat time.Duration
+	l         logrus.FieldLogger
+
+	mu   sync.Mutex
+	open map[string]*recorded
+
+	// queue holds the writes of the IRC handlers until Run saves them
+	queue chan recorded
+}
+
+// queueSize is the number of interval writes waiting for Run before new ones are dropped
+const queueSize = 4096
+
+type recorded struct {
+	id       string
+	interval Interval
+	// version orders the writes of an interval, which happen outside the lock
+	version int64
+}
+
+// NewRecorder creates a recorder for worker, extending open intervals every heartbeat.
+func NewRecorder(connector *config.ElasticConnector, worker string, heartbeat time.Duration, l logrus.FieldLogger) (*Recorder, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		connector: connector,
+		worker:    worker,
+		heartbeat: heartbeat,
+		l:         l,
+		open:      map[string]*recorded{},
+		queue:     make(chan recorded, queueSize),
+	}, nil
+}
+
+// Joined opens an interval once the server confirmed the JOIN to channel.
+func (r *Recorder) Joined(channel string, at time.Time) {
+	r.mu.Lock()
+	if _, ok := r.open[channel]; ok {
+		r.mu.Unlock()
+		return
+	}
+
+	rec := &recorded{
+		id: fmt.Sprintf("%s-%s-%d", r.worker, channel, at.UnixNano()),
+		interval: Interval{
+			Channel: channel,
+			Worker:  r.worker,
+			Start:   at.UTC(),
+			End:     at.UTC(),
+			Open:    true,
+		},
+	}
+	r.open[channel] = rec
+	r.enqueue(rec.snapshot())
+	r.mu.Unlock()
+}
+
+// Parted closes the interval of channel.
+func (r *Recorder) Parted(channel string, at time.Time) {
+	r.mu.Lock()
+	r.close(channel, at, "part")
+	r.mu.Unlock()
+}
+
+// Disconnected closes every open interval.
+func (r *Recorder) Disconnected(at time.Time) {
+	r.mu.Lock()
+	for channel := range r.open {
+		r.close(channel, at, "disconnect")
+	}
+	r.mu.Unlock()
+}
+
+// Run saves the intervals queued by the IRC handlers and extends all open
+// intervals every heartbeat until ctx is done. The writes still queued by then
+// are saved before it returns.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case rec := <-r.queue:
+			r.save(rec)
+			continue
+		case <-ticker.C:
+		case <-ctx.Done():
+			r.drain()
+			return
+		}
+
+		r.mu.Lock()
+		now := time.Now().UTC()
+		var pending []recorded
+		for _, rec := range r.open {
+			rec.interval.End = now
+			pending = append(pending, rec.snapshot())
+		}
+		r.mu.Unlock()
+
+		r.saveAll(pending)
+	}
+}
+
+// drain saves the queued writes left when Run stops.
+func (r *Recorder) drain() {
+	for {
+		select {
+		case rec := <-r.queue:
+			r.save(rec)
+		default:
+			return
+		}
+	}
+}
+
+// close ends the interval of channel and queues it for saving. r.mu must be held.
+func (r *Recorder) close(channel string, at time.Time, reason string) {
+	rec, ok := r.open[channel]
+	if !ok {
+		return
+	}
+	delete(r.open, channel)
+
+	rec.interval.End = at.UTC()
+	rec.interval.Open = false
+	rec.interval.Reason = reason
+	r.enqueue(rec.snapshot())
+}
+
+// enqueue hands a write to Run without blocking the IRC handler calling it.
+// The write is dropped when the queue is full.
+func (r *Recorder) enqueue(rec recorded) {
+	select {
+	case r.queue <- rec:
+	default:
+		r.l.Warnf("Coverage queue is full, dropped the interval of %s", rec.interval.Channel)
+	}
+}
+
+// snapshot copies the interval, bumping its version, so it can be saved after
+// r.mu is released. r.mu must be held.
+func (rec *recorded) snapshot() recorded {
+	rec.version++
+	return *rec
+}
+
+func (r *Recorder) saveAll(pending []recorded) {
+	for _, rec := range pending {
+		r.save(rec)
+	}
+}
+
+// save writes an interval. Writes are versioned, so a heartbeat that lost the
+// race against closing the interval can't reopen it.
+func (r *Recorder) save(rec recorded) {
+	ctx, cancel := context.WithTimeout(r.connector.GetContext(), 5*time.Second)
+	defer cancel()
+
+	_, err := r.connector.GetClient().Index().Index(Index).Id(rec.id).
+		Version(rec.version).VersionType("external").
+		BodyJson(rec.interval).Do(ctx)
+	if elastic.IsConflict(err) {
+		return
+	}
+	if err != nil {
+		r.l.WithError(err).Warnf("Could not record coverage of %s", rec.interval.Channel)
+	}
+}
@@ -0,0 +1,116 @@
+package coverage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Report describes which parts of a time range a channel was logged in.
+type Report struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Logged   []Span    `json:"logged"`
+	Unlogged []Span    `json:"unlogged"`
+	Ratio    float64   `json:"coverage_ratio"`
+}
+
+// Find builds the coverage report of channel between from and to. Open
+// intervals whose last heartbeat is within staleAfter are treated as running until now.
+func Find(ctx context.Context, client *elastic.Client, channel string, from, to time.Time, staleAfter time.Duration) (*Report, error) {
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("Channel", channel),
+		elastic.NewRangeQuery("Start").Lte(to),
+		elastic.NewBoolQuery().Should(
+			elastic.NewRangeQuery("End").Gte(from),
+			elastic.NewTermQuery("Open", true),
+		),
+	)
+
+	sr, err := client.Search().Index(Index).Query(q).Sort("Start", true).Size(10000).Do(ctx)
+	if elastic.IsNotFound(err) {
+		// Nothing was ever recorded
+		return build(nil, from, to), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var intervals []Interval
+	for _, hit := range sr.Hits.Hits {
+		var i Interval
+		if err := json.Unmarshal(hit.Source, &i); err != nil {
+			return nil, err
+		}
+		if i.Open && now.Sub(i.End) < staleAfter {
+			i.End = now
+		}
+		intervals = append(intervals, i)
+	}
+
+	return build(intervals, from, to), nil
+}
+
+// build merges overlapping intervals of all workers and fills the gaps between them.
+func build(intervals []Interval, from, to time.Time) *Report {
+	report := &Report{From: from, To: to, Logged: []Span{}, Unlogged: []Span{}}
+
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	for _, i := range intervals {
+		start, end := i.Start, i.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !end.After(start) {
+			continue
+		}
+
+		if n := len(report.Logged); n > 0 && !start.After(report.Logged[n-1].End) {
+			last := &report.Logged[n-1]
+			if end.After(last.End) {
+				last.End = end
+			}
+			last.Workers = appendIfMissing(last.Workers, i.Worker)
+			continue
+		}
+		report.Logged = append(report.Logged, Span{Start: start, End: end, Workers: []string{i.Worker}})
+	}
+
+	cursor := from
+	var logged time.Duration
+	for _, span := range report.Logged {
+		if span.Start.After(cursor) {
+			report.Unlogged = append(report.Unlogged, Span{Start: cursor, End: span.Start})
+		}
+		logged += span.End.Sub(span.Start)
+		cursor = span.End
+	}
+	if to.After(cursor) {
+		report.Unlogged = append(report.Unlogged, Span{Start: cursor, End: to})
+	}
+
+	if total := to.Sub(from); total > 0 {
+		report.Ratio = float64(logged) / float64(total)
+	}
+
+	return report
+}
+
+func appendIfMissing(slice []string, val string) []string {
+	for _, ele := range slice {
+		if ele == val {
+			return slice
+		}
+	}
+	return append(slice, val)
+}
@@ -0,0 +1,325 @@
+// Package directory maps twitch user ids to the login names they used, so
+// renamed users keep their history and reused names aren't merged into it.
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+)
+
+// Index holds one document per twitch account.
+const Index = "users"
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"user_id":{
+				"type":"keyword"
+			},
+			"login":{
+				"type":"keyword"
+			},
+			"names":{
+				"type":"nested",
+				"properties":{
+					"name":{
+						"type":"keyword"
+					},
+					"first_seen":{
+						"type":"date"
+					},
+					"last_seen":{
+						"type":"date"
+					},
+					"messages":{
+						"type":"long"
+					}
+				}
+			},
+			"first_seen":{
+				"type":"date"
+			},
+			"last_seen":{
+				"type":"date"
+			},
+			"updated_at":{
+				"type":"date"
+			}
+		}
+	}
+}`
+
+// Name is a login an account used and when.
+type Name struct {
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Messages  int64     `json:"messages"`
+}
+
+// User is a twitch account with its name history, oldest name first.
+type User struct {
+	UserID    string    `json:"user_id"`
+	Login     string    `json:"login"`
+	Names     []*Name   `json:"names"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Syncer rebuilds the directory entries of accounts from their logged messages.
+type Syncer struct {
+	// Batch is the number of accounts rebuilt per query
+	Batch int
+
+	connector *config.ElasticConnector
+}
+
+// NewSyncer creates the users index if needed.
+func NewSyncer(connector *config.ElasticConnector) (*Syncer, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+	return &Syncer{Batch: 500, connector: connector}, nil
+}
+
+// Sync rebuilds the entries of every account with messages between from and to
+// from all of their messages, and returns how many were stored.
+func (s *Syncer) Sync(ctx context.Context, from, to time.Time) (int, error) {
+	client := s.connector.GetClient()
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewRangeQuery("Timestamp").Gte(from).Lt(to),
+		elastic.NewExistsQuery("UserID"),
+	)
+
+	synced := 0
+	var after map[string]interface{}
+	for {
+		ids := elastic.NewCompositeAggregation().Size(s.Batch).Sources(
+			elastic.NewCompositeAggregationTermsValuesSource("id").Field("UserID"),
+		)
+		if after != nil {
+			ids = ids.AggregateAfter(after)
+		}
+
+		sr, err := client.Search().Index("twitch").Query(q).Size(0).Aggregation("ids", ids).Do(ctx)
+		if err != nil {
+			return synced, err
+		}
+		agg, ok := sr.Aggregations.Composite("ids")
+		if !ok || len(agg.Buckets) == 0 {
+			return synced, nil
+		}
+
+		batch := make([]interface{}, len(agg.Buckets))
+		for i, b := range agg.Buckets {
+			batch[i] = fmt.Sprint(b.Key["id"])
+		}
+		users, err := s.histories(ctx, batch)
+		if err != nil {
+			return synced, err
+		}
+		if err := s.save(ctx, users); err != nil {
+			return synced, err
+		}
+		synced += len(users)
+		after = agg.AfterKey
+	}
+}
+
+// histories aggregates every name used by the accounts over all logged messages.
+func (s *Syncer) histories(ctx context.Context, ids []interface{}) ([]*User, error) {
+	q := elastic.NewTermsQuery("UserID", ids...)
+	users := map[string]*User{}
+
+	var after map[string]interface{}
+	for {
+		names := elastic.NewCompositeAggregation().Size(10000).Sources(
+			elastic.NewCompositeAggregationTermsValuesSource("id").Field("UserID"),
+			elastic.NewCompositeAggregationTermsValuesSource("name").Field("User.keyword"),
+		).
+			SubAggregation("first_seen", elastic.NewMinAggregation().Field("Timestamp")).
+			SubAggregation("last_seen", elastic.NewMaxAggregation().Field("Timestamp"))
+		if after != nil {
+			names = names.AggregateAfter(after)
+		}
+
+		sr, err := s.connector.GetClient().Search().Index("twitch").Query(q).Size(0).Aggregation("names", names).Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+		agg, ok := sr.Aggregations.Composite("names")
+		if !ok || len(agg.Buckets) == 0 {
+			break
+		}
+
+		for _, b := range agg.Buckets {
+			id := fmt.Sprint(b.Key["id"])
+			u := users[id]
+			if u == nil {
+				u = &User{UserID: id}
+				users[id] = u
+			}
+			u.Names = append(u.Names, &Name{
+				Name:      strings.ToLower(fmt.Sprint(b.Key["name"])),
+				FirstSeen: aggTime(b.Aggregations, "first_seen"),
+				LastSeen:  aggTime(b.Aggregations, "last_seen"),
+				Messages:  b.DocCount,
+			})
+		}
+		after = agg.AfterKey
+	}
+
+	now := time.Now().UTC()
+	list := make([]*User, 0, len(users))
+	for _, u := range users {
+		sort.Slice(u.Names, func(i, j int) bool { return u.Names[i].FirstSeen.Before(u.Names[j].FirstSeen) })
+		for _, n := range u.Names {
+			if u.FirstSeen.IsZero() || n.FirstSeen.Before(u.FirstSeen) {
+				u.FirstSeen = n.FirstSeen
+			}
+			if !n.LastSeen.Before(u.LastSeen) {
+				u.LastSeen = n.LastSeen
+				u.Login = n.Name
+			}
+		}
+		u.UpdatedAt = now
+		list = append(list, u)
+	}
+	return list, nil
+}
+
+func (s *Syncer) save(ctx context.Context, users []*User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	bulk := s.connector.GetClient().Bulk().Index(Index)
+	for _, u := range users {
+		bulk.Add(elastic.NewBulkIndexRequest().Id(u.UserID).Doc(u))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		return fmt.Errorf("could not store %d users: %s", len(failed), failed[0].Error.Reason)
+	}
+	return nil
+}
+
+// Get returns the account with userID, ok is false when it isn't in the directory.
+func Get(ctx context.Context, client *elastic.Client, userID string) (u *User, ok bool, err error) {
+	res, err := client.Get().Index(Index).Id(userID).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	u = new(User)
+	if err := json.Unmarshal(res.Source, u); err != nil {
+		return nil, false, err
+	}
+	return u, true, nil
+}
+
+// Resolve returns the account that used login at t, the one that started using
+// it last before t. ok is false when no account in the directory used it by then.
+func Resolve(ctx context.Context, client *elastic.Client, login string, t time.Time) (u *User, ok bool, err error) {
+	used := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("names.name", strings.ToLower(login)),
+		elastic.NewRangeQuery("names.first_seen").Lte(t),
+	)
+	latest := elastic.NewFieldSort("names.first_seen").Desc().
+		Nested(elastic.NewNestedSort("names").Filter(used)).SortMode("max")
+
+	sr, err := client.Search().Index(Index).
+		Query(elastic.NewNestedQuery("names", used)).
+		SortBy(latest).Size(1).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(sr.Hits.Hits) == 0 {
+		return nil, false, nil
+	}
+
+	u = new(User)
+	if err := json.Unmarshal(sr.Hits.Hits[0].Source, u); err != nil {
+		return nil, false, err
+	}
+	return u, true, nil
+}
+
+// Owners returns the accounts that used the logins, keyed by lowercase login.
+// Logins used by several accounts go to the one that used them first, as
+// messages without a user id are older than the renames that freed them.
+// Logins no account in the directory used are left out.
+func Owners(ctx context.Context, client *elastic.Client, logins []string) (map[string]*User, error) {
+	owners := map[string]*User{}
+	if len(logins) == 0 {
+		return owners, nil
+	}
+
+	names := make([]interface{}, len(logins))
+	for i, login := range logins {
+		names[i] = strings.ToLower(login)
+	}
+	sr, err := client.Search().Index(Index).
+		Query(elastic.NewNestedQuery("names", elastic.NewTermsQuery("names.name", names...))).
+		Size(10000).
+		Do(ctx)
+	if elastic.IsNotFound(err) {
+		return owners, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	firstUse := map[string]time.Time{}
+	for _, hit := range sr.Hits.Hits {
+		u := new(User)
+		if err := json.Unmarshal(hit.Source, u); err != nil {
+			return nil, err
+		}
+		for _, n := range u.Names {
+			first, seen := firstUse[n.Name]
+			if !contains(names, n.Name) || (seen && !n.FirstSeen.Before(first)) {
+				continue
+			}
+			owners[n.Name] = u
+			firstUse[n.Name] = n.FirstSeen
+		}
+	}
+	return owners, nil
+}
+
+func contains(values []interface{}, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// aggTime reads a min or max aggregation over a date field.
+func aggTime(aggs elastic.Aggregations, name string) time.Time {
+	if agg, ok := aggs.Min(name); ok && agg.Value != nil {
+		return time.Unix(0, int64(*agg.Value)*int64(time.Millisecond)).UTC()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,265 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+	"github.com/pkg/errors"
+)
+
+// Assignments maps worker ids to the channels they should join.
+type Assignments map[string][]string
+
+// Assign distributes channels over workers. Channels listed in replication are
+// placed on that many distinct workers, every other channel on exactly one.
+// Placements on known workers are kept, so a new leader picking up the previous
+// assignments does not reshuffle anything. Only new channels, missing replicas or
+// channels of workers that were removed are moved to the least loaded workers.
+func Assign(current Assignments, workers []string, channels []string, replication map[string]int) Assignments {
+	next := Assignments{}
+	for _, w := range workers {
+		next[w] = []string{}
+	}
+	if len(workers) == 0 {
+		return next
+	}
+
+	replicas := func(ch string) int {
+		r := replication[ch]
+		if r < 1 {
+			r = 1
+		}
+		if r > len(workers) {
+			r = len(workers)
+		}
+		return r
+	}
+
+	wanted := map[string]bool{}
+	for _, ch := range channels {
+		wanted[ch] = true
+	}
+
+	placed := map[string]map[string]bool{}
+	for _, ch := range channels {
+		placed[ch] = map[string]bool{}
+	}
+
+	for _, w := range workers {
+		for _, ch := range current[w] {
+			if wanted[ch] && !placed[ch][w] && len(placed[ch]) < replicas(ch) {
+				next[w] = append(next[w], ch)
+				placed[ch][w] = true
+			}
+		}
+	}
+
+	for _, ch := range channels {
+		for len(placed[ch]) < replicas(ch) {
+			w := leastLoaded(next, workers, placed[ch])
+			next[w] = append(next[w], ch)
+			placed[ch][w] = true
+		}
+	}
+
+	return next
+}
+
+// leastLoaded returns the worker with the fewest channels that is not in exclude.
+func leastLoaded(a Assignments, workers []string, exclude map[string]bool) string {
+	best := ""
+	for _, w := range workers {
+		if exclude[w] {
+			continue
+		}
+		if best == "" || len(a[w]) < len(a[best]) {
+			best = w
+		}
+	}
+	return best
+}
+
+// Workers returns the worker ids in the assignments, sorted.
+func (a Assignments) Workers() []string {
+	workers := make([]string, 0, len(a))
+	for w := range a {
+		workers = append(workers, w)
+	}
+	sort.Strings(workers)
+	return workers
+}
+
+// Primary returns the channels worker is the primary replica of. A channel's
+// primary is the worker with the lowest id among the ones it is assigned to,
+// so every worker agrees on it without asking the others.
+func (a Assignments) Primary(worker string) []string {
+	primary := []string{}
+	for _, ch := range a[worker] {
+		first := worker
+		for w, channels := range a {
+			if w < first && containsChannel(channels, ch) {
+				first = w
+			}
+		}
+		if first == worker {
+			primary = append(primary, ch)
+		}
+	}
+	return primary
+}
+
+func containsChannel(channels []string, ch string) bool {
+	for _, c := range channels {
+		if c == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists assignments so a standby dispatcher can continue where the previous leader stopped.
+type Store interface {
+	Load(ctx context.Context) (Assignments, error)
+	Save(ctx context.Context, a Assignments) error
+}
+
+// NewStore creates the assignment store matching the configured lease backend.
+func NewStore(c *config.Config) (Store, error) {
+	switch c.DispatchLeaseBackend {
+	case "", "elastic":
+		return NewElasticStore(c.Context().ElasticConnection, assignmentDocument)
+	case "file":
+		return NewFileStore(c.DispatchAssignmentFile), nil
+	}
+
+	return nil, errors.Errorf("unknown dispatch lease backend %q", c.DispatchLeaseBackend)
+}
+
+type assignmentsDocument struct {
+	Workers Assignments
+}
+
+// ElasticStore keeps the assignments in a document of the dispatch index.
+type ElasticStore struct {
+	connector *config.ElasticConnector
+	id        string
+}
+
+// NewElasticStore creates a store using the document with the given id.
+func NewElasticStore(connector *config.ElasticConnector, id string) (*ElasticStore, error) {
+	if err := connector.EnsureIndex(Index, indexMapping); err != nil {
+		return nil, err
+	}
+
+	return &ElasticStore{connector: connector, id: id}, nil
+}
+
+// Load returns the stored assignments, or empty assignments if there are none yet.
+func (e *ElasticStore) Load(ctx context.Context) (Assignments, error) {
+	res, err := e.connector.GetClient().Get().Index(Index).Id(e.id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return Assignments{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc assignmentsDocument
+	if err := json.Unmarshal(res.Source, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Workers == nil {
+		doc.Workers = Assignments{}
+	}
+	return doc.Workers, nil
+}
+
+// Save replaces the stored assignments.
+func (e *ElasticStore) Save(ctx context.Context, a Assignments) error {
+	_, err := e.connector.GetClient().Index().Index(Index).Id(e.id).
+		BodyJson(assignmentsDocument{Workers: a}).
+		Refresh("true").
+		Do(ctx)
+	return err
+}
+
+// FileStore keeps the assignments in a local JSON file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore creates a store writing to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load returns the stored assignments, or empty assignments if the file does not exist.
+func (f *FileStore) Load(ctx context.Context) (Assignments, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return Assignments{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	a := Assignments{}
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Save atomically replaces the assignment file.
+func (f *FileStore) Save(ctx context.Context, a Assignments) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// MemoryStore keeps the assignments in memory, for dispatchers sharing a process.
+type MemoryStore struct {
+	mu sync.Mutex
+	a  Assignments
+}
+
+// NewMemoryStore creates an empty in-process store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{a: Assignments{}}
+}
+
+// Load returns a copy of the stored assignments.
+func (m *MemoryStore) Load(ctx context.Context) (Assignments, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.a.copy(), nil
+}
+
+// Save replaces the stored assignments.
+func (m *MemoryStore) Save(ctx context.Context, a Assignments) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.a = a.copy()
+	return nil
+}
+
+func (a Assignments) copy() Assignments {
+	c := Assignments{}
+	for w, channels := range a {
+		c[w] = append([]string{}, channels...)
+	}
+	return c
+}
@@ -0,0 +1,85 @@
+package dispatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ChannelSource returns the full list of channels that should be monitored.
+type ChannelSource func(ctx context.Context) ([]string, error)
+
+// Dispatcher distributes channels over workers while it is the elected leader.
+// Any number of dispatchers can run against the same lease, the standbys take
+// over the stored assignments when the leader goes away.
+type Dispatcher struct {
+	Elector  *Elector
+	Store    Store
+	Source   ChannelSource
+	Workers  []string
+	Interval time.Duration
+
+	// Replication maps channels to the number of workers that should join them
+	Replication map[string]int
+
+	l logrus.FieldLogger
+}
+
+// NewDispatcher creates a dispatcher.
+func NewDispatcher(elector *Elector, store Store, source ChannelSource, workers []string, interval time.Duration, l logrus.FieldLogger) *Dispatcher {
+	return &Dispatcher{
+		Elector:  elector,
+		Store:    store,
+		Source:   source,
+		Workers:  workers,
+		Interval: interval,
+		l:        l,
+	}
+}
+
+// Run campaigns for leadership and dispatches while elected, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.Elector.Run(ctx, d.lead)
+}
+
+func (d *Dispatcher) lead(ctx context.Context) {
+	for {
+		if err := d.Dispatch(ctx); err != nil {
+			d.l.WithError(err).Errorln("Could not dispatch channels")
+		}
+
+		select {
+		case <-time.After(d.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Dispatch refreshes the channel list and stores the updated assignments,
+// keeping every channel that is still wanted on the worker it is already on.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	current, err := d.Store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	channels, err := d.Source(ctx)
+	if err != nil {
+		return err
+	}
+
+	next := Assign(current, d.Workers, channels, d.Replication)
+
+	// Leadership may have been lost while fetching the channel list
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := d.Store.Save(ctx, next); err != nil {
+		return err
+	}
+
+	d.l.Infof("Dispatched %d channels to %d workers", len(channels), len(d.Workers))
+	return nil
+}
@@ -0,0 +1,118 @@
+package dispatch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStandbyTakesOverAssignments(t *testing.T) {
+	lease := NewMemoryLease()
+	store := NewMemoryStore()
+	l := logrus.New()
+	l.SetLevel(logrus.PanicLevel)
+
+	channels := []string{"a", "b", "c", "d", "e"}
+	source := func(ctx context.Context) ([]string, error) { return channels, nil }
+	ttl := 60 * time.Millisecond
+
+	first := NewDispatcher(NewElector(lease, "first", ttl, l), store, source, []string{"w1", "w2", "w3"}, 10*time.Millisecond, l)
+	// The standby lists the workers in another order, so assigning from scratch would place channels differently
+	second := NewDispatcher(NewElector(lease, "second", ttl, l), store, source, []string{"w3", "w2", "w1"}, 10*time.Millisecond, l)
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := make(chan struct{})
+	go func() {
+		first.Run(firstCtx)
+		close(firstDone)
+	}()
+	waitFor(t, "the first dispatcher to lead", first.Elector.IsLeader)
+	waitFor(t, "the first assignments", func() bool {
+		a, _ := store.Load(context.Background())
+		return len(a) == 3
+	})
+	placed, _ := store.Load(context.Background())
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+	go second.Run(secondCtx)
+
+	time.Sleep(ttl)
+	if second.Elector.IsLeader() {
+		t.Fatal("the standby was elected while the leader held the lease")
+	}
+
+	stopFirst()
+	<-firstDone
+	if first.Elector.IsLeader() {
+		t.Fatal("the stopped dispatcher still reports leadership")
+	}
+	waitFor(t, "the standby to take over", second.Elector.IsLeader)
+
+	// Let the new leader dispatch a few times
+	time.Sleep(50 * time.Millisecond)
+	got, _ := store.Load(context.Background())
+	if !reflect.DeepEqual(got, placed) {
+		t.Errorf("the new leader reshuffled the placements:\n got %v\nwant %v", got, placed)
+	}
+	if fresh := Assign(Assignments{}, second.Workers, channels, nil); reflect.DeepEqual(fresh, placed) {
+		t.Fatal("test setup: assigning from scratch gives the same placements")
+	}
+}
+
+func TestWatchSendsChangedAssignments(t *testing.T) {
+	store := NewMemoryStore()
+	store.Save(context.Background(), Assignments{"w1": {"a", "b"}})
+	l := logrus.New()
+	l.SetLevel(logrus.PanicLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := Watch(ctx, store, "w1", []string{"b", "a"}, 5*time.Millisecond, l)
+
+	store.Save(context.Background(), Assignments{"w1": {"a", "c"}})
+	select {
+	case got := <-updates:
+		if !reflect.DeepEqual(got, []string{"a", "c"}) {
+			t.Errorf("got %v, want [a c]", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no update was sent")
+	}
+
+	cancel()
+	for range updates {
+	}
+}
+
+func TestPrimaryIsLowestWorker(t *testing.T) {
+	a := Assignments{
+		"w1": {"a", "b"},
+		"w2": {"b", "c"},
+		"w3": {"c", "a", "d"},
+	}
+	for worker, want := range map[string][]string{
+		"w1": {"a", "b"},
+		"w2": {"c"},
+		"w3": {"d"},
+		"w4": {},
+	} {
+		if got := a.Primary(worker); !reflect.DeepEqual(got, want) {
+			t.Errorf("Primary(%s) = %v, want %v", worker, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Elector campaigns for a lease and tracks whether this instance is the leader.
+type Elector struct {
+	lease Lease
+	id    string
+	ttl   time.Duration
+	l     logrus.FieldLogger
+
+	mu      sync.Mutex
+	leader  bool
+	renewed time.Time
+}
+
+// NewElector creates an elector campaigning as id. The lease is renewed
+// every third of the ttl.
+func NewElector(lease Lease, id string, ttl time.Duration, l logrus.FieldLogger) *Elector {
+	return &Elector{
+		lease: lease,
+		id:    id,
+		ttl:   ttl,
+		l:     l,
+	}
+}
+
+// ID returns the holder id this elector campaigns with.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// IsLeader reports whether this instance currently holds the lease.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Run campaigns until ctx is done. Whenever leadership is gained, lead is started
+// in its own goroutine with a context that is cancelled as soon as the lease is lost.
+// The lease is released on return so a standby can take over immediately.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	var stop func()
+
+	demote := func() {
+		if stop != nil {
+			stop()
+			stop = nil
+		}
+		e.setLeader(false)
+	}
+
+	for {
+		acquired, err := e.lease.Acquire(ctx, e.id, e.ttl)
+		if err != nil {
+			e.l.WithError(err).Warnln("Could not renew dispatcher lease")
+			// We can't tell if we still own the lease, keep leading until it must have expired
+			acquired = e.IsLeader() && time.Since(e.lastRenewed()) < e.ttl
+		} else if acquired {
+			e.markRenewed()
+		}
+
+		if acquired && stop == nil {
+			e.l.Infof("Dispatcher %s elected leader", e.id)
+			e.setLeader(true)
+			stop = e.start(ctx, lead)
+		} else if !acquired && stop != nil {
+			e.l.Warnf("Dispatcher %s lost leadership", e.id)
+			demote()
+		}
+
+		select {
+		case <-time.After(e.ttl / 3):
+		case <-ctx.Done():
+			demote()
+			if err := e.lease.Release(context.Background(), e.id); err != nil {
+				e.l.WithError(err).Warnln("Could not release dispatcher lease")
+			}
+			return
+		}
+	}
+}
+
+// start runs lead in the background and returns a func that cancels it and waits for it to return.
+func (e *Elector) start(ctx context.Context, lead func(ctx context.Context)) func() {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = leader
+}
+
+func (e *Elector) markRenewed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.renewed = time.Now()
+}
+
+func (e *Elector) lastRenewed() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.renewed
+}
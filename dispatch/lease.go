@@ -0,0 +1,70 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/pkg/errors"
+)
+
+// Lease is an expiring, mutually exclusive claim on dispatcher leadership.
+type Lease interface {
+	// Acquire takes the lease for holder, or renews it if holder already owns it.
+	// It returns false without an error when another holder owns an unexpired lease.
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release gives up the lease if it is owned by holder.
+	Release(ctx context.Context, holder string) error
+}
+
+// NewLease creates the lease backend selected by DISPATCH_LEASE_BACKEND.
+func NewLease(c *config.Config) (Lease, error) {
+	switch c.DispatchLeaseBackend {
+	case "", "elastic":
+		return NewElasticLease(c.Context().ElasticConnection, leaderDocument)
+	case "file":
+		return NewFileLease(c.DispatchLeaseFile), nil
+	}
+
+	return nil, errors.Errorf("unknown dispatch lease backend %q", c.DispatchLeaseBackend)
+}
+
+// MemoryLease is a lease shared between dispatchers living in the same process.
+type MemoryLease struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+// NewMemoryLease creates an unowned in-process lease.
+func NewMemoryLease() *MemoryLease {
+	return &MemoryLease{}
+}
+
+// Acquire takes or renews the lease for holder.
+func (m *MemoryLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.holder != "" && m.holder != holder && now.Before(m.expires) {
+		return false, nil
+	}
+
+	m.holder = holder
+	m.expires = now.Add(ttl)
+	return true, nil
+}
+
+// Release gives up the lease if it is owned by holder.
+func (m *MemoryLease) Release(ctx context.Context, holder string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.holder == holder {
+		m.holder = ""
+		m.expires = time.Time{}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// Index holds the dispatcher lease and assignment documents.
+	Index = "dispatch"
+
+	leaderDocument     = "leader"
+	assignmentDocument = "assignments"
+)
+
+const indexMapping = `
+{
+	"mappings":{
+		"enabled": false
+	}
+}`
+
+type leaseDocument struct {
+	Holder  string
+	Expires time.Time
+}
+
+// ElasticLease stores the lease as a single elasticsearch document and uses
+// sequence numbers for optimistic concurrency, so two dispatchers racing for
+// an expired lease can never both win. Expiry relies on reasonably synced clocks.
+type ElasticLease struct {
+	connector *config.ElasticConnector
+	id        string
+}
+
+// NewElasticLease creates a lease stored in the document with the given id.
+func NewElasticLease(connector *config.ElasticConnector, id string) (*ElasticLease, error) {
+	if err := connector.EnsureIndex(Index, indexMapping); err != nil {
+		return nil, err
+	}
+
+	return &ElasticLease{connector: connector, id: id}, nil
+}
+
+// Acquire takes or renews the lease for holder.
+func (e *ElasticLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	client := e.connector.GetClient()
+	next := leaseDocument{Holder: holder, Expires: time.Now().UTC().Add(ttl)}
+
+	res, err := client.Get().Index(Index).Id(e.id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		_, err = client.Index().Index(Index).Id(e.id).OpType("create").BodyJson(next).Refresh("true").Do(ctx)
+		if elastic.IsConflict(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var current leaseDocument
+	if err := json.Unmarshal(res.Source, &current); err != nil {
+		return false, err
+	}
+
+	if current.Holder != "" && current.Holder != holder && time.Now().Before(current.Expires) {
+		return false, nil
+	}
+
+	_, err = client.Index().Index(Index).Id(e.id).
+		IfSeqNo(*res.SeqNo).
+		IfPrimaryTerm(*res.PrimaryTerm).
+		BodyJson(next).
+		Refresh("true").
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release gives up the lease if it is owned by holder.
+func (e *ElasticLease) Release(ctx context.Context, holder string) error {
+	client := e.connector.GetClient()
+
+	res, err := client.Get().Index(Index).Id(e.id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var current leaseDocument
+	if err := json.Unmarshal(res.Source, &current); err != nil {
+		return err
+	}
+	if current.Holder != holder {
+		return nil
+	}
+
+	_, err = client.Index().Index(Index).Id(e.id).
+		IfSeqNo(*res.SeqNo).
+		IfPrimaryTerm(*res.PrimaryTerm).
+		BodyJson(leaseDocument{}).
+		Refresh("true").
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return nil
+	}
+	return err
+}
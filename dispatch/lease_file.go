@@ -0,0 +1,74 @@
+// +build !windows
+
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLease uses an exclusive flock on a local file, for dispatchers sharing a
+// single host. The kernel drops the lock when the owning process dies, so the
+// ttl is not needed to detect a crashed leader.
+type FileLease struct {
+	path string
+
+	mu     sync.Mutex
+	file   *os.File
+	holder string
+}
+
+// NewFileLease creates a lease backed by the lock file at path.
+func NewFileLease(path string) *FileLease {
+	return &FileLease{path: path}
+}
+
+// Acquire takes the lock for holder if no other process holds it.
+func (f *FileLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		return f.holder == holder, nil
+	}
+
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, err
+	}
+
+	file.Truncate(0)
+	fmt.Fprintf(file, "%s\n", holder)
+
+	f.file = file
+	f.holder = holder
+	return true, nil
+}
+
+// Release unlocks the file if it is held by holder.
+func (f *FileLease) Release(ctx context.Context, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil || f.holder != holder {
+		return nil
+	}
+
+	err := syscall.Flock(int(f.file.Fd()), syscall.LOCK_UN)
+	f.file.Close()
+	f.file = nil
+	f.holder = ""
+	return err
+}
@@ -0,0 +1,26 @@
+package dispatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FileLease is not supported on windows.
+type FileLease struct{}
+
+// NewFileLease creates a lease that always fails, flock is not available on windows.
+func NewFileLease(path string) *FileLease {
+	return &FileLease{}
+}
+
+// Acquire always fails.
+func (f *FileLease) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return false, errors.New("file leases are not supported on windows")
+}
+
+// Release is a noop.
+func (f *FileLease) Release(ctx context.Context, holder string) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+package dispatch
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Watch polls the stored assignments every interval and sends the channels of
+// worker whenever they differ from the last ones seen, starting with current.
+// This is how workers pick up a new leader's placements and reassignments.
+// The returned channel is closed when ctx is done.
+func Watch(ctx context.Context, store Store, worker string, current []string, interval time.Duration, l logrus.FieldLogger) <-chan []string {
+	return watch(ctx, store, current, interval, l, func(a Assignments) []string {
+		return a[worker]
+	})
+}
+
+// WatchPrimary is Watch for the channels worker is the primary replica of.
+func WatchPrimary(ctx context.Context, store Store, worker string, current []string, interval time.Duration, l logrus.FieldLogger) <-chan []string {
+	return watch(ctx, store, current, interval, l, func(a Assignments) []string {
+		return a.Primary(worker)
+	})
+}
+
+func watch(ctx context.Context, store Store, current []string, interval time.Duration, l logrus.FieldLogger, pick func(Assignments) []string) <-chan []string {
+	updates := make(chan []string)
+	go func() {
+		defer close(updates)
+		for {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return
+			}
+
+			assignments, err := store.Load(ctx)
+			if err != nil {
+				l.WithError(err).Warnln("Could not load channel assignments")
+				continue
+			}
+
+			next := pick(assignments)
+			if sameChannels(current, next) {
+				continue
+			}
+			select {
+			case updates <- next:
+				current = next
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
+
+func sameChannels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
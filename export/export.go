@@ -0,0 +1,83 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/olivere/elastic/v7"
+)
+
+// batchSize is the number of messages fetched per scroll request
+const batchSize = 1000
+
+// Export streams every message matching query to w, oldest first. Messages are
+// fetched in batches through a scroll, so exports of any size use constant memory.
+// Copies logged by redundant workers are dropped like api.Dedupe does, see
+// irc.Message.Duplicates. It returns the number of exported messages.
+func Export(ctx context.Context, client *elastic.Client, query elastic.Query, w Writer, window time.Duration) (int, error) {
+	scroll := client.Scroll("twitch").
+		Query(query).
+		Sort("Timestamp", true).
+		Size(batchSize).
+		KeepAlive("2m")
+	defer scroll.Clear(context.Background())
+
+	var recent []irc.Message
+	n := 0
+	for {
+		res, err := scroll.Do(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+
+		for _, hit := range res.Hits.Hits {
+			var m irc.Message
+			if err := json.Unmarshal(hit.Source, &m); err != nil {
+				return n, err
+			}
+			m.ID = irc.TwitchID(hit.Id)
+			var duplicate bool
+			if recent, duplicate = dedupe(recent, m, window); duplicate {
+				continue
+			}
+			if err := w.Write(hit.Id, m); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		// Hand every batch to the client right away instead of buffering the export
+		if err := w.Flush(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, w.Flush()
+}
+
+// dedupe reports whether m is a copy of one of the recent messages, and
+// returns those sent within window before m, with m appended when it is kept.
+// recent must be sorted by timestamp.
+func dedupe(recent []irc.Message, m irc.Message, window time.Duration) ([]irc.Message, bool) {
+	if window <= 0 {
+		return nil, false
+	}
+
+	i := 0
+	for i < len(recent) && m.Timestamp.Sub(recent[i].Timestamp) > window {
+		i++
+	}
+	recent = recent[i:]
+	for _, prev := range recent {
+		if prev.Duplicates(m, window) {
+			return recent, true
+		}
+	}
+	return append(recent, m), false
+}
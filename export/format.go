@@ -0,0 +1,157 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/pkg/errors"
+)
+
+// Supported export formats.
+const (
+	// Text is the justlog plain text format, "[2006-01-02 15:04:05] #channel user: message".
+	Text = "text"
+	// CSV has a header row and one row per message.
+	CSV = "csv"
+	// NDJSON is one JSON object per line.
+	NDJSON = "ndjson"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{Text, CSV, NDJSON}
+
+// Writer writes messages in an export format.
+type Writer interface {
+	Write(id string, m irc.Message) error
+	// Flush writes any buffered data to the underlying writer, and flushes
+	// that too if it has a Flush method, e.g. a gzip.Writer.
+	Flush() error
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// NewWriter creates a writer for format.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case Text, "":
+		return &textWriter{w: bufio.NewWriter(w), out: w}, nil
+	case CSV:
+		cw := &csvWriter{w: csv.NewWriter(w), out: w}
+		return cw, cw.w.Write([]string{"id", "timestamp", "channel", "user", "user_id", "type", "bits", "message"})
+	case NDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw), out: w}, nil
+	}
+
+	return nil, errors.Errorf("unknown export format %q", format)
+}
+
+func flush(out io.Writer) error {
+	if f, ok := out.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// Extension returns the file extension of format.
+func Extension(format string) string {
+	switch format {
+	case CSV:
+		return "csv"
+	case NDJSON:
+		return "ndjson"
+	}
+	return "txt"
+}
+
+type textWriter struct {
+	w   *bufio.Writer
+	out io.Writer
+}
+
+func (t *textWriter) Write(id string, m irc.Message) error {
+	ts := m.Timestamp.UTC().Format("2006-01-02 15:04:05")
+	switch m.Type {
+	case "", irc.TypeMessage, irc.TypeAction:
+		_, err := fmt.Fprintf(t.w, "[%s] %s %s: %s\n", ts, m.Channel, m.User, m.Message)
+		return err
+	}
+
+	// Events are marked with their type, e.g. "[timeout] user: 600"
+	_, err := fmt.Fprintf(t.w, "[%s] %s [%s] %s: %s\n", ts, m.Channel, m.Type, m.User, m.Message)
+	return err
+}
+
+func (t *textWriter) Flush() error {
+	if err := t.w.Flush(); err != nil {
+		return err
+	}
+	return flush(t.out)
+}
+
+type csvWriter struct {
+	w   *csv.Writer
+	out io.Writer
+}
+
+func (c *csvWriter) Write(id string, m irc.Message) error {
+	return c.w.Write([]string{
+		id,
+		m.Timestamp.UTC().Format(time.RFC3339Nano),
+		m.Channel,
+		m.User,
+		m.UserID,
+		m.Type,
+		strconv.Itoa(m.Bits),
+		m.Message,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return flush(c.out)
+}
+
+type record struct {
+	ID string `json:"Id"`
+	irc.Message
+}
+
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+	out io.Writer
+}
+
+func (n *ndjsonWriter) Write(id string, m irc.Message) error {
+	return n.enc.Encode(record{ID: id, Message: m})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	if err := n.w.Flush(); err != nil {
+		return err
+	}
+	return flush(n.out)
+}
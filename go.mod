@@ -1,11 +1,13 @@
 module github.com/djdduty/ttv-log
 
-go 1.12
+go 1.16
 
 require (
 	github.com/fluffle/goirc v1.0.1
 	github.com/gorilla/context v1.1.1
 	github.com/gorilla/csrf v1.5.1
+	github.com/gorilla/websocket v1.4.2
+	github.com/graphql-go/graphql v0.8.1
 	github.com/julienschmidt/httprouter v1.2.0
 	github.com/meatballhat/negroni-logrus v0.0.0-20170801195057-31067281800f
 	github.com/olivere/elastic/v7 v7.0.5
@@ -0,0 +1,146 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/djdduty/ttv-log/config"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+)
+
+// Path is the path of the GraphQL endpoint.
+const Path = "/api/graphql"
+
+// maxRequestSize limits the body of a POSTed query
+const maxRequestSize = 1 << 20
+
+// Handler handles GraphQL queries over the logged messages.
+type Handler struct {
+	R *render.Render
+	E *config.ElasticConnector
+	L logrus.FieldLogger
+
+	// DedupWindow is the window in which identical messages are treated as duplicates
+	DedupWindow time.Duration
+	// MaxDepth and MaxCost reject queries nesting fields too deep or
+	// estimated to make too many elasticsearch requests, see cost.
+	MaxDepth int
+	MaxCost  int
+
+	schema graphql.Schema
+}
+
+// NewHandler instantiates a handler.
+func NewHandler(r *render.Render, e *config.ElasticConnector, l logrus.FieldLogger) (*Handler, error) {
+	h := &Handler{
+		R:        r,
+		E:        e,
+		L:        l,
+		MaxDepth: 10,
+		MaxCost:  1000,
+	}
+
+	schema, err := h.newSchema()
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+	return h, nil
+}
+
+// SetRoutes registers this handler's routes.
+func (h *Handler) SetRoutes(r *httprouter.Router) {
+	r.GET(Path, h.Query)
+	r.POST(Path, h.Query)
+}
+
+// request is a GraphQL query as POSTed in the body, or passed as GET parameters.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Query runs a GraphQL query. Queries that are invalid, or exceed the depth
+// or cost limits, are rejected before anything is looked up.
+//
+// swagger:route POST /api/graphql graphql queryGraphQL
+//
+// Run a GraphQL query
+func (h *Handler) Query(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req request
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+			h.R.Text(rw, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		queryValues := r.URL.Query()
+		req.Query = queryValues.Get("query")
+		req.OperationName = queryValues.Get("operationName")
+		if v := queryValues.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				h.R.Text(rw, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+	if req.Query == "" {
+		h.R.Text(rw, http.StatusBadRequest, "query is missing")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		h.R.JSON(rw, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if v := graphql.ValidateDocument(&h.schema, doc, nil); !v.IsValid {
+		h.R.JSON(rw, http.StatusBadRequest, &graphql.Result{Errors: v.Errors})
+		return
+	}
+	if err := h.checkLimits(doc, req.OperationName, req.Variables); err != nil {
+		h.R.JSON(rw, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 10*time.Second)
+	defer cancel()
+	ctx = apikey.WithAccess(ctx, apikey.FromContext(r.Context()))
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	h.R.JSON(rw, http.StatusOK, result)
+}
+
+// operation finds the operation of doc to run, along with the fragments it may spread.
+func operation(doc *ast.Document, name string) (*ast.OperationDefinition, map[string]*ast.FragmentDefinition) {
+	var op *ast.OperationDefinition
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.OperationDefinition:
+			if op == nil && (name == "" || def.Name != nil && def.Name.Value == name) {
+				op = def
+			}
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		}
+	}
+	return op, fragments
+}
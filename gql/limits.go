@@ -0,0 +1,193 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// aggregationCost is what an aggregation costs compared to fetching a page of messages
+const aggregationCost = 10
+
+// cost is what resolving a field costs in elasticsearch requests, on top of its selections.
+type cost struct {
+	// requests is the number of requests the field makes.
+	requests int
+	// paged fields resolve their selections once per item, up to their first argument.
+	paged bool
+	// shared names fields answered by one request, which is counted once per selection set.
+	shared string
+}
+
+// costs lists the fields making requests. Every other field is free.
+var costs = map[string]cost{
+	"Query.channels":       {requests: aggregationCost, paged: true},
+	"Query.user":           {requests: 1},
+	"Query.message":        {requests: 1},
+	"Query.messages":       {requests: 1, paged: true},
+	"Query.events":         {requests: 1, paged: true},
+	"Channel.messageCount": {requests: 1},
+	"Channel.topUsers":     {requests: aggregationCost, paged: true},
+	"Channel.messages":     {requests: 1, paged: true},
+	"Channel.events":       {requests: 1, paged: true},
+	"User.id":              {requests: 1},
+	"User.currentName":     {requests: aggregationCost, shared: "summary"},
+	"User.firstSeen":       {requests: aggregationCost, shared: "summary"},
+	"User.lastSeen":        {requests: aggregationCost, shared: "summary"},
+	"User.messageCount":    {requests: aggregationCost, shared: "summary"},
+	"User.channels":        {requests: aggregationCost, paged: true, shared: "summary"},
+	"User.names":           {requests: aggregationCost, shared: "summary"},
+	"User.messages":        {requests: 1, paged: true},
+	"User.events":          {requests: 1, paged: true},
+}
+
+// checkLimits estimates the depth and cost of the operation to run before it is
+// executed. Paged fields are assumed to return full pages, so the cost is an
+// upper bound. Introspection is free.
+func (h *Handler) checkLimits(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	op, fragments := operation(doc, operationName)
+	if op == nil {
+		return fmt.Errorf("unknown operation %q", operationName)
+	}
+
+	e := estimate{fragments: fragments, variables: withDefaults(op, variables), spread: map[string]bool{}}
+	depth, total := e.selections(h.schema.QueryType(), op.SelectionSet, map[string]bool{})
+	if h.MaxDepth > 0 && depth > h.MaxDepth {
+		return fmt.Errorf("query is %d fields deep, at most %d are allowed", depth, h.MaxDepth)
+	}
+	if h.MaxCost > 0 && total > h.MaxCost {
+		return fmt.Errorf("query costs up to %d, at most %d is allowed, request smaller pages", total, h.MaxCost)
+	}
+	return nil
+}
+
+// estimate walks the selections of an operation.
+type estimate struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	spread    map[string]bool
+}
+
+// selections returns the depth and cost of a selection set on parent. Shared
+// requests already counted in the selection set are in charged.
+func (e *estimate) selections(parent *graphql.Object, set *ast.SelectionSet, charged map[string]bool) (depth, total int) {
+	if parent == nil || set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			name := selection.Name.Value
+			def, ok := parent.Fields()[name]
+			if !ok || strings.HasPrefix(name, "__") {
+				continue
+			}
+
+			child, _ := named(def.Type).(*graphql.Object)
+			d, c = e.selections(child, selection.SelectionSet, map[string]bool{})
+			d++
+
+			fc := costs[parent.Name()+"."+name]
+			if fc.paged {
+				c *= e.first(def, selection)
+			}
+			if fc.shared == "" || !charged[fc.shared] {
+				c += fc.requests
+				if fc.shared != "" {
+					charged[fc.shared] = true
+				}
+			}
+		case *ast.InlineFragment:
+			d, c = e.selections(parent, selection.SelectionSet, charged)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := e.fragments[name]
+			if !ok || e.spread[name] {
+				continue
+			}
+			e.spread[name] = true
+			d, c = e.selections(parent, fragment.SelectionSet, charged)
+			delete(e.spread, name)
+		}
+
+		if d > depth {
+			depth = d
+		}
+		total += c
+	}
+	return depth, total
+}
+
+// withDefaults returns the variables with the defaults the operation declares
+// for the ones that weren't given.
+func withDefaults(op *ast.OperationDefinition, variables map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, def := range op.VariableDefinitions {
+		if v, ok := def.DefaultValue.(*ast.IntValue); ok && def.Variable != nil {
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				merged[def.Variable.Name.Value] = n
+			}
+		}
+	}
+	for name, v := range variables {
+		merged[name] = v
+	}
+	return merged
+}
+
+// first reads the page size a field is queried with. Sizes that aren't
+// positive are rejected by the resolvers, they are charged as full pages so
+// they can't make a subtree cheaper.
+func (e *estimate) first(def *graphql.FieldDefinition, field *ast.Field) int {
+	if n, ok := e.firstArg(def, field); ok && n > 0 {
+		return n
+	}
+	return maxFirst
+}
+
+func (e *estimate) firstArg(def *graphql.FieldDefinition, field *ast.Field) (int, bool) {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return n, true
+			}
+		case *ast.Variable:
+			switch n := e.variables[v.Name.Value].(type) {
+			case float64:
+				return int(n), true
+			case int:
+				return n, true
+			}
+		}
+	}
+
+	for _, arg := range def.Args {
+		if n, ok := arg.DefaultValue.(int); ok && arg.Name() == "first" {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// named unwraps lists and non-null types.
+func named(t graphql.Type) graphql.Type {
+	for {
+		switch wrapped := t.(type) {
+		case *graphql.List:
+			t = wrapped.OfType
+		case *graphql.NonNull:
+			t = wrapped.OfType
+		default:
+			return t
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package gql
+
+import (
+	"testing"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+)
+
+func TestCheckLimits(t *testing.T) {
+	l := logrus.New()
+	l.SetLevel(logrus.PanicLevel)
+	h, err := NewHandler(render.New(), &config.ElasticConnector{}, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.MaxDepth = 4
+	h.MaxCost = 100
+
+	for _, tc := range []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		ok        bool
+	}{
+		{
+			name:  "small page",
+			query: `{ channels(first: 5) { messageCount } }`,
+			ok:    true,
+		},
+		{
+			name:  "argument default",
+			query: `{ channels { messageCount } }`,
+			ok:    true,
+		},
+		{
+			name:  "negative first",
+			query: `{ channels(first: -5) { messages(first: 100) { nodes { id } } } }`,
+		},
+		{
+			name:  "zero first",
+			query: `{ channels(first: 0) { messageCount } }`,
+		},
+		{
+			name:      "negative first variable",
+			query:     `query($n: Int) { channels(first: $n) { messageCount } }`,
+			variables: map[string]interface{}{"n": float64(-5)},
+		},
+		{
+			name:  "variable default",
+			query: `query($n: Int = 100) { channels(first: $n) { messageCount } }`,
+		},
+		{
+			name:      "variable overrides default",
+			query:     `query($n: Int = 100) { channels(first: $n) { messageCount } }`,
+			variables: map[string]interface{}{"n": float64(5)},
+			ok:        true,
+		},
+		{
+			name:  "shared user summary",
+			query: `{ user(login: "a") { firstSeen lastSeen messageCount } }`,
+			ok:    true,
+		},
+		{
+			name:  "too deep",
+			query: `{ channels(first: 1) { messages(first: 1) { nodes { user { login } } } } }`,
+		},
+	} {
+		doc, err := parser.Parse(parser.ParseParams{Source: tc.query})
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		err = h.checkLimits(doc, "", tc.variables)
+		if tc.ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s: query was allowed", tc.name)
+		}
+	}
+}
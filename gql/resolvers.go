@@ -0,0 +1,531 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/api"
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/graphql-go/graphql"
+	"github.com/olivere/elastic/v7"
+)
+
+// chatTypes are the types of messages, everything else is an event
+var chatTypes = []string{"message", "action"}
+
+// channel is a channel, with its number of messages when it came out of an aggregation.
+type channel struct {
+	name  string
+	count *int64
+}
+
+// user is an account that is looked up lazily, so selecting only its login costs nothing.
+type user struct {
+	login string
+	at    time.Time
+
+	idOnce sync.Once
+	id     string
+	idErr  error
+
+	legacyOnce sync.Once
+	legacy     string
+	legacyErr  error
+
+	summaryOnce sync.Once
+	summary     *api.UserSummary
+	summaryErr  error
+}
+
+// knownUser is a user whose id is already known, an empty id included.
+func knownUser(login, id string) *user {
+	u := &user{login: login}
+	u.idOnce.Do(func() { u.id = id })
+	return u
+}
+
+func (u *user) resolveID(ctx context.Context, client *elastic.Client) (string, error) {
+	u.idOnce.Do(func() {
+		u.id, u.idErr = api.ResolveUserID(ctx, client, u.login, u.at)
+	})
+	return u.id, u.idErr
+}
+
+// resolveLegacy returns the login matching the user's messages without a user id, see api.LegacyLogin.
+func (u *user) resolveLegacy(ctx context.Context, client *elastic.Client) (string, error) {
+	u.legacyOnce.Do(func() {
+		var id string
+		if id, u.legacyErr = u.resolveID(ctx, client); u.legacyErr == nil {
+			u.legacy, u.legacyErr = api.LegacyLogin(ctx, client, id, u.login)
+		}
+	})
+	return u.legacy, u.legacyErr
+}
+
+func (u *user) resolveSummary(ctx context.Context, client *elastic.Client) (*api.UserSummary, error) {
+	u.summaryOnce.Do(func() {
+		var id string
+		if id, u.summaryErr = u.resolveID(ctx, client); u.summaryErr == nil {
+			u.summary, u.summaryErr = api.FindUserSummary(ctx, client, id, u.login, apikey.FromContext(ctx).Hidden()...)
+		}
+	})
+	return u.summary, u.summaryErr
+}
+
+// page is a page of a message or event connection.
+type page struct {
+	messages []*api.Message
+	total    int64
+	hasNext  bool
+	hasPrev  bool
+	start    string
+	end      string
+}
+
+type edge struct {
+	Cursor string       `json:"cursor"`
+	Node   *api.Message `json:"node"`
+}
+
+type pageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type channelCount struct {
+	Channel      *channel `json:"channel"`
+	MessageCount int64    `json:"messageCount"`
+}
+
+type userCount struct {
+	User         *user `json:"user"`
+	MessageCount int64 `json:"messageCount"`
+}
+
+type name struct {
+	Login        string    `json:"login"`
+	FirstSeen    time.Time `json:"firstSeen"`
+	LastSeen     time.Time `json:"lastSeen"`
+	MessageCount int64     `json:"messageCount"`
+}
+
+func queryChannel(p graphql.ResolveParams) (interface{}, error) {
+	name := channelArg(p.Args["name"].(string))
+	if !apikey.FromContext(p.Context).CanRead(name) {
+		return nil, fmt.Errorf("channel %s is private", name)
+	}
+	return &channel{name: name}, nil
+}
+
+func (h *Handler) queryChannels(p graphql.ResolveParams) (interface{}, error) {
+	first, err := firstArg(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	q := api.NewFinder().ExcludeChannels(apikey.FromContext(p.Context).Hidden()...).Filter()
+	sr, err := h.E.GetClient().Search().Index("twitch").Query(q).Size(0).
+		Aggregation("channels", elastic.NewTermsAggregation().Field("Channel.keyword").Size(first)).
+		Do(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []*channel{}
+	if agg, found := sr.Aggregations.Terms("channels"); found {
+		for _, bucket := range agg.Buckets {
+			count := bucket.DocCount
+			channels = append(channels, &channel{name: channelArg(fmt.Sprint(bucket.Key)), count: &count})
+		}
+	}
+	return channels, nil
+}
+
+func (h *Handler) queryUser(p graphql.ResolveParams) (interface{}, error) {
+	u := &user{login: strings.ToLower(p.Args["login"].(string)), at: time.Now().UTC()}
+	if at, ok := p.Args["at"].(time.Time); ok {
+		u.at = at
+	}
+	if _, err := u.resolveID(p.Context, h.E.GetClient()); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (h *Handler) queryMessage(p graphql.ResolveParams) (interface{}, error) {
+	res, err := h.E.GetClient().Get().Index("twitch").Id(p.Args["id"].(string)).Do(p.Context)
+	if elastic.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(api.Message)
+	if err := json.Unmarshal(res.Source, m); err != nil {
+		return nil, err
+	}
+	m.ID = res.Id
+	if !apikey.FromContext(p.Context).CanRead(m.Channel) {
+		return nil, nil
+	}
+	return m, nil
+}
+
+func (h *Handler) queryMessages(p graphql.ResolveParams) (interface{}, error) {
+	return h.findPage(p, api.NewFinder().Types(chatTypes...))
+}
+
+func (h *Handler) queryEvents(p graphql.ResolveParams) (interface{}, error) {
+	return h.findPage(p, api.NewFinder().ExcludeTypes(chatTypes...))
+}
+
+func channelName(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*channel).name, nil
+}
+
+func (h *Handler) channelMessageCount(p graphql.ResolveParams) (interface{}, error) {
+	ch := p.Source.(*channel)
+	if ch.count != nil {
+		return *ch.count, nil
+	}
+
+	q := api.NewFinder().Channels(ch.name).Filter()
+	return h.E.GetClient().Count("twitch").Query(q).Do(p.Context)
+}
+
+func (h *Handler) channelTopUsers(p graphql.ResolveParams) (interface{}, error) {
+	first, err := firstArg(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	from, _ := p.Args["from"].(time.Time)
+	to, _ := p.Args["to"].(time.Time)
+	q := api.NewFinder().Channels(p.Source.(*channel).name).Types(chatTypes...).Between(from, to).Filter()
+
+	sr, err := h.E.GetClient().Search().Index("twitch").Query(q).Size(0).
+		Aggregation("users", elastic.NewTermsAggregation().Field("User.keyword").Size(first)).
+		Do(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*userCount{}
+	if agg, found := sr.Aggregations.Terms("users"); found {
+		at := time.Now().UTC()
+		if !to.IsZero() {
+			at = to
+		}
+		for _, bucket := range agg.Buckets {
+			users = append(users, &userCount{
+				User:         &user{login: fmt.Sprint(bucket.Key), at: at},
+				MessageCount: bucket.DocCount,
+			})
+		}
+	}
+	return users, nil
+}
+
+func (h *Handler) channelMessages(p graphql.ResolveParams) (interface{}, error) {
+	return h.findPage(p, api.NewFinder().Channels(p.Source.(*channel).name).Types(chatTypes...))
+}
+
+func (h *Handler) channelEvents(p graphql.ResolveParams) (interface{}, error) {
+	return h.findPage(p, api.NewFinder().Channels(p.Source.(*channel).name).ExcludeTypes(chatTypes...))
+}
+
+func userLogin(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*user).login, nil
+}
+
+func (h *Handler) userID(p graphql.ResolveParams) (interface{}, error) {
+	id, err := p.Source.(*user).resolveID(p.Context, h.E.GetClient())
+	if err != nil || id == "" {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (h *Handler) userCurrentName(p graphql.ResolveParams) (interface{}, error) {
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil || summary.CurrentName == "" {
+		return nil, err
+	}
+	return summary.CurrentName, nil
+}
+
+func (h *Handler) userFirstSeen(p graphql.ResolveParams) (interface{}, error) {
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil || summary.FirstSeen == nil {
+		return nil, err
+	}
+	return *summary.FirstSeen, nil
+}
+
+func (h *Handler) userLastSeen(p graphql.ResolveParams) (interface{}, error) {
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil || summary.LastSeen == nil {
+		return nil, err
+	}
+	return *summary.LastSeen, nil
+}
+
+func (h *Handler) userMessageCount(p graphql.ResolveParams) (interface{}, error) {
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+	return summary.NumMessages, nil
+}
+
+func (h *Handler) userChannels(p graphql.ResolveParams) (interface{}, error) {
+	first, err := firstArg(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []*channelCount{}
+	for _, ch := range summary.Channels {
+		if len(channels) == first {
+			break
+		}
+		channels = append(channels, &channelCount{Channel: &channel{name: ch.Name}, MessageCount: ch.NumMessages})
+	}
+	return channels, nil
+}
+
+func (h *Handler) userNames(p graphql.ResolveParams) (interface{}, error) {
+	summary, err := p.Source.(*user).resolveSummary(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+
+	names := []*name{}
+	for _, n := range summary.Names {
+		names = append(names, &name{Login: n.Name, FirstSeen: n.FirstSeen, LastSeen: n.LastSeen, MessageCount: n.NumMessages})
+	}
+	return names, nil
+}
+
+func (h *Handler) userMessages(p graphql.ResolveParams) (interface{}, error) {
+	finder, err := h.userFinder(p)
+	if err != nil {
+		return nil, err
+	}
+	return h.findPage(p, finder.Types(chatTypes...))
+}
+
+func (h *Handler) userEvents(p graphql.ResolveParams) (interface{}, error) {
+	finder, err := h.userFinder(p)
+	if err != nil {
+		return nil, err
+	}
+	return h.findPage(p, finder.ExcludeTypes(chatTypes...))
+}
+
+func (h *Handler) userFinder(p graphql.ResolveParams) (*api.Finder, error) {
+	u := p.Source.(*user)
+	id, err := u.resolveID(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+	legacy, err := u.resolveLegacy(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+	return api.NewFinder().Account(id, legacy), nil
+}
+
+func messageID(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*api.Message).ID, nil
+}
+
+func messageTimestamp(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*api.Message).Timestamp, nil
+}
+
+func messageText(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*api.Message).Message, nil
+}
+
+func messageType(p graphql.ResolveParams) (interface{}, error) {
+	if t := p.Source.(*api.Message).Type; t != "" {
+		return t, nil
+	}
+	// Messages logged before types were stored have no Type
+	return "message", nil
+}
+
+func messageBits(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*api.Message).Bits, nil
+}
+
+func messageEmotes(p graphql.ResolveParams) (interface{}, error) {
+	if emotes := p.Source.(*api.Message).Emotes; emotes != nil {
+		return emotes, nil
+	}
+	return []string{}, nil
+}
+
+func messageHighlights(p graphql.ResolveParams) (interface{}, error) {
+	if highlights := p.Source.(*api.Message).Highlights; highlights != nil {
+		return highlights, nil
+	}
+	return []string{}, nil
+}
+
+func messageChannel(p graphql.ResolveParams) (interface{}, error) {
+	return &channel{name: channelArg(p.Source.(*api.Message).Channel)}, nil
+}
+
+func messageUser(p graphql.ResolveParams) (interface{}, error) {
+	m := p.Source.(*api.Message)
+	if m.UserID != "" {
+		return knownUser(m.User, m.UserID), nil
+	}
+	return &user{login: m.User, at: m.Timestamp}, nil
+}
+
+func eventText(p graphql.ResolveParams) (interface{}, error) {
+	if text := p.Source.(*api.Message).Message; text != "" {
+		return text, nil
+	}
+	return nil, nil
+}
+
+func eventUser(p graphql.ResolveParams) (interface{}, error) {
+	if p.Source.(*api.Message).User == "" {
+		return nil, nil
+	}
+	return messageUser(p)
+}
+
+// findPage fetches a page of a message or event connection, narrowing finder
+// down by the filter arguments of the field. Private channels the request
+// can't read are left out.
+func (h *Handler) findPage(p graphql.ResolveParams, finder *api.Finder) (*page, error) {
+	first, err := firstArg(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	from, _ := p.Args["from"].(time.Time)
+	to, _ := p.Args["to"].(time.Time)
+	finder = finder.
+		Channels(stringsArg(p.Args, "channels")...).
+		ExcludeChannels(apikey.FromContext(p.Context).Hidden()...).
+		Users(stringsArg(p.Args, "users")...).
+		Types(stringsArg(p.Args, "types")...).
+		Between(from, to).
+		Size(first + 1)
+
+	if text, _ := p.Args["text"].(string); text != "" {
+		mode, _ := p.Args["mode"].(string)
+		finder = finder.Text(text, mode).Highlight(true)
+	}
+	if hasBits, _ := p.Args["hasBits"].(bool); hasBits {
+		finder = finder.HasBits(true)
+	}
+	if oldestFirst, _ := p.Args["oldestFirst"].(bool); oldestFirst {
+		finder = finder.Sort("Timestamp", "_id")
+	} else {
+		finder = finder.Sort("-Timestamp", "-_id")
+	}
+
+	after, _ := p.Args["after"].(string)
+	if after != "" {
+		values, err := api.DecodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		finder = finder.SearchAfter(values...)
+	}
+
+	found, err := finder.Find(p.Context, h.E.GetClient())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &page{total: found.Total, hasPrev: after != ""}
+	messages := found.Messages
+	if len(messages) > first {
+		messages = messages[:first]
+		result.hasNext = true
+	}
+	if n := len(messages); n > 0 {
+		result.start = messages[0].Cursor()
+		result.end = messages[n-1].Cursor()
+	}
+	result.messages = api.Dedupe(messages, h.DedupWindow)
+	return result, nil
+}
+
+func connectionEdges(p graphql.ResolveParams) (interface{}, error) {
+	messages := p.Source.(*page).messages
+	edges := make([]*edge, len(messages))
+	for i, m := range messages {
+		edges[i] = &edge{Cursor: m.Cursor(), Node: m}
+	}
+	return edges, nil
+}
+
+func connectionNodes(p graphql.ResolveParams) (interface{}, error) {
+	if messages := p.Source.(*page).messages; messages != nil {
+		return messages, nil
+	}
+	return []*api.Message{}, nil
+}
+
+func connectionPageInfo(p graphql.ResolveParams) (interface{}, error) {
+	result := p.Source.(*page)
+	info := &pageInfo{HasNextPage: result.hasNext, HasPreviousPage: result.hasPrev}
+	if result.start != "" {
+		info.StartCursor = &result.start
+		info.EndCursor = &result.end
+	}
+	return info, nil
+}
+
+func connectionTotalCount(p graphql.ResolveParams) (interface{}, error) {
+	return p.Source.(*page).total, nil
+}
+
+// firstArg reads the page size of a connection or list.
+func firstArg(args map[string]interface{}) (int, error) {
+	first, _ := args["first"].(int)
+	if first < 0 {
+		return 0, fmt.Errorf("first cannot be negative")
+	}
+	if first > maxFirst {
+		return 0, fmt.Errorf("first cannot exceed %d", maxFirst)
+	}
+	return first, nil
+}
+
+// stringsArg reads a list of strings.
+func stringsArg(args map[string]interface{}, key string) []string {
+	values, _ := args[key].([]interface{})
+	converted := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			converted = append(converted, s)
+		}
+	}
+	return converted
+}
+
+// channelArg normalizes a channel name to its form without the leading #.
+func channelArg(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "#"))
+}
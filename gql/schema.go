@@ -0,0 +1,317 @@
+package gql
+
+import (
+	"github.com/djdduty/ttv-log/api"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	// defaultFirst is the page size of connections
+	defaultFirst = 20
+	// maxFirst is the largest page size of connections and lists
+	maxFirst = 100
+)
+
+// newSchema builds the schema. Channel, User, Message and Event refer to each
+// other, so their fields are set up once all of them exist.
+func (h *Handler) newSchema() (graphql.Schema, error) {
+	matchMode := graphql.NewEnum(graphql.EnumConfig{
+		Name:        "MatchMode",
+		Description: "How the words of a text search are matched.",
+		Values: graphql.EnumValueConfigMap{
+			"MATCH": &graphql.EnumValueConfig{
+				Value:       api.MatchAll,
+				Description: "Every word appears, in any order.",
+			},
+			"PHRASE": &graphql.EnumValueConfig{
+				Value:       api.MatchPhrase,
+				Description: "The words appear in order.",
+			},
+			"PREFIX": &graphql.EnumValueConfig{
+				Value:       api.MatchPrefix,
+				Description: "A phrase whose last word may be incomplete.",
+			},
+			"FUZZY": &graphql.EnumValueConfig{
+				Value:       api.MatchFuzzy,
+				Description: "Every word appears, tolerating typos.",
+			},
+		},
+	})
+
+	pageInfo := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"startCursor":     &graphql.Field{Type: graphql.String},
+			"endCursor":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	channel := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Channel",
+		Description: "A logged twitch channel.",
+		Fields:      graphql.Fields{},
+	})
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "User",
+		Description: "A twitch account, or a login of users only logged before user ids were captured.",
+		Fields:      graphql.Fields{},
+	})
+
+	message := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Message",
+		Description: "A chat message.",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: messageID},
+			"timestamp": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: messageTimestamp},
+			"text":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: messageText},
+			"type": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "message or action.",
+				Resolve:     messageType,
+			},
+			"bits":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: messageBits},
+			"emotes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), Resolve: messageEmotes},
+			"highlights": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Description: "Fragments of the text with the matches of a text search wrapped in <em> tags.",
+				Resolve:     messageHighlights,
+			},
+			"channel": &graphql.Field{Type: graphql.NewNonNull(channel), Resolve: messageChannel},
+			"user":    &graphql.Field{Type: graphql.NewNonNull(user), Resolve: messageUser},
+		},
+	})
+	event := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Event",
+		Description: "Anything logged that isn't a chat message, e.g. a sub, raid, ban or deleted message.",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID), Resolve: messageID},
+			"timestamp": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime), Resolve: messageTimestamp},
+			"type":      &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: messageType},
+			"text": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The message sent along, e.g. with a resub.",
+				Resolve:     eventText,
+			},
+			"bits":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: messageBits},
+			"channel": &graphql.Field{Type: graphql.NewNonNull(channel), Resolve: messageChannel},
+			"user": &graphql.Field{
+				Type:        user,
+				Description: "The user the event is about, e.g. the banned user or the raiding channel.",
+				Resolve:     eventUser,
+			},
+		},
+	})
+
+	messages := connection("Message", message, pageInfo)
+	events := connection("Event", event, pageInfo)
+
+	channelCount := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ChannelCount",
+		Fields: graphql.Fields{
+			"channel":      &graphql.Field{Type: graphql.NewNonNull(channel)},
+			"messageCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	userCount := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserCount",
+		Fields: graphql.Fields{
+			"user":         &graphql.Field{Type: graphql.NewNonNull(user)},
+			"messageCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	name := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Name",
+		Description: "A login name an account used and when.",
+		Fields: graphql.Fields{
+			"login":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"firstSeen":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"lastSeen":     &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"messageCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	channel.AddFieldConfig("name", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "The channel name without the leading #.",
+		Resolve:     channelName,
+	})
+	channel.AddFieldConfig("messageCount", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "Everything logged in the channel, messages and events.",
+		Resolve:     h.channelMessageCount,
+	})
+	channel.AddFieldConfig("topUsers", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userCount))),
+		Description: "The users who sent the most messages, optionally in a time range.",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+			"from":  &graphql.ArgumentConfig{Type: graphql.DateTime},
+			"to":    &graphql.ArgumentConfig{Type: graphql.DateTime},
+		},
+		Resolve: h.channelTopUsers,
+	})
+	channel.AddFieldConfig("messages", &graphql.Field{
+		Type:    graphql.NewNonNull(messages),
+		Args:    messageArgs(matchMode, "channels"),
+		Resolve: h.channelMessages,
+	})
+	channel.AddFieldConfig("events", &graphql.Field{
+		Type:    graphql.NewNonNull(events),
+		Args:    eventArgs("channels"),
+		Resolve: h.channelEvents,
+	})
+
+	user.AddFieldConfig("login", &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: userLogin})
+	user.AddFieldConfig("id", &graphql.Field{
+		Type:        graphql.String,
+		Description: "The twitch user id, missing for users only logged before user ids were captured.",
+		Resolve:     h.userID,
+	})
+	user.AddFieldConfig("currentName", &graphql.Field{
+		Type:        graphql.String,
+		Description: "The latest login of the account in the user directory.",
+		Resolve:     h.userCurrentName,
+	})
+	user.AddFieldConfig("firstSeen", &graphql.Field{Type: graphql.DateTime, Resolve: h.userFirstSeen})
+	user.AddFieldConfig("lastSeen", &graphql.Field{Type: graphql.DateTime, Resolve: h.userLastSeen})
+	user.AddFieldConfig("messageCount", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "Everything logged of the user, 0 for users that were never seen.",
+		Resolve:     h.userMessageCount,
+	})
+	user.AddFieldConfig("channels", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(channelCount))),
+		Description: "The channels the user was logged in most.",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+		},
+		Resolve: h.userChannels,
+	})
+	user.AddFieldConfig("names", &graphql.Field{
+		Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(name))),
+		Resolve: h.userNames,
+	})
+	user.AddFieldConfig("messages", &graphql.Field{
+		Type:    graphql.NewNonNull(messages),
+		Args:    messageArgs(matchMode, "users"),
+		Resolve: h.userMessages,
+	})
+	user.AddFieldConfig("events", &graphql.Field{
+		Type:    graphql.NewNonNull(events),
+		Args:    eventArgs("users"),
+		Resolve: h.userEvents,
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"channel": &graphql.Field{
+				Type: graphql.NewNonNull(channel),
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: queryChannel,
+			},
+			"channels": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(channel))),
+				Description: "The channels with the most logged messages.",
+				Args: graphql.FieldConfigArgument{
+					"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+				},
+				Resolve: h.queryChannels,
+			},
+			"user": &graphql.Field{
+				Type:        graphql.NewNonNull(user),
+				Description: "The account that used login at the time given as at, now by default.",
+				Args: graphql.FieldConfigArgument{
+					"login": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"at":    &graphql.ArgumentConfig{Type: graphql.DateTime},
+				},
+				Resolve: h.queryUser,
+			},
+			"message": &graphql.Field{
+				Type: message,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.queryMessage,
+			},
+			"messages": &graphql.Field{
+				Type:        graphql.NewNonNull(messages),
+				Description: "Messages matching every given filter, newest first.",
+				Args:        messageArgs(matchMode),
+				Resolve:     h.queryMessages,
+			},
+			"events": &graphql.Field{
+				Type:        graphql.NewNonNull(events),
+				Description: "Events matching every given filter, newest first.",
+				Args:        eventArgs(),
+				Resolve:     h.queryEvents,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// connection creates the connection and edge types paging through node.
+func connection(name string, node, pageInfo *graphql.Object) *graphql.Object {
+	edge := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(node)},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edge))), Resolve: connectionEdges},
+			"nodes":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node))), Resolve: connectionNodes},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfo), Resolve: connectionPageInfo},
+			"totalCount": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "The number of matches over all pages.",
+				Resolve:     connectionTotalCount,
+			},
+		},
+	})
+}
+
+// messageArgs are the filters of message connections, without the ones in omit.
+func messageArgs(matchMode *graphql.Enum, omit ...string) graphql.FieldConfigArgument {
+	args := pageArgs(omit...)
+	args["text"] = &graphql.ArgumentConfig{Type: graphql.String}
+	args["mode"] = &graphql.ArgumentConfig{Type: matchMode, DefaultValue: api.MatchAll}
+	args["hasBits"] = &graphql.ArgumentConfig{Type: graphql.Boolean}
+	return args
+}
+
+// eventArgs are the filters of event connections, without the ones in omit.
+func eventArgs(omit ...string) graphql.FieldConfigArgument {
+	args := pageArgs(omit...)
+	args["types"] = &graphql.ArgumentConfig{
+		Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+		Description: "Event types, e.g. sub, resub, raid, ban, timeout, clearchat or delete.",
+	}
+	return args
+}
+
+func pageArgs(omit ...string) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"channels":    &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"users":       &graphql.ArgumentConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+		"from":        &graphql.ArgumentConfig{Type: graphql.DateTime},
+		"to":          &graphql.ArgumentConfig{Type: graphql.DateTime},
+		"oldestFirst": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+		"first":       &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultFirst},
+		"after":       &graphql.ArgumentConfig{Type: graphql.String, Description: "The endCursor of the previous page."},
+	}
+	for _, key := range omit {
+		delete(args, key)
+	}
+	return args
+}
@@ -0,0 +1,121 @@
+// Package graph writes channel networks for graph tools like Gephi or Cytoscape.
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats graphs can be written in.
+const (
+	FormatGraphML = "graphml"
+	FormatJSON    = "json"
+)
+
+// Node is a vertex with optional attributes.
+type Node struct {
+	ID    string                 `json:"id"`
+	Attrs map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Edge connects two nodes, Attrs hold e.g. its weight.
+type Edge struct {
+	Source string                 `json:"source"`
+	Target string                 `json:"target"`
+	Attrs  map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Graph is a list of nodes and the edges between them. Attribute values are
+// strings, bools, integers or floats.
+type Graph struct {
+	Directed bool    `json:"directed"`
+	Nodes    []*Node `json:"nodes"`
+	Edges    []*Edge `json:"edges"`
+
+	nodes map[string]*Node
+}
+
+// New creates an empty graph.
+func New(directed bool) *Graph {
+	return &Graph{Directed: directed, Nodes: []*Node{}, Edges: []*Edge{}, nodes: map[string]*Node{}}
+}
+
+// Node returns the node with id, adding it when it doesn't exist yet.
+func (g *Graph) Node(id string) *Node {
+	if n, ok := g.nodes[id]; ok {
+		return n
+	}
+	n := &Node{ID: id, Attrs: map[string]interface{}{}}
+	g.nodes[id] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+// Connect adds an edge between source and target, adding missing nodes.
+func (g *Graph) Connect(source, target string, attrs map[string]interface{}) *Edge {
+	g.Node(source)
+	g.Node(target)
+	e := &Edge{Source: source, Target: target, Attrs: attrs}
+	g.Edges = append(g.Edges, e)
+	return e
+}
+
+// CheckFormat returns an error when graphs can't be written in format.
+func CheckFormat(format string) error {
+	switch strings.ToLower(format) {
+	case FormatGraphML, FormatJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown graph format %q, use %s or %s", format, FormatGraphML, FormatJSON)
+	}
+}
+
+// Write writes the graph in format.
+func (g *Graph) Write(w io.Writer, format string) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	if strings.ToLower(format) == FormatJSON {
+		return g.WriteJSON(w)
+	}
+	return g.WriteGraphML(w)
+}
+
+// WriteJSON writes the graph as a JSON object with nodes and edges.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// attrKeys returns the attribute names used by nodes or edges with their GraphML types.
+func attrKeys(attrs []map[string]interface{}) (names []string, types map[string]string) {
+	types = map[string]string{}
+	for _, a := range attrs {
+		for name, v := range a {
+			if _, ok := types[name]; ok {
+				continue
+			}
+			types[name] = graphMLType(v)
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, types
+}
+
+func graphMLType(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case int, int32, int64, uint, uint32, uint64:
+		return "long"
+	case float32, float64:
+		return "double"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteGraphML writes the graph as GraphML, attributes become typed keys.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	nodeAttrs := make([]map[string]interface{}, len(g.Nodes))
+	for i, n := range g.Nodes {
+		nodeAttrs[i] = n.Attrs
+	}
+	edgeAttrs := make([]map[string]interface{}, len(g.Edges))
+	for i, e := range g.Edges {
+		edgeAttrs[i] = e.Attrs
+	}
+	nodeKeys, nodeTypes := attrKeys(nodeAttrs)
+	edgeKeys, edgeTypes := attrKeys(edgeAttrs)
+
+	fmt.Fprint(bw, xml.Header)
+	fmt.Fprintln(bw, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	for _, k := range nodeKeys {
+		fmt.Fprintf(bw, "  <key id=\"n_%s\" for=\"node\" attr.name=\"%s\" attr.type=\"%s\"/>\n", escape(k), escape(k), nodeTypes[k])
+	}
+	for _, k := range edgeKeys {
+		fmt.Fprintf(bw, "  <key id=\"e_%s\" for=\"edge\" attr.name=\"%s\" attr.type=\"%s\"/>\n", escape(k), escape(k), edgeTypes[k])
+	}
+
+	direction := "undirected"
+	if g.Directed {
+		direction = "directed"
+	}
+	fmt.Fprintf(bw, "  <graph edgedefault=\"%s\">\n", direction)
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, "    <node id=\"%s\">\n", escape(n.ID))
+		writeData(bw, "n_", nodeKeys, n.Attrs)
+		fmt.Fprintln(bw, "    </node>")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "    <edge source=\"%s\" target=\"%s\">\n", escape(e.Source), escape(e.Target))
+		writeData(bw, "e_", edgeKeys, e.Attrs)
+		fmt.Fprintln(bw, "    </edge>")
+	}
+	fmt.Fprintln(bw, "  </graph>")
+	fmt.Fprintln(bw, "</graphml>")
+	return bw.Flush()
+}
+
+func writeData(w io.Writer, prefix string, keys []string, attrs map[string]interface{}) {
+	for _, k := range keys {
+		v, ok := attrs[k]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "      <data key=\"%s%s\">%s</data>\n", prefix, escape(k), escape(fmt.Sprint(v)))
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
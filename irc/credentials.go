@@ -0,0 +1,31 @@
+package irc
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// anonymousPassword is ignored by twitch for justinfan logins but some password has to be sent
+const anonymousPassword = "SCHMOOPIIE"
+
+// Credentials are used to log in to twitch IRC.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// AnonymousCredentials returns a read-only justinfanNNNN login. Anonymous
+// connections can read chat in any channel but can't send messages or whispers.
+func AnonymousCredentials() Credentials {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return Credentials{
+		Username: fmt.Sprintf("justinfan%d", 1000+r.Intn(89000)),
+		Password: anonymousPassword,
+	}
+}
+
+// Anonymous reports whether the credentials are a justinfan login.
+func (c Credentials) Anonymous() bool {
+	return c.Password == anonymousPassword
+}
@@ -1,68 +1,215 @@
 package irc
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/djdduty/ttv-log/config"
 	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
 )
 
 //Message ...
 type Message struct {
+	ID        string `json:"-"`
+	UserID    string `json:",omitempty"`
 	User      string
 	Message   string
 	Channel   string
 	Timestamp time.Time
+	Type      string
+	Bits      int      `json:",omitempty"`
+	Emotes    []string `json:",omitempty"`
+	// Viewers is the number of viewers a raid brought along
+	Viewers int `json:",omitempty"`
 }
 
-// CreateElasticFlusher ...
-func CreateElasticFlusher(connector *config.ElasticConnector, flushInterval time.Duration) (chan Message, chan bool, error) {
+// Hook is handed every message on its way to the index, together with its document id.
+// Hooks run on the ingestion goroutine and must not block.
+type Hook func(id string, m Message)
+
+// NewIndexRequest returns the bulk request storing m in the twitch index under id.
+func NewIndexRequest(id string, m Message) *elastic.BulkIndexRequest {
+	return elastic.NewBulkIndexRequest().Index("twitch").Id(id).Doc(m)
+}
+
+// maxBatch is the most messages sent to elasticsearch in one bulk request
+const maxBatch = 5000
+
+// ElasticFlusher indexes messages into the twitch index in batches. Every
+// message is handed to the hooks first, under the document id it's stored
+// with. The bot and the log import share it, so imported messages pass the
+// same hooks as live ones.
+type ElasticFlusher struct {
+	// OnError is called with the errors of batches flushed in the background,
+	// they are only logged when it is nil. Set it before calling Run.
+	OnError func(error)
+
+	client        *elastic.Client
+	ctx           context.Context
+	flushInterval time.Duration
+	dedupWindow   time.Duration
+	hooks         []Hook
+	l             logrus.FieldLogger
+
+	input   chan Message
+	flushes chan chan error
+	quit    chan struct{}
+	done    chan struct{}
+	stop    sync.Once
+
+	indexed int64
+	failed  int64
+}
+
+// NewElasticFlusher creates a flusher committing every flushInterval.
+// Messages are indexed under Message.DocumentID, duplicates without a twitch message id are matched within dedupWindow.
+func NewElasticFlusher(connector *config.ElasticConnector, flushInterval, dedupWindow time.Duration, hooks ...Hook) *ElasticFlusher {
+	return &ElasticFlusher{
+		client:        connector.GetClient(),
+		ctx:           connector.GetContext(),
+		flushInterval: flushInterval,
+		dedupWindow:   dedupWindow,
+		hooks:         hooks,
+		l:             connector.GetLogger(),
+		input:         make(chan Message),
+		flushes:       make(chan chan error),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Input returns the channel messages are indexed from. A send returns once
+// the message was queued, so a later Flush commits it.
+func (f *ElasticFlusher) Input() chan<- Message {
+	return f.input
+}
+
+// Run queues and commits messages until Close is called.
+func (f *ElasticFlusher) Run() {
+	defer close(f.done)
+
+	bulk := f.client.Bulk().Index("twitch")
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case message := <-f.input:
+			id := message.DocumentID(f.dedupWindow)
+			for _, hook := range f.hooks {
+				hook(id, message)
+			}
+			bulk.Add(NewIndexRequest(id, message))
+			if bulk.NumberOfActions() >= maxBatch {
+				f.report(f.commit(bulk))
+			}
+		case <-ticker.C:
+			f.report(f.commit(bulk))
+		case reply := <-f.flushes:
+			reply <- f.commit(bulk)
+		case <-f.quit:
+			// Commit the final batch before exiting
+			f.report(f.commit(bulk))
+			return
+		}
+	}
+}
+
+// Flush commits the queued messages and waits until elasticsearch answered.
+func (f *ElasticFlusher) Flush() error {
+	reply := make(chan error)
+	select {
+	case f.flushes <- reply:
+		return <-reply
+	case <-f.done:
+		return errors.New("flusher is closed")
+	}
+}
+
+// Close commits the queued messages and stops Run.
+func (f *ElasticFlusher) Close() {
+	f.stop.Do(func() {
+		close(f.quit)
+	})
+	<-f.done
+}
+
+// Indexed returns the number of messages elasticsearch accepted so far.
+func (f *ElasticFlusher) Indexed() int64 {
+	return atomic.LoadInt64(&f.indexed)
+}
+
+// Failed returns the number of messages elasticsearch rejected so far.
+func (f *ElasticFlusher) Failed() int64 {
+	return atomic.LoadInt64(&f.failed)
+}
+
+func (f *ElasticFlusher) commit(bulk *elastic.BulkService) error {
+	numActions := bulk.NumberOfActions()
+	if numActions == 0 {
+		return nil
+	}
+
+	res, err := bulk.Do(f.ctx)
+	if err != nil {
+		// A failed request keeps its actions, they are dropped like the ones elasticsearch rejects
+		bulk.Reset()
+		atomic.AddInt64(&f.failed, int64(numActions))
+		return err
+	}
+
+	failed := res.Failed()
+	for _, item := range failed {
+		if item.Error != nil {
+			f.l.Errorf("Could not index message %s: %s", item.Id, item.Error.Reason)
+		}
+	}
+	atomic.AddInt64(&f.failed, int64(len(failed)))
+	atomic.AddInt64(&f.indexed, int64(numActions-len(failed)))
+	f.l.Debugf("Flushed %d messages", numActions)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("elasticsearch rejected %d of %d messages", len(failed), numActions)
+	}
+	return nil
+}
+
+func (f *ElasticFlusher) report(err error) {
+	if err == nil {
+		return
+	}
+	if f.OnError != nil {
+		f.OnError(err)
+		return
+	}
+	f.l.WithError(err).Errorln("Could not flush messages")
+}
+
+// CreateElasticFlusher starts flushing messages from the returned channel to elasticsearch every flushInterval.
+// Messages are indexed under Message.DocumentID, duplicates without a twitch message id are matched within dedupWindow.
+// Failed batches panic, the flusher stops after the final batch once quit receives.
+func CreateElasticFlusher(connector *config.ElasticConnector, flushInterval, dedupWindow time.Duration, hooks ...Hook) (chan Message, chan bool, error) {
 	input := make(chan Message)
 	quit := make(chan bool)
 
-	client := connector.GetClient()
-	ctx := connector.GetContext()
+	f := NewElasticFlusher(connector, flushInterval, dedupWindow, hooks...)
+	f.OnError = func(err error) {
+		panic(err)
+	}
+	go f.Run()
 
 	go func() {
-		bulk := client.Bulk().Index("twitch").Type("_doc")
-
-		go func() {
-			for {
-				numActions := bulk.NumberOfActions()
-				if numActions > 0 {
-					res, err := bulk.Do(ctx)
-					if err != nil {
-						panic(err)
-					}
-					fmt.Printf("Flushed %d messages\n", numActions)
-					if res.Errors {
-						// Look up the failed documents with res.Failed(), and e.g. recommit
-						panic(errors.New("bulk commit failed"))
-					}
-				}
-				select {
-				case <-time.After(flushInterval):
-				case <-quit:
-					return
-				}
-			}
-		}()
-
 		for {
 			select {
 			case message := <-input:
-				bulk.Add(elastic.NewBulkIndexRequest().Doc(message))
+				f.Input() <- message
 			case <-quit:
-				// Commit the final batch before exiting
-				if bulk.NumberOfActions() > 0 {
-					fmt.Printf("Attempting to flush %d messages\n", bulk.NumberOfActions())
-					_, err := bulk.Do(ctx)
-					if err != nil {
-						panic(err)
-					}
-				}
+				f.Close()
 				return
 			}
 		}
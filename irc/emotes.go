@@ -0,0 +1,95 @@
+package irc
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseEmotes returns the names of the emotes in text, in order of their first
+// occurrence. tag is the twitch emotes tag, "25:0-4,12-16/1902:6-10", which
+// holds the rune positions of every emote id in the text.
+func ParseEmotes(tag, text string) []string {
+	runes := []rune(text)
+	first := map[string]int{}
+	for _, emote := range strings.Split(tag, "/") {
+		parts := strings.SplitN(emote, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, pos := range strings.Split(parts[1], ",") {
+			bounds := strings.SplitN(pos, "-", 2)
+			if len(bounds) != 2 {
+				continue
+			}
+			start, err1 := strconv.Atoi(bounds[0])
+			end, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil || start < 0 || end < start || end >= len(runes) {
+				continue
+			}
+			name := string(runes[start : end+1])
+			if at, ok := first[name]; !ok || start < at {
+				first[name] = start
+			}
+		}
+	}
+
+	emotes := make([]string, 0, len(first))
+	for name := range first {
+		emotes = append(emotes, name)
+	}
+	sort.Slice(emotes, func(i, j int) bool { return first[emotes[i]] < first[emotes[j]] })
+	return emotes
+}
+
+// EmoteSet holds the names of third-party emotes, e.g. from BetterTTV or
+// FrankerFaceZ, which twitch doesn't tag.
+type EmoteSet map[string]bool
+
+// LoadEmoteSet reads a file with one emote name per line. Empty lines and
+// lines starting with # are ignored. An empty path gives an empty set.
+func LoadEmoteSet(path string) (EmoteSet, error) {
+	if path == "" {
+		return EmoteSet{}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	set := EmoteSet{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" && !strings.HasPrefix(name, "#") {
+			set[name] = true
+		}
+	}
+	return set, scanner.Err()
+}
+
+// Tag adds the third-party emotes used as words of the message text to m.Emotes.
+func (s EmoteSet) Tag(m *Message) {
+	if len(s) == 0 {
+		return
+	}
+
+	for _, word := range strings.Fields(m.Message) {
+		if s[word] && !containsString(m.Emotes, word) {
+			m.Emotes = append(m.Emotes, word)
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
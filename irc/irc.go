@@ -3,46 +3,119 @@ package irc
 import (
 	"crypto/tls"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	irc "github.com/fluffle/goirc/client"
+	"github.com/sirupsen/logrus"
 )
 
-// StartGoIRC ...
-func StartGoIRC(messageChan chan Message, quitChan chan bool, username string, password string, streams []string) {
-	cfg := irc.NewConfig(username)
-	cfg.Pass = password
+// CoverageObserver is told when the bot starts and stops receiving a channel's chat.
+type CoverageObserver interface {
+	Joined(channel string, at time.Time)
+	Parted(channel string, at time.Time)
+	Disconnected(at time.Time)
+}
+
+// RawRecorder is handed every archived line exactly as it was received, before it is parsed.
+type RawRecorder interface {
+	Write(at time.Time, raw string) error
+}
+
+// ArchivedCommands lists the IRC commands passed to the RawRecorder. goirc has
+// no catch-all handler, so this covers everything twitch sends to a joined channel.
+var ArchivedCommands = append([]string{
+	irc.JOIN, irc.PART, irc.NOTICE, irc.CTCP,
+	"ROOMSTATE", "USERSTATE", "GLOBALUSERSTATE", "HOSTTARGET", "RECONNECT", "WHISPER",
+}, Commands...)
+
+// StartGoIRC connects to twitch chat and joins streams. When updates is not
+// nil, channels are joined and parted as the lists received on it add or drop them.
+// Lines the recorder can't archive are logged to l.
+func StartGoIRC(messageChan chan Message, quitChan chan bool, credentials Credentials, streams []string, updates <-chan []string, observer CoverageObserver, recorder RawRecorder, l logrus.FieldLogger) {
+	cfg := irc.NewConfig(credentials.Username)
+	cfg.Pass = credentials.Password
 	cfg.SSL = true
 	cfg.SSLConfig = &tls.Config{ServerName: "irc.chat.twitch.tv"}
 	cfg.Server = "irc.chat.twitch.tv:6697"
 	cfg.Flood = true
 	c := irc.Client(cfg)
 
+	// wanted is the list of channels to be in, guarded by mu as updates change it
+	var mu sync.Mutex
+	wanted := append([]string{}, streams...)
+
 	c.HandleFunc(irc.CONNECTED, func(conn *irc.Conn, line *irc.Line) {
+		// Tags carry the message id used to collapse messages logged by several workers,
+		// commands enables USERNOTICE, CLEARCHAT and CLEARMSG events
+		conn.Cap("REQ", "twitch.tv/tags", "twitch.tv/commands")
+
+		mu.Lock()
+		channels := append([]string{}, wanted...)
+		mu.Unlock()
+		go join(conn, channels)
+	})
+
+	if updates != nil {
 		go func() {
-			numJoined := 0
-			for _, streamName := range streams {
-				conn.Join(fmt.Sprintf("#%s", streamName))
-				fmt.Printf("Sent JOIN for %s\n", streamName)
-				numJoined = numJoined + 1
-				if numJoined%50 == 0 {
-					fmt.Printf("Sleeping for 15s to avoid JOIN rate limit Joined %d / %d\n", numJoined, len(streams))
-					time.Sleep(15 * time.Second)
+			for next := range updates {
+				mu.Lock()
+				added, removed := diff(wanted, next)
+				wanted = append([]string{}, next...)
+				mu.Unlock()
+
+				// Channels changed while disconnected are joined on connect
+				if !c.Connected() {
+					continue
 				}
+				for _, streamName := range removed {
+					c.Part(fmt.Sprintf("#%s", streamName))
+					fmt.Printf("Sent PART for %s\n", streamName)
+				}
+				join(c, added)
 			}
-			fmt.Printf("Joined all %d stream channels (input: %d)\n", numJoined, len(streams))
 		}()
+	}
+
+	c.HandleFunc(irc.JOIN, func(conn *irc.Conn, line *irc.Line) {
+		if observer != nil && strings.EqualFold(line.Nick, conn.Me().Nick) {
+			observer.Joined(line.Target(), line.Time)
+		}
+	})
+
+	c.HandleFunc(irc.PART, func(conn *irc.Conn, line *irc.Line) {
+		if observer != nil && strings.EqualFold(line.Nick, conn.Me().Nick) {
+			observer.Parted(line.Target(), line.Time)
+		}
 	})
 
 	c.HandleFunc(irc.DISCONNECTED, func(conn *irc.Conn, line *irc.Line) {
 		fmt.Println("Disconnected from IRC")
+		if observer != nil {
+			observer.Disconnected(line.Time)
+		}
 		quitChan <- true
 	})
 
-	c.HandleFunc(irc.PRIVMSG, func(conn *irc.Conn, line *irc.Line) {
-		//log.Println("Received: ", line.Target(), line.Nick, line.Text())
-		messageChan <- Message{User: line.Nick, Message: line.Text(), Timestamp: time.Now().UTC(), Channel: line.Target()}
-	})
+	for _, cmd := range Commands {
+		c.HandleFunc(cmd, func(conn *irc.Conn, line *irc.Line) {
+			//log.Println("Received: ", line.Target(), line.Nick, line.Text())
+			if message, ok := ParseMessage(line); ok {
+				messageChan <- message
+			}
+		})
+	}
+
+	if recorder != nil {
+		for _, cmd := range ArchivedCommands {
+			c.HandleFunc(cmd, func(conn *irc.Conn, line *irc.Line) {
+				if err := recorder.Write(line.Time, line.Raw); err != nil {
+					l.WithError(err).Errorln("Could not archive raw line")
+				}
+			})
+		}
+	}
 
 	// Tell client to connect.
 	if err := c.Connect(); err != nil {
@@ -52,3 +125,41 @@ func StartGoIRC(messageChan chan Message, quitChan chan bool, username string, p
 	<-quitChan
 	c.Close()
 }
+
+// join joins the channels, pausing every 50 JOINs to stay below twitch's rate limit.
+func join(conn *irc.Conn, streams []string) {
+	numJoined := 0
+	for _, streamName := range streams {
+		conn.Join(fmt.Sprintf("#%s", streamName))
+		fmt.Printf("Sent JOIN for %s\n", streamName)
+		numJoined = numJoined + 1
+		if numJoined%50 == 0 {
+			fmt.Printf("Sleeping for 15s to avoid JOIN rate limit Joined %d / %d\n", numJoined, len(streams))
+			time.Sleep(15 * time.Second)
+		}
+	}
+	fmt.Printf("Joined all %d stream channels (input: %d)\n", numJoined, len(streams))
+}
+
+// diff returns the channels of next missing from current, and those of current missing from next.
+func diff(current, next []string) (added, removed []string) {
+	in := func(list []string, ch string) bool {
+		for _, c := range list {
+			if c == ch {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ch := range next {
+		if !in(current, ch) {
+			added = append(added, ch)
+		}
+	}
+	for _, ch := range current {
+		if !in(next, ch) {
+			removed = append(removed, ch)
+		}
+	}
+	return added, removed
+}
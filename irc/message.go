@@ -0,0 +1,166 @@
+package irc
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	irc "github.com/fluffle/goirc/client"
+)
+
+// Message types stored in Message.Type. USERNOTICE events use twitch's msg-id,
+// e.g. "sub", "resub", "subgift" or "raid".
+const (
+	TypeMessage   = "message"
+	TypeAction    = "action"
+	TypeBan       = "ban"
+	TypeTimeout   = "timeout"
+	TypeClearChat = "clearchat"
+	TypeDelete    = "delete"
+	// TypeRaid is the USERNOTICE of a channel raiding another, User is the raiding channel
+	TypeRaid = "raid"
+)
+
+// SubTypes lists the USERNOTICE types of subscriptions and gifted subscriptions.
+var SubTypes = []string{
+	"sub", "resub", "subgift", "anonsubgift", "submysterygift", "anonsubmysterygift",
+	"giftpaidupgrade", "anongiftpaidupgrade", "primepaidupgrade",
+}
+
+// Commands lists the IRC commands ParseMessage turns into messages.
+var Commands = []string{irc.PRIVMSG, irc.ACTION, "USERNOTICE", "CLEARCHAT", "CLEARMSG"}
+
+// ParseMessage builds a Message from a chat line or a twitch event. It returns
+// false for lines that aren't logged. When the twitch.tv/tags capability is
+// enabled the message id and the server timestamp are taken from the tags, so
+// every worker joined to the same channel produces the same Message.
+func ParseMessage(line *irc.Line) (Message, bool) {
+	m := Message{
+		User:      line.Nick,
+		Message:   line.Text(),
+		Channel:   line.Target(),
+		Timestamp: line.Time.UTC(),
+	}
+
+	switch line.Cmd {
+	case irc.PRIVMSG:
+		m.Type = TypeMessage
+	case irc.ACTION:
+		m.Type = TypeAction
+	case "USERNOTICE":
+		m.Type = line.Tags["msg-id"]
+		m.User = line.Tags["login"]
+		if len(line.Args) < 2 {
+			// Notices without a user message only have the channel, which Text returns as well
+			m.Message = ""
+		}
+		if m.Message == "" {
+			m.Message = line.Tags["system-msg"]
+		}
+	case "CLEARCHAT":
+		// CLEARCHAT #channel :user is a timeout or ban of that user, without a user the whole chat was cleared
+		m.User = m.Message
+		m.Message = ""
+		switch {
+		case m.User == "":
+			m.Type = TypeClearChat
+		case line.Tags["ban-duration"] != "":
+			m.Type = TypeTimeout
+			m.Message = line.Tags["ban-duration"]
+		default:
+			m.Type = TypeBan
+		}
+	case "CLEARMSG":
+		m.Type = TypeDelete
+		m.User = line.Tags["login"]
+	default:
+		return m, false
+	}
+
+	if m.Type == "" || m.Channel == "" {
+		return m, false
+	}
+
+	if line.Time.IsZero() {
+		m.Timestamp = time.Now().UTC()
+	}
+
+	if id, ok := line.Tags["id"]; ok {
+		m.ID = id
+	}
+
+	if sent, ok := line.Tags["tmi-sent-ts"]; ok {
+		if ms, err := strconv.ParseInt(sent, 10, 64); err == nil {
+			m.Timestamp = time.Unix(0, ms*int64(time.Millisecond)).UTC()
+		}
+	}
+
+	if m.Type == TypeBan || m.Type == TypeTimeout {
+		m.UserID = line.Tags["target-user-id"]
+	} else {
+		m.UserID = line.Tags["user-id"]
+	}
+
+	if bits, ok := line.Tags["bits"]; ok {
+		m.Bits, _ = strconv.Atoi(bits)
+	}
+
+	if m.Type == TypeRaid {
+		m.Viewers, _ = strconv.Atoi(line.Tags["msg-param-viewerCount"])
+		if login := line.Tags["msg-param-login"]; login != "" {
+			m.User = login
+		}
+	}
+
+	if emotes := line.Tags["emotes"]; emotes != "" {
+		m.Emotes = ParseEmotes(emotes, m.Message)
+	}
+
+	return m, true
+}
+
+// DocumentID returns the elasticsearch document id for the message. Messages
+// with a twitch message id use it directly, others are keyed on their content
+// within a time window, so the same message logged by several workers is only
+// stored once.
+func (m Message) DocumentID(window time.Duration) string {
+	if m.ID != "" {
+		return m.ID
+	}
+
+	bucket := m.Timestamp.UnixNano()
+	if window > 0 {
+		bucket = m.Timestamp.Truncate(window).UnixNano()
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d", m.Type, m.Channel, m.User, m.Message, bucket)))
+	return hex.EncodeToString(sum[:])
+}
+
+// TwitchID returns the twitch message id of the message stored under the
+// document id docID, or "" when the document is keyed on its content.
+func TwitchID(docID string) string {
+	if len(docID) == sha1.Size*2 {
+		if _, err := hex.DecodeString(docID); err == nil {
+			return ""
+		}
+	}
+	return docID
+}
+
+// Duplicates reports whether m and other are copies of the same message, the
+// way DocumentID keys them: messages with a twitch message id match on the id,
+// others on their content when they were sent within window of each other.
+func (m Message) Duplicates(other Message, window time.Duration) bool {
+	if m.ID != "" || other.ID != "" {
+		return m.ID == other.ID
+	}
+	d := m.Timestamp.Sub(other.Timestamp)
+	if d < 0 {
+		d = -d
+	}
+	return d <= window && m.Type == other.Type && m.Channel == other.Channel &&
+		m.User == other.User && m.Message == other.Message
+}
@@ -0,0 +1,101 @@
+package live
+
+import (
+	"sync"
+
+	"github.com/djdduty/ttv-log/irc"
+)
+
+// Event is a message as it was indexed, with its elasticsearch document id.
+type Event struct {
+	ID      string
+	Message irc.Message
+}
+
+// AllChannels subscribes to the events of every channel.
+const AllChannels = "*"
+
+// Subscription receives the events of one channel.
+type Subscription struct {
+	C       chan Event
+	channel string
+	broker  *Broker
+}
+
+// Close unsubscribes. C is closed once the broker let go of the subscription.
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// Broker fans events out to the subscribers of their channel. Slow subscribers
+// miss events instead of holding up the ingestion pipeline.
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]bool
+}
+
+// NewBroker creates a broker without subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: map[string]map[*Subscription]bool{}}
+}
+
+// Subscribe returns a subscription to channel ("#name"), or to AllChannels, buffering up to buffer events.
+func (b *Broker) Subscribe(channel string, buffer int) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &Subscription{C: make(chan Event, buffer), channel: channel, broker: b}
+	if b.subs[channel] == nil {
+		b.subs[channel] = map[*Subscription]bool{}
+	}
+	b.subs[channel][s] = true
+	return s
+}
+
+// Publish hands an event to every subscriber of its channel.
+func (b *Broker) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, channel := range []string{e.Message.Channel, AllChannels} {
+		for s := range b.subs[channel] {
+			select {
+			case s.C <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Hook returns an irc.Hook publishing every flushed message.
+func (b *Broker) Hook() irc.Hook {
+	return func(id string, m irc.Message) {
+		b.Publish(Event{ID: id, Message: m})
+	}
+}
+
+// Channels returns the channels that have subscribers.
+func (b *Broker) Channels() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	channels := make([]string, 0, len(b.subs))
+	for ch := range b.subs {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.subs[s.channel][s] {
+		return
+	}
+	delete(b.subs[s.channel], s)
+	if len(b.subs[s.channel]) == 0 {
+		delete(b.subs, s.channel)
+	}
+	close(s.C)
+}
@@ -0,0 +1,125 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// Tailer feeds a broker by polling the index, for servers running separately
+// from the bots. Bots flush in batches, so every poll looks back overlap to
+// pick up messages that were indexed late, and skips the ones already published.
+type Tailer struct {
+	connector *config.ElasticConnector
+	broker    *Broker
+	interval  time.Duration
+	overlap   time.Duration
+	l         logrus.FieldLogger
+
+	since time.Time
+	seen  map[string]time.Time
+}
+
+// NewTailer creates a tailer polling every interval.
+func NewTailer(connector *config.ElasticConnector, broker *Broker, interval, overlap time.Duration, l logrus.FieldLogger) *Tailer {
+	return &Tailer{
+		connector: connector,
+		broker:    broker,
+		interval:  interval,
+		overlap:   overlap,
+		l:         l,
+		seen:      map[string]time.Time{},
+	}
+}
+
+// Run polls until ctx is done. Nothing is queried while nobody is subscribed.
+func (t *Tailer) Run(ctx context.Context) {
+	t.since = time.Now().UTC()
+	for {
+		select {
+		case <-time.After(t.interval):
+		case <-ctx.Done():
+			return
+		}
+
+		channels := t.broker.Channels()
+		if len(channels) == 0 {
+			t.since = time.Now().UTC()
+			t.seen = map[string]time.Time{}
+			continue
+		}
+
+		if err := t.poll(ctx, channels); err != nil {
+			t.l.WithError(err).Warnln("Could not tail messages")
+		}
+	}
+}
+
+func (t *Tailer) poll(ctx context.Context, channels []string) error {
+	values := make([]interface{}, len(channels))
+	for i, ch := range channels {
+		values[i] = ch
+	}
+
+	q := elastic.NewBoolQuery().Filter(elastic.NewRangeQuery("Timestamp").Gte(t.since.Add(-t.overlap)))
+	if !contains(channels, AllChannels) {
+		q = q.Filter(elastic.NewTermsQuery("Channel.keyword", values...))
+	}
+
+	var after []interface{}
+	for {
+		search := t.connector.GetClient().Search().Index("twitch").Query(q).
+			Sort("Timestamp", true).Sort("_id", true).Size(1000)
+		if after != nil {
+			search = search.SearchAfter(after...)
+		}
+
+		sr, err := search.Do(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range sr.Hits.Hits {
+			after = hit.Sort
+			if _, ok := t.seen[hit.Id]; ok {
+				continue
+			}
+
+			var m irc.Message
+			if err := json.Unmarshal(hit.Source, &m); err != nil {
+				return err
+			}
+
+			t.seen[hit.Id] = m.Timestamp
+			if m.Timestamp.After(t.since) {
+				t.since = m.Timestamp
+			}
+			t.broker.Publish(Event{ID: hit.Id, Message: m})
+		}
+
+		if len(sr.Hits.Hits) < 1000 {
+			break
+		}
+	}
+
+	for id, ts := range t.seen {
+		if ts.Before(t.since.Add(-t.overlap)) {
+			delete(t.seen, id)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
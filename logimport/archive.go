@@ -0,0 +1,27 @@
+package logimport
+
+import (
+	"github.com/djdduty/ttv-log/archive"
+	"github.com/djdduty/ttv-log/irc"
+)
+
+// archiveParser reads the bot's raw line archive.
+type archiveParser struct{}
+
+// NewArchiveParser creates a parser for files written by archive.Writer. Lines
+// without a tmi-sent-ts tag are timed by when the bot received them.
+func NewArchiveParser(path string, o Options) (Parser, error) {
+	return archiveParser{}, nil
+}
+
+func (archiveParser) Parse(line string) (irc.Message, bool, error) {
+	if line == "" {
+		return irc.Message{}, false, nil
+	}
+
+	received, raw, err := archive.ParseLine(line)
+	if err != nil {
+		return irc.Message{}, false, err
+	}
+	return parseRaw(raw, received)
+}
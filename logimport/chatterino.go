@@ -0,0 +1,104 @@
+package logimport
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/pkg/errors"
+)
+
+var (
+	chatterinoFile    = regexp.MustCompile(`^(\w+)-(\d{4}-\d\d-\d\d)\.log$`)
+	chatterinoLine    = regexp.MustCompile(`^\[(\d\d:\d\d:\d\d)\] +(.*)$`)
+	chatterinoMessage = regexp.MustCompile(`^(?:[^\s:]+ )?(\w+): (.*)$`)
+	chatterinoTimeout = regexp.MustCompile(`^(\w+) has been timed out for ((?:\d+[dhms] ?)+)\.?$`)
+	chatterinoBan     = regexp.MustCompile(`^(\w+) has been permanently banned\.?$`)
+	durationPart      = regexp.MustCompile(`(\d+)([dhms])`)
+)
+
+// chatterinoParser reads Chatterino's "channel-2006-01-02.log" files. Lines only
+// carry the time of day in the local time of the machine that wrote them.
+type chatterinoParser struct {
+	channel string
+	day     time.Time
+}
+
+// NewChatterinoParser creates a parser for a Chatterino log file, taking the
+// channel and date from its name.
+func NewChatterinoParser(path string, o Options) (Parser, error) {
+	match := chatterinoFile.FindStringSubmatch(filepath.Base(path))
+	if match == nil {
+		return nil, errors.Errorf("%s is not named like a chatterino log, channel-2006-01-02.log", filepath.Base(path))
+	}
+
+	loc := o.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	day, err := time.ParseInLocation("2006-01-02", match[2], loc)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &chatterinoParser{channel: channelName(match[1]), day: day}
+	if o.Channel != "" {
+		p.channel = channelName(o.Channel)
+	}
+	return p, nil
+}
+
+func (p *chatterinoParser) Parse(line string) (irc.Message, bool, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" || strings.HasPrefix(line, "# ") {
+		// "# Start logging at ..." and "# Stop logging at ..." headers
+		return irc.Message{}, false, nil
+	}
+
+	match := chatterinoLine.FindStringSubmatch(line)
+	if match == nil {
+		return irc.Message{}, false, errors.New("line has no [15:04:05] time")
+	}
+
+	clock, err := time.Parse("15:04:05", match[1])
+	if err != nil {
+		return irc.Message{}, false, err
+	}
+	ts := time.Date(p.day.Year(), p.day.Month(), p.day.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, p.day.Location())
+
+	m := irc.Message{
+		Channel:   p.channel,
+		Timestamp: ts.UTC(),
+	}
+
+	text := match[2]
+	switch {
+	case chatterinoTimeout.MatchString(text):
+		parts := chatterinoTimeout.FindStringSubmatch(text)
+		m.Type, m.User, m.Message = irc.TypeTimeout, strings.ToLower(parts[1]), strconv.Itoa(durationSeconds(parts[2]))
+	case chatterinoBan.MatchString(text):
+		m.Type, m.User = irc.TypeBan, strings.ToLower(chatterinoBan.FindStringSubmatch(text)[1])
+	case chatterinoMessage.MatchString(text):
+		parts := chatterinoMessage.FindStringSubmatch(text)
+		m.Type, m.User, m.Message = irc.TypeMessage, strings.ToLower(parts[1]), parts[2]
+	default:
+		// Other system messages, e.g. subs or mode changes
+		return irc.Message{}, false, nil
+	}
+
+	return m, true, nil
+}
+
+// durationSeconds converts chatterino's "1d 2h 3m 4s" durations to seconds.
+func durationSeconds(s string) int {
+	units := map[string]int{"d": 86400, "h": 3600, "m": 60, "s": 1}
+	total := 0
+	for _, part := range durationPart.FindAllStringSubmatch(s, -1) {
+		n, _ := strconv.Atoi(part[1])
+		total += n * units[part[2]]
+	}
+	return total
+}
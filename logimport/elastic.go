@@ -0,0 +1,44 @@
+package logimport
+
+import (
+	"github.com/djdduty/ttv-log/irc"
+)
+
+// ElasticSink indexes messages through the bot's ingestion pipeline, so
+// imported messages pass the same hooks as the ones logged live.
+type ElasticSink struct {
+	flusher *irc.ElasticFlusher
+}
+
+// NewElasticSink starts indexing through flusher.
+func NewElasticSink(flusher *irc.ElasticFlusher) *ElasticSink {
+	go flusher.Run()
+	return &ElasticSink{flusher: flusher}
+}
+
+// Write queues m for indexing. The flusher derives the same id from m.
+func (s *ElasticSink) Write(id string, m irc.Message) error {
+	s.flusher.Input() <- m
+	return nil
+}
+
+// Flush commits the queued messages and waits for them to be indexed.
+func (s *ElasticSink) Flush() error {
+	return s.flusher.Flush()
+}
+
+// Close flushes and stops the flusher.
+func (s *ElasticSink) Close() error {
+	s.flusher.Close()
+	return nil
+}
+
+// Indexed returns the number of messages elasticsearch accepted so far.
+func (s *ElasticSink) Indexed() int64 {
+	return s.flusher.Indexed()
+}
+
+// Failed returns the number of messages elasticsearch rejected so far.
+func (s *ElasticSink) Failed() int64 {
+	return s.flusher.Failed()
+}
@@ -0,0 +1,60 @@
+package logimport
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/pkg/errors"
+)
+
+// Parser turns the lines of one log file into messages. ok is false for lines
+// that hold nothing to import, like headers or joins.
+type Parser interface {
+	Parse(line string) (m irc.Message, ok bool, err error)
+}
+
+// Options are passed to every format when a file is opened.
+type Options struct {
+	// Channel overrides the channel formats take from the file name
+	Channel string
+	// Location is the time zone of logs written in local time
+	Location *time.Location
+	// Emotes are the third-party emotes tagged in every message
+	Emotes irc.EmoteSet
+}
+
+// Format creates the parser for the file at path.
+type Format func(path string, o Options) (Parser, error)
+
+// Formats maps the supported format names to their parsers.
+var Formats = map[string]Format{
+	"justlog":    NewJustlogParser,
+	"chatterino": NewChatterinoParser,
+	"raw":        NewRawParser,
+	"archive":    NewArchiveParser,
+}
+
+// FormatNames returns the names of the supported formats, sorted.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupFormat returns the format called name.
+func LookupFormat(name string) (Format, error) {
+	if f, ok := Formats[name]; ok {
+		return f, nil
+	}
+	return nil, errors.Errorf("unknown import format %q, use one of %s", name, strings.Join(FormatNames(), ", "))
+}
+
+// channelName normalizes a channel to the stored form, lower case with a leading #.
+func channelName(name string) string {
+	return "#" + strings.ToLower(strings.TrimPrefix(name, "#"))
+}
@@ -0,0 +1,166 @@
+package logimport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLineSize is the longest line read from a log file, raw twitch lines with all their tags fit easily
+const maxLineSize = 1024 * 1024
+
+// Stats counts the progress of an import.
+type Stats struct {
+	Files   int64
+	Lines   int64
+	Parsed  int64
+	Skipped int64
+	Errors  int64
+}
+
+// Sink receives the parsed messages together with their document ids.
+// The export.Writer formats can be used as sinks.
+type Sink interface {
+	Write(id string, m irc.Message) error
+	Flush() error
+}
+
+// Importer parses log files and hands the messages to a sink under the same
+// document ids the bot uses. Lines with a twitch message id are never stored
+// twice. The others get an id from their content, so importing a file twice
+// doesn't create duplicates, but messages already logged live are stored again.
+type Importer struct {
+	Format      Format
+	Options     Options
+	DedupWindow time.Duration
+	// Sink receives the messages, files are only parsed when it is nil
+	Sink Sink
+
+	stats Stats
+	l     logrus.FieldLogger
+}
+
+// NewImporter creates an importer parsing files in format.
+func NewImporter(format Format, o Options, sink Sink, dedupWindow time.Duration, l logrus.FieldLogger) *Importer {
+	return &Importer{
+		Format:      format,
+		Options:     o,
+		DedupWindow: dedupWindow,
+		Sink:        sink,
+		l:           l,
+	}
+}
+
+// Stats returns a snapshot of the import progress.
+func (i *Importer) Stats() Stats {
+	return Stats{
+		Files:   atomic.LoadInt64(&i.stats.Files),
+		Lines:   atomic.LoadInt64(&i.stats.Lines),
+		Parsed:  atomic.LoadInt64(&i.stats.Parsed),
+		Skipped: atomic.LoadInt64(&i.stats.Skipped),
+		Errors:  atomic.LoadInt64(&i.stats.Errors),
+	}
+}
+
+// ImportPath imports a file, or every .log, .txt and .gz file below a directory.
+func (i *Importer) ImportPath(ctx context.Context, path string) error {
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if info.IsDir() || (p != path && !isLogFile(p)) {
+			return nil
+		}
+		return i.ImportFile(ctx, p)
+	})
+}
+
+func isLogFile(path string) bool {
+	ext := filepath.Ext(strings.TrimSuffix(path, ".gz"))
+	return ext == ".log" || ext == ".txt" || strings.HasSuffix(path, ".gz")
+}
+
+// ImportFile imports a single log file, gzip compressed when its name ends in .gz.
+// Lines that can't be parsed are logged with their position and counted, they don't stop the import.
+func (i *Importer) ImportFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	parser, err := i.Format(path, i.Options)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	n := 0
+	for scanner.Scan() {
+		n++
+		atomic.AddInt64(&i.stats.Lines, 1)
+		if n%1000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		m, ok, err := parser.Parse(scanner.Text())
+		if err != nil {
+			atomic.AddInt64(&i.stats.Errors, 1)
+			i.l.Warnf("%s:%d: %s", path, n, err)
+			continue
+		}
+		if !ok {
+			atomic.AddInt64(&i.stats.Skipped, 1)
+			continue
+		}
+
+		i.Options.Emotes.Tag(&m)
+		atomic.AddInt64(&i.stats.Parsed, 1)
+		if i.Sink != nil {
+			if err := i.Sink.Write(m.DocumentID(i.DedupWindow), m); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err == io.ErrUnexpectedEOF {
+		// Archives of a worker that crashed end without the gzip trailer, everything before it is still usable
+		atomic.AddInt64(&i.stats.Errors, 1)
+		i.l.Warnf("%s:%d: file is truncated", path, n)
+	} else if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&i.stats.Files, 1)
+	return nil
+}
+
+// Flush flushes the sink.
+func (i *Importer) Flush() error {
+	if i.Sink == nil {
+		return nil
+	}
+	return i.Sink.Flush()
+}
@@ -0,0 +1,80 @@
+package logimport
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/pkg/errors"
+)
+
+var (
+	justlogLine    = regexp.MustCompile(`^\[(\d{4}-\d\d-\d\d \d\d:\d\d:\d\d)\] (#\w+) (.*)$`)
+	justlogMessage = regexp.MustCompile(`^(\w+): (.*)$`)
+	justlogTimeout = regexp.MustCompile(`^(\w+) has been timed out for (\d+) seconds?$`)
+	justlogBan     = regexp.MustCompile(`^(\w+) has been banned$`)
+)
+
+// justlogParser reads justlog's daily files. They hold raw IRC lines, the
+// plain text downloads "[2006-01-02 15:04:05] #channel user: message" are
+// accepted as well.
+type justlogParser struct {
+	channel string
+}
+
+// NewJustlogParser creates a parser for justlog channel or user logs.
+func NewJustlogParser(path string, o Options) (Parser, error) {
+	p := &justlogParser{}
+	if o.Channel != "" {
+		p.channel = channelName(o.Channel)
+	}
+	return p, nil
+}
+
+func (p *justlogParser) Parse(line string) (irc.Message, bool, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") || strings.HasPrefix(line, ":") {
+		return parseRaw(line, time.Time{})
+	}
+	if line == "" {
+		return irc.Message{}, false, nil
+	}
+
+	match := justlogLine.FindStringSubmatch(line)
+	if match == nil {
+		return irc.Message{}, false, errors.New("line is neither raw IRC nor justlog text")
+	}
+
+	ts, err := time.Parse("2006-01-02 15:04:05", match[1])
+	if err != nil {
+		return irc.Message{}, false, err
+	}
+
+	m := irc.Message{
+		Channel:   channelName(match[2]),
+		Timestamp: ts.UTC(),
+	}
+	if p.channel != "" {
+		m.Channel = p.channel
+	}
+
+	text := match[3]
+	switch {
+	case justlogMessage.MatchString(text):
+		parts := justlogMessage.FindStringSubmatch(text)
+		m.Type, m.User, m.Message = irc.TypeMessage, strings.ToLower(parts[1]), parts[2]
+	case justlogTimeout.MatchString(text):
+		parts := justlogTimeout.FindStringSubmatch(text)
+		m.Type, m.User, m.Message = irc.TypeTimeout, strings.ToLower(parts[1]), parts[2]
+	case justlogBan.MatchString(text):
+		m.Type, m.User = irc.TypeBan, strings.ToLower(justlogBan.FindStringSubmatch(text)[1])
+	case text == "chat has been cleared":
+		m.Type = irc.TypeClearChat
+	default:
+		// Sub and raid notices only keep their system message, there is no type to store them under
+		return irc.Message{}, false, nil
+	}
+
+	return m, true, nil
+}
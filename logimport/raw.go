@@ -0,0 +1,67 @@
+package logimport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/irc"
+	goirc "github.com/fluffle/goirc/client"
+	"github.com/pkg/errors"
+)
+
+// rawParser reads raw IRC protocol lines as received from twitch with the tags capability.
+type rawParser struct{}
+
+// NewRawParser creates a parser for raw IRC dumps. Lines must carry the
+// tmi-sent-ts tag, without it the time of a message is unknown.
+func NewRawParser(path string, o Options) (Parser, error) {
+	return rawParser{}, nil
+}
+
+func (rawParser) Parse(line string) (irc.Message, bool, error) {
+	return parseRaw(line, time.Time{})
+}
+
+// parseRaw parses a raw IRC line received at the given time. Without a receive
+// time the line must carry the tmi-sent-ts tag.
+func parseRaw(raw string, received time.Time) (m irc.Message, ok bool, err error) {
+	raw = strings.TrimRight(raw, "\r\n")
+	if raw == "" {
+		return m, false, nil
+	}
+
+	// goirc assumes well formed lines and panics on some truncated ones
+	defer func() {
+		if r := recover(); r != nil {
+			ok, err = false, errors.Errorf("malformed IRC line: %v", r)
+		}
+	}()
+
+	line := goirc.ParseLine(raw)
+	if line == nil {
+		return m, false, errors.New("malformed IRC line")
+	}
+	if !isCommand(line.Cmd) {
+		return m, false, nil
+	}
+	line.Time = received
+	if _, found := line.Tags["tmi-sent-ts"]; !found && received.IsZero() {
+		return m, false, errors.New("line has no tmi-sent-ts tag")
+	}
+
+	m, ok = irc.ParseMessage(line)
+	if !ok {
+		return m, false, fmt.Errorf("could not parse %s line", line.Cmd)
+	}
+	return m, true, nil
+}
+
+func isCommand(cmd string) bool {
+	for _, c := range irc.Commands {
+		if c == cmd {
+			return true
+		}
+	}
+	return false
+}
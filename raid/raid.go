@@ -0,0 +1,335 @@
+// Package raid keeps the network of channels raiding each other.
+package raid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/graph"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// Index holds one document per raid.
+const Index = "raids"
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"id":{
+				"type":"keyword"
+			},
+			"from":{
+				"type":"keyword"
+			},
+			"from_id":{
+				"type":"keyword"
+			},
+			"to":{
+				"type":"keyword"
+			},
+			"viewers":{
+				"type":"integer"
+			},
+			"time":{
+				"type":"date"
+			}
+		}
+	}
+}`
+
+// Directions of a channel's raids.
+const (
+	// In are the raids a channel received
+	In = "in"
+	// Out are the raids a channel sent
+	Out = "out"
+)
+
+// Raid is an edge of the raid network. Channels are stored without the leading #.
+type Raid struct {
+	ID      string    `json:"id"`
+	From    string    `json:"from"`
+	FromID  string    `json:"from_id,omitempty"`
+	To      string    `json:"to"`
+	Viewers int       `json:"viewers"`
+	Time    time.Time `json:"time"`
+}
+
+// FromMessage returns the raid of a raid notice, ok is false for other messages.
+func FromMessage(id string, m irc.Message) (r Raid, ok bool) {
+	if m.Type != irc.TypeRaid || m.User == "" {
+		return r, false
+	}
+
+	return Raid{
+		ID:      id,
+		From:    strings.ToLower(m.User),
+		FromID:  m.UserID,
+		To:      strings.TrimPrefix(strings.ToLower(m.Channel), "#"),
+		Viewers: m.Viewers,
+		Time:    m.Timestamp,
+	}, true
+}
+
+// Store indexes raids in the background.
+type Store struct {
+	connector *config.ElasticConnector
+	processor *elastic.BulkProcessor
+	failed    int64
+	l         logrus.FieldLogger
+}
+
+// NewStore creates the raids index if needed and starts a bulk processor.
+func NewStore(ctx context.Context, connector *config.ElasticConnector, l logrus.FieldLogger) (*Store, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+
+	s := &Store{connector: connector, l: l}
+	processor, err := connector.GetClient().BulkProcessor().
+		Name("raids").
+		Workers(1).
+		BulkActions(500).
+		FlushInterval(5 * time.Second).
+		After(s.after).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.processor = processor
+	return s, nil
+}
+
+func (s *Store) after(id int64, requests []elastic.BulkableRequest, res *elastic.BulkResponse, err error) {
+	if err != nil {
+		atomic.AddInt64(&s.failed, int64(len(requests)))
+		s.l.WithError(err).Errorf("Could not store %d raids", len(requests))
+		return
+	}
+	if failed := res.Failed(); len(failed) > 0 {
+		atomic.AddInt64(&s.failed, int64(len(failed)))
+		s.l.Errorf("Could not store %d raids: %s", len(failed), failed[0].Error.Reason)
+	}
+}
+
+// Add queues a raid, raids are keyed on the id of their notice so storing one twice replaces it.
+func (s *Store) Add(r Raid) {
+	s.processor.Add(elastic.NewBulkIndexRequest().Index(Index).Id(r.ID).Doc(r))
+}
+
+// Hook returns an irc.Hook storing every raid notice.
+func (s *Store) Hook() irc.Hook {
+	return func(id string, m irc.Message) {
+		if r, ok := FromMessage(id, m); ok {
+			s.Add(r)
+		}
+	}
+}
+
+// Flush waits until the queued raids are stored.
+func (s *Store) Flush() error {
+	return s.processor.Flush()
+}
+
+// Close flushes and stops the bulk processor.
+func (s *Store) Close() error {
+	return s.processor.Close()
+}
+
+// Failed returns the number of raids that could not be stored.
+func (s *Store) Failed() int64 {
+	return atomic.LoadInt64(&s.failed)
+}
+
+// Backfill stores the raid notices in the twitch index between from and to,
+// e.g. imported or replayed ones, and returns how many there were.
+func (s *Store) Backfill(ctx context.Context, from, to time.Time) (int, error) {
+	q := elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("Type", irc.TypeRaid),
+		elastic.NewRangeQuery("Timestamp").Gte(from).Lt(to),
+	)
+
+	n := 0
+	var after []interface{}
+	for {
+		search := s.connector.GetClient().Search().Index("twitch").Query(q).
+			Sort("Timestamp", true).Sort("_id", true).Size(1000)
+		if after != nil {
+			search = search.SearchAfter(after...)
+		}
+
+		sr, err := search.Do(ctx)
+		if err != nil {
+			return n, err
+		}
+		for _, hit := range sr.Hits.Hits {
+			after = hit.Sort
+			var m irc.Message
+			if err := json.Unmarshal(hit.Source, &m); err != nil {
+				return n, err
+			}
+			if r, ok := FromMessage(hit.Id, m); ok {
+				s.Add(r)
+				n++
+			}
+		}
+		if len(sr.Hits.Hits) < 1000 {
+			return n, s.Flush()
+		}
+	}
+}
+
+// Query selects raids.
+type Query struct {
+	// Channel and Direction select the raids a channel received or sent,
+	// every raid is selected without a channel
+	Channel   string
+	Direction string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	// ExcludeChannels leaves out raids from or to these channels, e.g. private ones
+	ExcludeChannels []string
+}
+
+func (q Query) query() elastic.Query {
+	b := elastic.NewBoolQuery().Filter(elastic.NewRangeQuery("time").Gte(q.From).Lt(q.To))
+	if q.Channel != "" {
+		field := "to"
+		if q.Direction == Out {
+			field = "from"
+		}
+		b = b.Filter(elastic.NewTermQuery(field, strings.TrimPrefix(strings.ToLower(q.Channel), "#")))
+	}
+	if len(q.ExcludeChannels) > 0 {
+		excluded := make([]interface{}, len(q.ExcludeChannels))
+		for i, ch := range q.ExcludeChannels {
+			excluded[i] = strings.TrimPrefix(strings.ToLower(ch), "#")
+		}
+		b = b.MustNot(elastic.NewTermsQuery("from", excluded...), elastic.NewTermsQuery("to", excluded...))
+	}
+	return b
+}
+
+// Find returns the raids selected by q, newest first.
+func Find(ctx context.Context, client *elastic.Client, q Query) ([]*Raid, error) {
+	sr, err := client.Search().Index(Index).Query(q.query()).Sort("time", false).Size(q.Limit).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return []*Raid{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	raids := []*Raid{}
+	for _, hit := range sr.Hits.Hits {
+		r := new(Raid)
+		if err := json.Unmarshal(hit.Source, r); err != nil {
+			return nil, err
+		}
+		raids = append(raids, r)
+	}
+	return raids, nil
+}
+
+// Partner is a channel that raided, or was raided by, another.
+type Partner struct {
+	Channel      string    `json:"channel"`
+	Raids        int64     `json:"raids"`
+	Viewers      int64     `json:"viewers"`
+	AvgViewers   float64   `json:"avg_viewers"`
+	LastRaidedAt time.Time `json:"last_raided_at"`
+}
+
+// Top ranks the channels that raided q.Channel, or that it raided with
+// direction Out, by the viewers they brought along in total.
+func Top(ctx context.Context, client *elastic.Client, q Query) ([]*Partner, error) {
+	field := "from"
+	if q.Direction == Out {
+		field = "to"
+	}
+
+	partners := elastic.NewTermsAggregation().Field(field).Size(q.Limit).
+		Order("viewers", false).
+		SubAggregation("viewers", elastic.NewSumAggregation().Field("viewers")).
+		SubAggregation("last", elastic.NewMaxAggregation().Field("time"))
+
+	sr, err := client.Search().Index(Index).Query(q.query()).Size(0).Aggregation("partners", partners).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return []*Partner{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	top := []*Partner{}
+	agg, ok := sr.Aggregations.Terms("partners")
+	if !ok {
+		return top, nil
+	}
+	for _, b := range agg.Buckets {
+		p := &Partner{Channel: fmt.Sprint(b.Key), Raids: b.DocCount}
+		if sum, ok := b.Sum("viewers"); ok && sum.Value != nil {
+			p.Viewers = int64(*sum.Value)
+			p.AvgViewers = *sum.Value / float64(b.DocCount)
+		}
+		if last, ok := b.Max("last"); ok && last.Value != nil {
+			p.LastRaidedAt = time.Unix(0, int64(*last.Value)*int64(time.Millisecond)).UTC()
+		}
+		top = append(top, p)
+	}
+	return top, nil
+}
+
+// Graph returns the raid network between from and to as a directed graph. Every
+// pair of channels gets one edge with the number of raids and the viewers sent.
+func Graph(ctx context.Context, client *elastic.Client, from, to time.Time) (*graph.Graph, error) {
+	q := Query{From: from, To: to}
+	g := graph.New(true)
+	edges := map[[2]string]*graph.Edge{}
+
+	var after []interface{}
+	for {
+		search := client.Search().Index(Index).Query(q.query()).Sort("time", true).Sort("id", true).Size(1000)
+		if after != nil {
+			search = search.SearchAfter(after...)
+		}
+
+		sr, err := search.Do(ctx)
+		if elastic.IsNotFound(err) {
+			return g, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hit := range sr.Hits.Hits {
+			after = hit.Sort
+			var r Raid
+			if err := json.Unmarshal(hit.Source, &r); err != nil {
+				return nil, err
+			}
+
+			pair := [2]string{r.From, r.To}
+			e, ok := edges[pair]
+			if !ok {
+				e = g.Connect(r.From, r.To, map[string]interface{}{"raids": int64(0), "viewers": int64(0)})
+				edges[pair] = e
+			}
+			e.Attrs["raids"] = e.Attrs["raids"].(int64) + 1
+			e.Attrs["viewers"] = e.Attrs["viewers"].(int64) + int64(r.Viewers)
+			e.Attrs["last_raid"] = r.Time.Format(time.RFC3339)
+		}
+		if len(sr.Hits.Hits) < 1000 {
+			return g, nil
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package spam
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// Index holds the clusters of repeated messages.
+const Index = "spam"
+
+const mapping = `
+{
+	"mappings":{
+		"properties":{
+			"text":{
+				"type":"text"
+			},
+			"hash":{
+				"type":"keyword"
+			},
+			"messages":{
+				"type":"long"
+			},
+			"num_users":{
+				"type":"integer"
+			},
+			"num_channels":{
+				"type":"integer"
+			},
+			"users":{
+				"properties":{
+					"name":{
+						"type":"keyword"
+					}
+				}
+			},
+			"channels":{
+				"properties":{
+					"name":{
+						"type":"keyword"
+					}
+				}
+			},
+			"first_seen":{
+				"type":"date"
+			},
+			"last_seen":{
+				"type":"date"
+			},
+			"copypasta":{
+				"type":"boolean"
+			},
+			"spam":{
+				"type":"boolean"
+			}
+		}
+	}
+}`
+
+// Poster is a user or channel that posted messages of a cluster.
+type Poster struct {
+	Name      string    `json:"name"`
+	Messages  int64     `json:"messages"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Cluster is a group of near-duplicate messages.
+type Cluster struct {
+	ID string `json:"id"`
+	// Text is the first message of the cluster as it was posted
+	Text        string    `json:"text"`
+	Hash        string    `json:"hash"`
+	Messages    int64     `json:"messages"`
+	NumUsers    int       `json:"num_users"`
+	NumChannels int       `json:"num_channels"`
+	Users       []*Poster `json:"users"`
+	Channels    []*Poster `json:"channels"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	// Copypasta is set once many users posted the text, Spam once it was
+	// repeated by the same accounts or spread over many channels
+	Copypasta bool `json:"copypasta"`
+	Spam      bool `json:"spam"`
+	// MessageIDs are the document ids of the first messages of the cluster
+	MessageIDs []string `json:"message_ids"`
+}
+
+// Query selects stored clusters.
+type Query struct {
+	Channel   string
+	User      string
+	From      time.Time
+	To        time.Time
+	Copypasta bool
+	Spam      bool
+	Limit     int
+}
+
+// Find returns the stored clusters matching q. Copypastas are ordered by the
+// number of users that posted them, everything else by when it was last seen.
+func Find(ctx context.Context, client *elastic.Client, q Query) ([]*Cluster, error) {
+	query := elastic.NewBoolQuery()
+	if q.Channel != "" {
+		query = query.Filter(elastic.NewTermQuery("channels.name", q.Channel))
+	}
+	if q.User != "" {
+		query = query.Filter(elastic.NewTermQuery("users.name", q.User))
+	}
+	if !q.From.IsZero() {
+		query = query.Filter(elastic.NewRangeQuery("last_seen").Gte(q.From))
+	}
+	if !q.To.IsZero() {
+		query = query.Filter(elastic.NewRangeQuery("first_seen").Lte(q.To))
+	}
+	if q.Copypasta {
+		query = query.Filter(elastic.NewTermQuery("copypasta", true))
+	}
+	if q.Spam {
+		query = query.Filter(elastic.NewTermQuery("spam", true))
+	}
+
+	search := client.Search().Index(Index).Query(query).Size(q.Limit)
+	if q.Copypasta {
+		search = search.Sort("num_users", false)
+	}
+	search = search.Sort("last_seen", false)
+
+	sr, err := search.Do(ctx)
+	if elastic.IsNotFound(err) {
+		// Nothing was ever detected
+		return []*Cluster{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := []*Cluster{}
+	for _, hit := range sr.Hits.Hits {
+		c := new(Cluster)
+		if err := json.Unmarshal(hit.Source, c); err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, nil
+}
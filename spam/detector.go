@@ -0,0 +1,309 @@
+package spam
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/djdduty/ttv-log/irc"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPosters caps the users and channels recorded per cluster
+	maxPosters = 1000
+	// maxMessageIDs caps the message ids recorded per cluster
+	maxMessageIDs = 20
+)
+
+// Detector groups near-duplicate messages into clusters. Messages are compared
+// by the simhash of their normalized text, so added emotes, changed casing or
+// invisible characters don't split a cluster.
+type Detector struct {
+	// MinLength is the normalized length a message needs to be considered, short messages repeat naturally
+	MinLength int
+	// MaxDistance is the number of simhash bits near-duplicates may differ in, at most 3
+	MaxDistance int
+	// MinMessages is the size a cluster needs to be stored
+	MinMessages int64
+	// CopypastaUsers is the number of users that make a cluster a copypasta
+	CopypastaUsers int
+	// SpamChannels is the number of channels that make a cluster spam
+	SpamChannels int
+	// SpamRepeats is the average number of times per user that makes a cluster spam
+	SpamRepeats float64
+	// TTL is how long a cluster is kept in memory after its last message
+	TTL time.Duration
+
+	connector *config.ElasticConnector
+	l         logrus.FieldLogger
+
+	mu       sync.Mutex
+	clusters map[string]*entry
+	bands    map[uint64][]*entry
+}
+
+type entry struct {
+	cluster  *Cluster
+	hash     uint64
+	users    map[string]*Poster
+	channels map[string]*Poster
+	dirty    bool
+	// version counts the changes, so a flush only clears dirty when nothing changed while it was stored
+	version int64
+}
+
+// NewDetector creates a detector storing clusters through connector.
+func NewDetector(connector *config.ElasticConnector, l logrus.FieldLogger) (*Detector, error) {
+	if err := connector.EnsureIndex(Index, mapping); err != nil {
+		return nil, err
+	}
+
+	return &Detector{
+		MinLength:      30,
+		MaxDistance:    3,
+		MinMessages:    3,
+		CopypastaUsers: 3,
+		SpamChannels:   3,
+		SpamRepeats:    3,
+		TTL:            time.Hour,
+		connector:      connector,
+		l:              l,
+		clusters:       map[string]*entry{},
+		bands:          map[uint64][]*entry{},
+	}, nil
+}
+
+// Hook returns an irc.Hook adding every message to the detector.
+func (d *Detector) Hook() irc.Hook {
+	return d.Add
+}
+
+// Add puts a message into the cluster of its near-duplicates, or starts a new one.
+func (d *Detector) Add(id string, m irc.Message) {
+	if m.Type != "" && m.Type != irc.TypeMessage && m.Type != irc.TypeAction {
+		return
+	}
+	normalized := Normalize(withoutEmotes(m.Message, m.Emotes))
+	if len([]rune(normalized)) < d.MinLength {
+		return
+	}
+	hash := SimHash(normalized)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := d.match(hash)
+	if e == nil {
+		e = &entry{
+			cluster: &Cluster{
+				ID:        clusterID(hash, m.Timestamp),
+				Text:      m.Message,
+				Hash:      strconv.FormatUint(hash, 16),
+				FirstSeen: m.Timestamp,
+			},
+			hash:     hash,
+			users:    map[string]*Poster{},
+			channels: map[string]*Poster{},
+		}
+		d.insert(e)
+	}
+	d.record(e, id, m)
+}
+
+// withoutEmotes drops the emotes from text, spammers add them to get past duplicate filters.
+func withoutEmotes(text string, emotes []string) string {
+	if len(emotes) == 0 {
+		return text
+	}
+
+	words := strings.Fields(text)
+	kept := words[:0]
+	for _, w := range words {
+		isEmote := false
+		for _, e := range emotes {
+			if w == e {
+				isEmote = true
+				break
+			}
+		}
+		if !isEmote {
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func (d *Detector) match(hash uint64) *entry {
+	var best *entry
+	bestDistance := d.MaxDistance + 1
+	for _, band := range bands(hash) {
+		for _, e := range d.bands[band] {
+			if dist := Distance(hash, e.hash); dist < bestDistance {
+				best, bestDistance = e, dist
+			}
+		}
+	}
+	return best
+}
+
+func (d *Detector) insert(e *entry) {
+	d.clusters[e.cluster.ID] = e
+	for _, band := range bands(e.hash) {
+		d.bands[band] = append(d.bands[band], e)
+	}
+}
+
+func (d *Detector) record(e *entry, id string, m irc.Message) {
+	c := e.cluster
+	c.Messages++
+	if m.Timestamp.After(c.LastSeen) {
+		c.LastSeen = m.Timestamp
+	}
+	if len(c.MessageIDs) < maxMessageIDs {
+		c.MessageIDs = append(c.MessageIDs, id)
+	}
+
+	post(e.users, m.User, m.Timestamp)
+	post(e.channels, strings.TrimPrefix(m.Channel, "#"), m.Timestamp)
+	c.NumUsers = len(e.users)
+	c.NumChannels = len(e.channels)
+
+	c.Copypasta = c.NumUsers >= d.CopypastaUsers
+	c.Spam = c.Messages >= d.MinMessages &&
+		(c.NumChannels >= d.SpamChannels || float64(c.Messages)/float64(c.NumUsers) >= d.SpamRepeats)
+	e.dirty = true
+	e.version++
+}
+
+func post(posters map[string]*Poster, name string, at time.Time) {
+	p, ok := posters[name]
+	if !ok {
+		if len(posters) >= maxPosters {
+			return
+		}
+		p = &Poster{Name: name, FirstSeen: at}
+		posters[name] = p
+	}
+	p.Messages++
+	if at.After(p.LastSeen) {
+		p.LastSeen = at
+	}
+}
+
+func clusterID(hash uint64, first time.Time) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%x\x00%d", hash, first.UnixNano())))
+	return hex.EncodeToString(sum[:])
+}
+
+// Run stores the changed clusters every interval and forgets clusters that
+// went quiet, until ctx is done.
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			if err := d.Flush(context.Background()); err != nil {
+				d.l.WithError(err).Errorln("Could not store spam clusters")
+			}
+			return
+		}
+
+		if err := d.Flush(ctx); err != nil {
+			d.l.WithError(err).Errorln("Could not store spam clusters")
+		}
+		d.expire(time.Now().Add(-d.TTL))
+	}
+}
+
+// Flush stores the clusters that changed and are large enough. Clusters stay
+// changed until elasticsearch stored them, so failed ones are retried.
+func (d *Detector) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	bulk := d.connector.GetClient().Bulk().Index(Index)
+	versions := map[string]int64{}
+	for id, e := range d.clusters {
+		if !e.dirty || e.cluster.Messages < d.MinMessages {
+			continue
+		}
+		e.cluster.Users = posters(e.users)
+		e.cluster.Channels = posters(e.channels)
+		doc := *e.cluster
+		doc.MessageIDs = append([]string(nil), doc.MessageIDs...)
+		bulk.Add(elastic.NewBulkIndexRequest().Id(doc.ID).Doc(&doc))
+		versions[id] = e.version
+	}
+	d.mu.Unlock()
+
+	if bulk.NumberOfActions() == 0 {
+		return nil
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	failed := res.Failed()
+	d.mu.Lock()
+	for _, item := range failed {
+		delete(versions, item.Id)
+	}
+	for id, version := range versions {
+		if e, ok := d.clusters[id]; ok && e.version == version {
+			e.dirty = false
+		}
+	}
+	d.mu.Unlock()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not store %d clusters: %s", len(failed), failed[0].Error.Reason)
+	}
+	return nil
+}
+
+func posters(m map[string]*Poster) []*Poster {
+	list := make([]*Poster, 0, len(m))
+	for _, p := range m {
+		copied := *p
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Messages > list[j].Messages })
+	return list
+}
+
+// expire forgets the clusters without messages since before.
+func (d *Detector) expire(before time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for id, e := range d.clusters {
+		stored := e.cluster.Messages >= d.MinMessages
+		if (e.dirty && stored) || !e.cluster.LastSeen.Before(before) {
+			continue
+		}
+		delete(d.clusters, id)
+		for _, band := range bands(e.hash) {
+			d.bands[band] = remove(d.bands[band], e)
+			if len(d.bands[band]) == 0 {
+				delete(d.bands, band)
+			}
+		}
+	}
+}
+
+func remove(entries []*entry, e *entry) []*entry {
+	for i, other := range entries {
+		if other == e {
+			return append(entries[:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
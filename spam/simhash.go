@@ -0,0 +1,94 @@
+package spam
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// Normalize lower cases text, drops invisible characters spammers use to get
+// past duplicate filters and turns punctuation into spaces.
+func Normalize(text string) string {
+	var b strings.Builder
+	var last rune
+	repeats := 0
+	space := true
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Cf, unicode.Co, unicode.Cc):
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		default:
+			if !space {
+				b.WriteRune(' ')
+				space = true
+			}
+			last, repeats = 0, 0
+			continue
+		}
+
+		// "LULLLLL" and "LULL" are the same message
+		if r == last {
+			repeats++
+			if repeats >= 2 {
+				continue
+			}
+		} else {
+			last, repeats = r, 0
+		}
+		b.WriteRune(r)
+		space = false
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// SimHash returns the 64 bit simhash of the words and word pairs of normalized
+// text. Texts that differ in a few words have hashes that differ in a few bits.
+func SimHash(normalized string) uint64 {
+	words := strings.Fields(normalized)
+	features := make([]string, 0, 2*len(words))
+	for i, w := range words {
+		features = append(features, w)
+		if i > 0 {
+			features = append(features, words[i-1]+" "+w)
+		}
+	}
+
+	var weights [64]int
+	for _, f := range features {
+		h := fnv.New64a()
+		h.Write([]byte(f))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << uint(bit)
+		}
+	}
+	return hash
+}
+
+// Distance is the number of bits two simhashes differ in.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// bands splits a hash into four 16 bit bands. Hashes within a distance of 3
+// share at least one band, so only clusters sharing a band need comparing.
+func bands(hash uint64) [4]uint64 {
+	var b [4]uint64
+	for i := range b {
+		b[i] = uint64(i)<<16 | (hash>>(uint(i)*16))&0xffff
+	}
+	return b
+}
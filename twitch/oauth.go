@@ -0,0 +1,348 @@
+package twitch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrTokenInvalid is returned when twitch rejects the access token and it can't be refreshed.
+var ErrTokenInvalid = errors.New("twitch access token is invalid or expired")
+
+// Token is a twitch user access token.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	Login        string    `json:"login,omitempty"`
+	Scopes       []string  `json:"scopes,omitempty"`
+}
+
+type validateResponse struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	Scopes    []string `json:"scopes"`
+	UserID    string   `json:"user_id"`
+	ExpiresIn int64    `json:"expires_in"`
+}
+
+type refreshResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int64    `json:"expires_in"`
+	Scope        []string `json:"scope"`
+}
+
+// TokenManager validates the IRC access token and refreshes it before it expires.
+// Rotated tokens are written to the token file, so they survive restarts and
+// other processes sharing the file pick them up.
+type TokenManager struct {
+	baseURL      string
+	clientID     string
+	clientSecret string
+	file         string
+	warnBefore   time.Duration
+	httpClient   *http.Client
+	l            logrus.FieldLogger
+
+	// AutoRefresh enables refreshing tokens that are about to expire.
+	// Only one process sharing a token file should refresh.
+	AutoRefresh bool
+
+	mu       sync.Mutex
+	token    Token
+	modTime  time.Time
+	lastErr  error
+	verified time.Time
+}
+
+// NewTokenManager creates a manager for the configured token. A token file
+// takes precedence over TWITCH_PASS and TWITCH_REFRESH_TOKEN once it exists.
+func NewTokenManager(c *config.Config) (*TokenManager, error) {
+	t := &TokenManager{
+		baseURL:      strings.TrimSuffix(c.TwitchOAuthURL, "/"),
+		clientID:     c.TwitchClientID,
+		clientSecret: c.TwitchClientSecret,
+		file:         c.TwitchTokenFile,
+		warnBefore:   c.TwitchTokenExpiryWarning,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		l:            c.GetLogger(),
+		token: Token{
+			AccessToken:  strings.TrimPrefix(c.TwitchPass, "oauth:"),
+			RefreshToken: c.TwitchRefreshToken,
+		},
+	}
+
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Password returns the access token in the "oauth:..." form IRC expects.
+func (t *TokenManager) Password() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return "oauth:" + t.token.AccessToken
+}
+
+// Token returns a copy of the current token.
+func (t *TokenManager) Token() Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// Run validates the token every interval, as twitch requires, until ctx is done.
+func (t *TokenManager) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+
+		if err := t.Validate(ctx); err != nil {
+			t.l.WithError(err).Errorln("Twitch token validation failed")
+		}
+	}
+}
+
+// Validate checks the token with twitch. Invalid tokens, and tokens that
+// expire within the warning period, are refreshed if AutoRefresh is enabled.
+func (t *TokenManager) Validate(ctx context.Context) error {
+	if err := t.reload(); err != nil {
+		return t.fail(err)
+	}
+
+	res, err := t.validate(ctx)
+	if err == ErrTokenInvalid && t.canRefresh() {
+		t.l.Warnln("Twitch token was rejected, refreshing")
+		return t.fail(t.Refresh(ctx))
+	}
+	if err != nil {
+		return t.fail(err)
+	}
+
+	t.mu.Lock()
+	t.token.Login = res.Login
+	t.token.Scopes = res.Scopes
+	if res.ExpiresIn > 0 {
+		t.token.ExpiresAt = time.Now().UTC().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	t.verified = time.Now()
+	t.lastErr = nil
+	expiresAt := t.token.ExpiresAt
+	t.mu.Unlock()
+
+	if !expiresAt.IsZero() && time.Until(expiresAt) < t.warnBefore {
+		if t.canRefresh() {
+			return t.fail(t.Refresh(ctx))
+		}
+		if !t.hasRefreshToken() {
+			t.l.Warnf("Twitch token for %s expires at %s and can't be refreshed", res.Login, expiresAt)
+		}
+	}
+	return nil
+}
+
+// Refresh exchanges the refresh token for a new access token and persists it.
+func (t *TokenManager) Refresh(ctx context.Context) error {
+	t.mu.Lock()
+	refreshToken := t.token.RefreshToken
+	t.mu.Unlock()
+
+	if refreshToken == "" {
+		return errors.New("no twitch refresh token configured")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	form.Set("client_id", t.clientID)
+	form.Set("client_secret", t.clientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, t.baseURL+"/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := t.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return errors.Errorf("refreshing twitch token failed with %d: %s", res.StatusCode, body)
+	}
+
+	var refreshed refreshResponse
+	if err := json.NewDecoder(res.Body).Decode(&refreshed); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.token.AccessToken = refreshed.AccessToken
+	if refreshed.RefreshToken != "" {
+		t.token.RefreshToken = refreshed.RefreshToken
+	}
+	t.token.Scopes = refreshed.Scope
+	t.token.ExpiresAt = time.Now().UTC().Add(time.Duration(refreshed.ExpiresIn) * time.Second)
+	t.verified = time.Now()
+	t.lastErr = nil
+	token := t.token
+	t.mu.Unlock()
+
+	t.l.Infof("Refreshed twitch token, expires at %s", token.ExpiresAt)
+	return t.persist(token)
+}
+
+// Check is a health.ReadyChecker reporting invalid tokens and tokens about to
+// expire that can't be refreshed. A token with a refresh token is fine even
+// without AutoRefresh, as the process refreshing it shares the token file.
+func (t *TokenManager) Check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lastErr != nil {
+		return t.lastErr
+	}
+	if t.token.ExpiresAt.IsZero() {
+		return nil
+	}
+
+	remaining := time.Until(t.token.ExpiresAt)
+	if remaining <= 0 {
+		return ErrTokenInvalid
+	}
+	if remaining < t.warnBefore && t.token.RefreshToken == "" {
+		return errors.Errorf("twitch access token expires at %s", t.token.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (t *TokenManager) validate(ctx context.Context) (*validateResponse, error) {
+	t.mu.Lock()
+	accessToken := t.token.AccessToken
+	t.mu.Unlock()
+
+	req, err := http.NewRequest(http.MethodGet, t.baseURL+"/oauth2/validate", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("OAuth %s", accessToken))
+
+	res, err := t.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, ErrTokenInvalid
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("validating twitch token failed with %d", res.StatusCode)
+	}
+
+	validated := new(validateResponse)
+	if err := json.NewDecoder(res.Body).Decode(validated); err != nil {
+		return nil, err
+	}
+	return validated, nil
+}
+
+func (t *TokenManager) canRefresh() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.AutoRefresh && t.token.RefreshToken != ""
+}
+
+func (t *TokenManager) hasRefreshToken() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token.RefreshToken != ""
+}
+
+func (t *TokenManager) fail(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastErr = err
+	return err
+}
+
+// reload reads the token file if it changed since it was last read.
+func (t *TokenManager) reload() error {
+	if t.file == "" {
+		return nil
+	}
+
+	info, err := os.Stat(t.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !info.ModTime().After(t.modTime) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return errors.Wrapf(err, "could not read twitch token file %s", t.file)
+	}
+
+	t.token = token
+	t.modTime = info.ModTime()
+	return nil
+}
+
+func (t *TokenManager) persist(token Token) error {
+	if t.file == "" {
+		t.l.Warnln("TWITCH_TOKEN_FILE is not set, the refreshed token will be lost on restart")
+		return nil
+	}
+
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := t.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, t.file); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(t.file); err == nil {
+		t.mu.Lock()
+		t.modTime = info.ModTime()
+		t.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const streamsURL = "https://api.twitch.tv/kraken/streams/"
+
+type channel struct {
+	Name string `json:"name"`
+}
+
+type stream struct {
+	Channel channel `json:"channel"`
+}
+
+type streamResponse struct {
+	Total   int      `json:"_total"`
+	Streams []stream `json:"streams"`
+}
+
+// AppendIfMissing adds element to slice if missing
+func AppendIfMissing(slice []string, val string) []string {
+	for _, ele := range slice {
+		if ele == val {
+			return slice
+		}
+	}
+	return append(slice, val)
+}
+
+// TopStreams returns the names of up to numStreams currently live channels,
+// ordered by viewer count. It won't come out to exactly numStreams thanks to
+// duplicates between pages.
+func TopStreams(clientID string, numStreams int) ([]string, error) {
+	httpClient := http.Client{
+		Timeout: time.Second * 30,
+	}
+	streams := []string{}
+
+	for i := 0; i < numStreams/100; i = i + 1 {
+		offset := i * 100
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?limit=100&offset=%d", streamsURL, offset), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Accept", "application/vnd.twitchtv.v5+json")
+		req.Header.Set("Client-ID", clientID)
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		streamData := streamResponse{}
+		if err := json.Unmarshal(body, &streamData); err != nil {
+			return nil, err
+		}
+
+		for _, stream := range streamData.Streams {
+			streams = AppendIfMissing(streams, stream.Channel.Name)
+		}
+	}
+
+	return streams, nil
+}
@@ -0,0 +1,124 @@
+// Package web serves the logs as server-rendered HTML pages, so they can be
+// browsed without building the client.
+package web
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/config"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"github.com/unrolled/render"
+)
+
+const (
+	// ChannelsPath lists the logged channels.
+	ChannelsPath = "/"
+	// ChannelPath is a channel's log of one day.
+	ChannelPath = "/channels/:name"
+	// UserPath is a user's log across channels.
+	UserPath = "/users/:name"
+	// SearchPath shows search results.
+	SearchPath = "/search"
+	// StylesheetPath is the stylesheet of every page, the CSP doesn't allow inline styles.
+	StylesheetPath = "/style.css"
+)
+
+// Funcs are the template funcs the pages need besides noescape.
+var Funcs = template.FuncMap{
+	"date":  func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"stamp": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05") },
+	"trim":  func(channel string) string { return strings.TrimPrefix(channel, "#") },
+	"event": func(messageType string) bool {
+		return messageType != "" && messageType != "message" && messageType != "action"
+	},
+	"highlight": highlight,
+	"dict":      dict,
+}
+
+// Handler renders the pages.
+type Handler struct {
+	R *render.Render
+	E *config.ElasticConnector
+	L logrus.FieldLogger
+
+	// DedupWindow is the window in which identical messages are treated as duplicates
+	DedupWindow time.Duration
+}
+
+// NewHandler instantiates a handler. r must be created with the templates directory, the "layout" layout and Funcs.
+func NewHandler(r *render.Render, e *config.ElasticConnector, l logrus.FieldLogger) *Handler {
+	return &Handler{R: r, E: e, L: l}
+}
+
+// SetRoutes registers this handler's routes.
+func (h *Handler) SetRoutes(r *httprouter.Router) {
+	r.GET(ChannelsPath, h.Channels)
+	r.GET(ChannelPath, h.Channel)
+	r.GET(UserPath, h.User)
+	r.GET(SearchPath, h.Search)
+	r.GET(StylesheetPath, h.Stylesheet)
+}
+
+// page is the data every template gets.
+type page struct {
+	Title string
+	Query string
+	Data  interface{}
+}
+
+func (h *Handler) html(rw http.ResponseWriter, status int, name, title string, data interface{}) {
+	h.R.HTML(rw, status, name, &page{Title: title, Data: data})
+}
+
+func (h *Handler) error(rw http.ResponseWriter, status int, err error) {
+	if status >= 500 {
+		h.L.WithError(err).Errorln("Could not render page")
+	}
+	h.html(rw, status, "error", http.StatusText(status), err.Error())
+}
+
+// dict builds a map from key value pairs, to hand several values to a template.
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs key value pairs")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, errors.New("dict keys must be strings")
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// highlight escapes text and marks every word of query in it.
+func highlight(text, query string) string {
+	var patterns []string
+	for _, w := range strings.Fields(query) {
+		if w = strings.Trim(w, `"`); w != "" {
+			patterns = append(patterns, regexp.QuoteMeta(w))
+		}
+	}
+	if len(patterns) == 0 {
+		return template.HTMLEscapeString(text)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:m[0]]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[m[0]:m[1]]) + "</mark>")
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return b.String()
+}
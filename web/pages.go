@@ -0,0 +1,220 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/djdduty/ttv-log/api"
+	"github.com/djdduty/ttv-log/apikey"
+	"github.com/julienschmidt/httprouter"
+	"github.com/olivere/elastic/v7"
+)
+
+// pageSize is the number of messages per page.
+const pageSize = 500
+
+// ChannelRow is a channel on the channel list.
+type ChannelRow struct {
+	Name        string
+	NumMessages int64
+	LastMessage time.Time
+}
+
+// LogPage is a page of messages.
+type LogPage struct {
+	Name     string
+	Day      time.Time
+	PrevDay  string
+	NextDay  string
+	First    string
+	Next     string
+	Total    int64
+	Messages []*api.Message
+}
+
+// SearchPage is a page of search results.
+type SearchPage struct {
+	LogPage
+	Query   string
+	Channel string
+	User    string
+	Mode    string
+}
+
+// Channels lists the logged channels, most active first.
+func (h *Handler) Channels(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	channels := elastic.NewTermsAggregation().Field("Channel.keyword").Size(1000).
+		SubAggregation("last", elastic.NewMaxAggregation().Field("Timestamp"))
+	q := api.NewFinder().ExcludeChannels(apikey.FromContext(r.Context()).Hidden()...).Filter()
+	sr, err := h.E.GetClient().Search().Index("twitch").Query(q).Size(0).Aggregation("channels", channels).Do(ctx)
+	if err != nil {
+		h.error(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	rows := []*ChannelRow{}
+	if agg, ok := sr.Aggregations.Terms("channels"); ok {
+		for _, b := range agg.Buckets {
+			row := &ChannelRow{Name: strings.TrimPrefix(fmt.Sprint(b.Key), "#"), NumMessages: b.DocCount}
+			if last, ok := b.Max("last"); ok && last.Value != nil {
+				row.LastMessage = time.Unix(0, int64(*last.Value)*int64(time.Millisecond)).UTC()
+			}
+			rows = append(rows, row)
+		}
+	}
+	h.html(rw, http.StatusOK, "channels", "Channels", rows)
+}
+
+// Channel shows the log of a channel on the day given as date, today by default.
+func (h *Handler) Channel(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	name := strings.ToLower(strings.TrimPrefix(ps.ByName("name"), "#"))
+
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := queryValues.Get("date"); v != "" {
+		var err error
+		if day, err = time.Parse("2006-01-02", v); err != nil {
+			h.error(rw, http.StatusBadRequest, errors.New("date must look like 2006-01-02"))
+			return
+		}
+	}
+
+	finder := api.NewFinder().Channels(name).Day(day).Sort("Timestamp", "_id")
+	log, ok := h.find(rw, r, finder)
+	if !ok {
+		return
+	}
+
+	log.Name = name
+	log.Day = day
+	base := url.Values{}
+	base.Set("date", day.AddDate(0, 0, -1).Format("2006-01-02"))
+	log.PrevDay = "?" + base.Encode()
+	if next := day.AddDate(0, 0, 1); !next.After(time.Now()) {
+		base.Set("date", next.Format("2006-01-02"))
+		log.NextDay = "?" + base.Encode()
+	}
+	h.html(rw, http.StatusOK, "channel", fmt.Sprintf("%s on %s", name, day.Format("2006-01-02")), log)
+}
+
+// User shows a user's messages across channels, newest first. Logins are resolved at the time given as at.
+func (h *Handler) User(rw http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	queryValues := r.URL.Query()
+	login := strings.ToLower(ps.ByName("name"))
+
+	at := time.Now().UTC()
+	if v := queryValues.Get("at"); v != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			h.error(rw, http.StatusBadRequest, errors.New("at must be an RFC3339 timestamp"))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+	userID, err := api.ResolveUserID(ctx, h.E.GetClient(), login, at)
+	if err != nil {
+		h.error(rw, http.StatusInternalServerError, err)
+		return
+	}
+	legacy, err := api.LegacyLogin(ctx, h.E.GetClient(), userID, login)
+	if err != nil {
+		h.error(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	finder := api.NewFinder().Account(userID, legacy).Sort("-Timestamp", "-_id")
+	if channel := queryValues.Get("channel"); channel != "" {
+		finder = finder.Channels(channel)
+	}
+	log, ok := h.find(rw, r, finder)
+	if !ok {
+		return
+	}
+
+	log.Name = login
+	h.html(rw, http.StatusOK, "user", login, log)
+}
+
+// Search shows the messages matching q, newest first, optionally only of a channel or user.
+func (h *Handler) Search(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	queryValues := r.URL.Query()
+	s := &SearchPage{
+		Query:   strings.TrimSpace(queryValues.Get("q")),
+		Channel: strings.TrimPrefix(strings.TrimSpace(queryValues.Get("channel")), "#"),
+		User:    strings.ToLower(strings.TrimSpace(queryValues.Get("user"))),
+		Mode:    queryValues.Get("mode"),
+	}
+
+	switch s.Mode {
+	case "", api.MatchAll, api.MatchPhrase, api.MatchPrefix, api.MatchFuzzy:
+	default:
+		h.error(rw, http.StatusBadRequest, errors.New("mode must be match, phrase, prefix or fuzzy"))
+		return
+	}
+
+	if s.Query != "" {
+		finder := api.NewFinder().Text(s.Query, s.Mode).Sort("-Timestamp", "-_id")
+		if s.Channel != "" {
+			finder = finder.Channels(s.Channel)
+		}
+		if s.User != "" {
+			finder = finder.Users(s.User)
+		}
+		log, ok := h.find(rw, r, finder)
+		if !ok {
+			return
+		}
+		s.LogPage = *log
+	}
+
+	p := &page{Title: "Search", Query: s.Query, Data: s}
+	if s.Query != "" {
+		p.Title = fmt.Sprintf("Search for %s", s.Query)
+	}
+	h.R.HTML(rw, http.StatusOK, "search", p)
+}
+
+// find runs finder for the page continuing after the cursor query value.
+// Private channels the request can't read are left out.
+func (h *Handler) find(rw http.ResponseWriter, r *http.Request, finder *api.Finder) (*LogPage, bool) {
+	queryValues := r.URL.Query()
+	finder = finder.ExcludeChannels(apikey.FromContext(r.Context()).Hidden()...).Size(pageSize)
+	if cursor := queryValues.Get("cursor"); cursor != "" {
+		after, err := api.DecodeCursor(cursor)
+		if err != nil {
+			h.error(rw, http.StatusBadRequest, err)
+			return nil, false
+		}
+		finder = finder.SearchAfter(after...)
+	}
+
+	ctx, cancel := context.WithTimeout(h.E.GetContext(), 5*time.Second)
+	defer cancel()
+
+	found, err := finder.Find(ctx, h.E.GetClient())
+	if err != nil {
+		h.error(rw, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	log := &LogPage{Total: found.Total, Messages: api.Dedupe(found.Messages, h.DedupWindow)}
+	if queryValues.Get("cursor") != "" {
+		queryValues.Del("cursor")
+		log.First = "?" + queryValues.Encode()
+	}
+	if n := len(found.Messages); n == pageSize {
+		queryValues.Set("cursor", found.Messages[n-1].Cursor())
+		log.Next = "?" + queryValues.Encode()
+	}
+	return log, true
+}
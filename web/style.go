@@ -0,0 +1,82 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const stylesheet = `body {
+	margin: 0;
+	font: 14px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+	color: #1f1f23;
+	background: #f7f7f8;
+}
+header {
+	display: flex;
+	align-items: center;
+	gap: 1em;
+	padding: 0.5em 1em;
+	color: #fff;
+	background: #6441a5;
+}
+header a {
+	color: #fff;
+	font-weight: bold;
+	text-decoration: none;
+}
+header form {
+	margin-left: auto;
+}
+main {
+	max-width: 60em;
+	margin: 0 auto;
+	padding: 1em;
+}
+a {
+	color: #6441a5;
+}
+table {
+	width: 100%;
+	border-collapse: collapse;
+}
+th, td {
+	padding: 0.2em 0.5em;
+	text-align: left;
+	vertical-align: top;
+}
+tr:nth-child(even) {
+	background: #efeff1;
+}
+.log td.time, .log td.channel {
+	white-space: nowrap;
+	color: #6b6b70;
+	font-family: monospace;
+}
+.log td.user {
+	white-space: nowrap;
+	font-weight: bold;
+}
+.log tr.event td.text {
+	font-style: italic;
+	color: #6b6b70;
+}
+.paging {
+	display: flex;
+	gap: 1em;
+	margin: 1em 0;
+}
+.search input[type=text] {
+	width: 20em;
+}
+mark {
+	background: #ffe066;
+}
+`
+
+// Stylesheet serves the stylesheet of the pages.
+func (h *Handler) Stylesheet(rw http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rw.Header().Set("Content-Type", "text/css; charset=utf-8")
+	rw.Header().Set("Cache-Control", "public, max-age=3600")
+	rw.Write([]byte(stylesheet))
+}
@@ -0,0 +1,29 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// TemplateDir is the directory of the templates, for render.Options.Directory.
+const TemplateDir = "templates"
+
+//go:embed templates
+var templates embed.FS
+
+// Asset reads an embedded template, for render.Options.Asset.
+func Asset(name string) ([]byte, error) {
+	return templates.ReadFile(name)
+}
+
+// AssetNames lists the embedded templates, for render.Options.AssetNames.
+func AssetNames() []string {
+	var names []string
+	fs.WalkDir(templates, TemplateDir, func(name string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names
+}